@@ -0,0 +1,10 @@
+module trace_collector
+
+go 1.23.6
+
+require (
+	github.com/pebbe/zmq4 v1.2.11
+	protocol v0.0.0
+)
+
+replace protocol => ../../protocol
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"math/rand"
+	"time"
+
+	zmq "github.com/pebbe/zmq4"
+	"protocol"
+)
+
+// 追踪收集器示例：
+//
+//  订阅 system.trace 主题上的 trace_report 并汇总各服务耗时，
+//  通过 ROUTER 应答 trace_stats_request。
+//
+//  go run . -report tcp://*:5570            # 收集器 + 模拟上报节点
+//  go run . -query tcp://localhost:5571     # 查询统计
+func main() {
+    sub := flag.String("sub", "tcp://localhost:5570", "trace_report 发布端地址")
+    bind := flag.String("bind", "tcp://*:5571", "trace_stats_request 监听地址")
+    report := flag.String("report", "", "非空时在该地址启动模拟上报节点")
+    query := flag.String("query", "", "非空时向该地址发送 trace_stats_request 并退出")
+    key := flag.String("key", "", "HMAC-SHA256 签名密钥，为空时不签名")
+    flag.Parse()
+
+    codec := protocol.NewWireCodec()
+    if *key != "" {
+        signer, err := protocol.NewSigner(protocol.SignatureHMACSHA256, []byte(*key))
+        if err != nil {
+            log.Fatal(err)
+        }
+        codec.WithSigner(signer)
+    }
+
+    if *query != "" {
+        if err := queryStats(codec, *query); err != nil {
+            log.Fatal(err)
+        }
+        return
+    }
+
+    if *report != "" {
+        go func() {
+            if err := runReporter(codec, *report); err != nil {
+                log.Printf("reporter error: %v\n", err)
+            }
+        }()
+    }
+
+    collector := protocol.NewTraceCollector()
+    go func() {
+        if err := runStatsServer(codec, collector, *bind); err != nil {
+            log.Fatalf("stats server error: %v\n", err)
+        }
+    }()
+    if err := runSubscriber(codec, collector, *sub); err != nil {
+        log.Fatal(err)
+    }
+}
+
+// runSubscriber 订阅 TraceTopic，将收到的 trace_report 交给收集器
+func runSubscriber(codec *protocol.WireCodec, collector *protocol.TraceCollector, address string) error {
+    socket, err := zmq.NewSocket(zmq.SUB)
+    if err != nil {
+        return err
+    }
+    defer socket.Close()
+    if err := socket.Connect(address); err != nil {
+        return err
+    }
+    if err := socket.SetSubscribe(protocol.TraceTopic); err != nil {
+        return err
+    }
+    fmt.Printf("Collecting %s from %s\n", protocol.TraceTopic, address)
+
+    for {
+        wire, err := socket.RecvMessageBytes(0)
+        if err != nil {
+            return err
+        }
+        // 主题帧作为路由前缀传给 Decode
+        _, msg, err := codec.Decode(wire)
+        if err != nil {
+            log.Printf("drop invalid message: %v\n", err)
+            continue
+        }
+        if _, err := collector.HandleMessage(msg); err != nil {
+            log.Printf("drop %s: %v\n", msg.Header.MsgType, err)
+        }
+    }
+}
+
+// runStatsServer 在 ROUTER 上应答 trace_stats_request
+func runStatsServer(codec *protocol.WireCodec, collector *protocol.TraceCollector, address string) error {
+    socket, err := zmq.NewSocket(zmq.ROUTER)
+    if err != nil {
+        return err
+    }
+    defer socket.Close()
+    if err := socket.Bind(address); err != nil {
+        return err
+    }
+
+    for {
+        wire, err := socket.RecvMessageBytes(0)
+        if err != nil {
+            return err
+        }
+        identities, msg, err := codec.Decode(wire)
+        if err != nil {
+            log.Printf("drop invalid request: %v\n", err)
+            continue
+        }
+        reply, err := collector.HandleMessage(msg)
+        if err != nil {
+            log.Printf("drop %s: %v\n", msg.Header.MsgType, err)
+            continue
+        }
+        if reply == nil {
+            continue
+        }
+        out, err := codec.Encode(identities, reply)
+        if err != nil {
+            log.Printf("encode reply: %v\n", err)
+            continue
+        }
+        if _, err := socket.SendMessage(out); err != nil {
+            return err
+        }
+    }
+}
+
+// runReporter 模拟一个 core 节点：每秒处理一次请求并把追踪发布到 TraceTopic
+func runReporter(codec *protocol.WireCodec, address string) error {
+    socket, err := zmq.NewSocket(zmq.PUB)
+    if err != nil {
+        return err
+    }
+    defer socket.Close()
+    if err := socket.Bind(address); err != nil {
+        return err
+    }
+
+    for {
+        time.Sleep(time.Second)
+
+        trace := protocol.NewMessageTrace()
+        core := trace.AddHop("core-1", "core", "localhost")
+        for _, name := range []string{"db", "cache"} {
+            hop := core.StartChild(name+"-1", name, "localhost")
+            time.Sleep(time.Duration(rand.Intn(20)) * time.Millisecond)
+            var err error
+            if rand.Intn(10) == 0 {
+                err = fmt.Errorf("%s unavailable", name)
+            }
+            hop.Complete(string(protocol.StatusOK), err)
+        }
+        core.Complete(string(protocol.StatusOK), nil)
+        trace.CalculateTotalTime()
+
+        msg, err := protocol.NewTraceReport("trace-demo", "admin", trace)
+        if err != nil {
+            return err
+        }
+        wire, err := codec.Encode([][]byte{[]byte(protocol.TraceTopic)}, msg)
+        if err != nil {
+            return err
+        }
+        if _, err := socket.SendMessage(wire); err != nil {
+            return err
+        }
+    }
+}
+
+// queryStats 发送 trace_stats_request 并打印各服务的统计
+func queryStats(codec *protocol.WireCodec, address string) error {
+    socket, err := zmq.NewSocket(zmq.DEALER)
+    if err != nil {
+        return err
+    }
+    defer socket.Close()
+    if err := socket.Connect(address); err != nil {
+        return err
+    }
+
+    req, err := protocol.NewMessageBuilder().
+        WithType(protocol.MsgTypeTraceStatsRequest).
+        WithSession("trace-demo").
+        WithUser("admin").
+        WithTransport(protocol.TransportZMQ).
+        WithContent(&protocol.TraceStatsRequestContent{}).
+        Build()
+    if err != nil {
+        return err
+    }
+    wire, err := codec.Encode(nil, req)
+    if err != nil {
+        return err
+    }
+    if _, err := socket.SendMessage(wire); err != nil {
+        return err
+    }
+
+    wire, err = socket.RecvMessageBytes(0)
+    if err != nil {
+        return err
+    }
+    _, reply, err := codec.Decode(wire)
+    if err != nil {
+        return err
+    }
+    stats, ok := reply.Content.(*protocol.TraceStatsReplyContent)
+    if !ok {
+        return fmt.Errorf("unexpected reply: %s", reply.Header.MsgType)
+    }
+
+    fmt.Printf("traces: %d\n", stats.Traces)
+    for _, s := range stats.Services {
+        fmt.Printf("%-8s count=%d errors=%.1f%% p50=%s p95=%s p99=%s max=%s\n",
+            s.ServiceName, s.Count, s.ErrorRate*100,
+            time.Duration(s.P50), time.Duration(s.P95), time.Duration(s.P99), time.Duration(s.Max))
+    }
+    return nil
+}
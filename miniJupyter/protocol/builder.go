@@ -8,7 +8,9 @@ import (
 
 // MessageBuilder 使用构建器模式创建消息
 type MessageBuilder struct {
-    message *Message
+    message  *Message
+    request  *Message    // 非 nil 时构建的是对该请求的应答
+    replyHop *MessageHop // 应答追踪中请求的最后一个节点，WithTraceHop 在其下添加子节点
 }
 
 func NewMessageBuilder() *MessageBuilder {
@@ -33,6 +35,41 @@ func NewMessageBuilder() *MessageBuilder {
     }
 }
 
+// NewReplyBuilder 创建对请求消息的应答构建器
+func NewReplyBuilder(req *Message) *MessageBuilder {
+    return NewMessageBuilder().ReplyTo(req)
+}
+
+// ReplyTo 将消息设置为对 req 的应答：复制会话、用户、传输和编码信息，设置 ParentHeader，
+// 延续请求的追踪（之后调用 WithTraceHop 时本服务的节点作为请求最后一个节点的子节点），
+// 并在注册表中有配对时自动设置应答类型
+func (b *MessageBuilder) ReplyTo(req *Message) *MessageBuilder {
+    if req == nil {
+        return b
+    }
+    b.request = req
+    b.message.Header.SessionId = req.Header.SessionId
+    b.message.Header.UserId = req.Header.UserId
+    b.message.Header.Transport = req.Header.Transport
+    b.message.Header.Encoding = req.Header.Encoding
+    b.message.Header.Codec = req.Header.Codec
+    b.message.ParentHeader = req.Header
+    if req.Trace != nil {
+        b.message.Trace = req.Trace.Clone()
+        b.replyHop = b.message.Trace.LastHop()
+    }
+    if info, ok := LookupMessageType(req.Header.MsgType); ok && info.ReplyType != "" {
+        b.message.Header.MsgType = info.ReplyType
+    }
+    return b
+}
+
+// ReplyToWithHop 等价于 ReplyTo(req).WithTraceHop(serviceId, serviceName, hostName)，
+// 在请求追踪的最后一个节点下记录本服务处理应答的节点
+func (b *MessageBuilder) ReplyToWithHop(req *Message, serviceId, serviceName, hostName string) *MessageBuilder {
+    return b.ReplyTo(req).WithTraceHop(serviceId, serviceName, hostName)
+}
+
 // 必需的设置方法
 func (b *MessageBuilder) WithType(msgType string) *MessageBuilder {
     b.message.Header.MsgType = msgType
@@ -60,11 +97,24 @@ func (b *MessageBuilder) WithCompression(compression Compression) *MessageBuilde
     return b
 }
 
+// 为 true 时除 header 外的所有帧都按 Compression 压缩，默认只压缩 content
+func (b *MessageBuilder) WithCompressAll(all bool) *MessageBuilder {
+    b.message.Header.CompressAll = all
+    return b
+}
+
 func (b *MessageBuilder) WithEncoding(encoding Encoding) *MessageBuilder {
     b.message.Header.Encoding = encoding
     return b
 }
 
+// 使用已注册的自定义编解码器，同时将 encoding 设置为 custom
+func (b *MessageBuilder) WithCodec(name string) *MessageBuilder {
+    b.message.Header.Encoding = EncodeCustom
+    b.message.Header.Codec = name
+    return b
+}
+
 func (b *MessageBuilder) WithContent(content interface{}) *MessageBuilder {
     b.message.Content = content
     return b
@@ -126,15 +176,16 @@ func (b *MessageBuilder) WithNewTrace() *MessageBuilder {
 
 func (b *MessageBuilder) WithTrace(trace *MessageTrace) *MessageBuilder {
     b.message.Trace = trace
+    b.replyHop = nil
     return b
 }
 
-// 便捷方法：同时添加 trace 并记录第一个 hop
+// 便捷方法：记录本服务的节点。构建应答时作为请求最后一个节点的子节点，否则作为根节点
 func (b *MessageBuilder) WithTraceHop(serviceId, serviceName, hostName string) *MessageBuilder {
     if b.message.Trace == nil {
         b.message.Trace = NewMessageTrace()
     }
-    b.message.Trace.AddHop(serviceId, serviceName, hostName)
+    b.message.Trace.StartChildHop(b.replyHop, serviceId, serviceName, hostName)
     return b
 }
 
@@ -160,6 +211,38 @@ func (b *MessageBuilder) Build() (*Message, error) {
     if b.message.Header.Transport == "" {
         return nil, NewProtocolError(ErrCodeInvalidMessage, "transport is required", nil)
     }
+    if b.request != nil {
+        if err := checkReplyType(b.request.Header.MsgType, b.message.Header.MsgType); err != nil {
+            return nil, err
+        }
+    }
 
     return b.message, nil
+}
+
+// checkReplyType 检查应答类型是否与请求类型配对：
+// 请求只能以注册的应答类型或 error 回复，应答不能再被回复，事件（如 comm 消息）可以用同一通道的消息或 error 回复
+func checkReplyType(requestType, replyType string) error {
+    reqInfo, ok := LookupMessageType(requestType)
+    if !ok {
+        return ErrInvalidMessageType.WithDetails("unknown request type: " + requestType)
+    }
+    if replyType == MsgTypeError && reqInfo.Kind != KindReply {
+        return nil
+    }
+
+    switch reqInfo.Kind {
+    case KindRequest:
+        if replyType != reqInfo.ReplyType {
+            return ErrInvalidMessageType.WithDetails(replyType + " is not a reply to " + requestType)
+        }
+    case KindReply:
+        return ErrInvalidMessageType.WithDetails("cannot reply to a reply: " + requestType)
+    case KindEvent:
+        replyInfo, ok := LookupMessageType(replyType)
+        if !ok || replyInfo.Channel != reqInfo.Channel {
+            return ErrInvalidMessageType.WithDetails(replyType + " is not a reply to " + requestType)
+        }
+    }
+    return nil
 }
\ No newline at end of file
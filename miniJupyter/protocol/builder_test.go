@@ -0,0 +1,43 @@
+package protocol
+
+import "testing"
+
+func TestReplyContinuesRequestTrace(t *testing.T) {
+    req, err := NewMessageBuilder().
+        WithType(MsgTypeExecuteRequest).
+        WithSession("s").
+        WithUser("u").
+        WithTransport(TransportZMQ).
+        WithTraceHop("client-1", "client", "host-a").
+        WithContent(&ExecuteRequestContent{CommandId: "c", Service: "svc", Method: "run"}).
+        Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    reply, err := NewMessageBuilder().
+        ReplyToWithHop(req, "core-1", "core", "host-b").
+        WithContent(&ExecuteReplyContent{Status: StatusWaiting}).
+        Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    if reply.Header.MsgType != MsgTypeExecuteReply || reply.ParentHeader.MsgId != req.Header.MsgId {
+        t.Fatalf("reply header not linked: %#v", reply.Header)
+    }
+    if len(req.Trace.Hops) != 1 {
+        t.Fatalf("request trace modified: %v", req.Trace)
+    }
+    if reply.Trace.TraceId != req.Trace.TraceId || len(reply.Trace.Hops) != 2 {
+        t.Fatalf("unexpected reply trace: %v", reply.Trace)
+    }
+    hop := reply.Trace.Hops[1]
+    if hop.ServiceName != "core" || hop.ParentSpanId != req.Trace.Hops[0].SpanId {
+        t.Fatalf("reply hop not a child of the request hop: %+v", hop)
+    }
+
+    // 非应答消息的 WithTraceHop 仍添加根节点
+    if root := req.Trace.Hops[0]; root.ParentSpanId != "" {
+        t.Fatalf("request hop should be a root: %+v", root)
+    }
+}
@@ -0,0 +1,139 @@
+// traceexport 将保存的追踪导出为 Chrome trace-event 或 Jaeger JSON，便于离线查看。
+//
+// 输入可以是单个追踪、追踪数组、每行一个追踪（JSON Lines），也可以是带 trace 字段的消息
+// （例如 SerializeMessage 输出的 trace_report）。未指定文件时从标准输入读取：
+//
+//  traceexport -format chrome traces.jsonl > chrome.json
+//  traceexport -format jaeger -o jaeger.json a.json b.json
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+
+	"protocol"
+)
+
+func main() {
+    format := flag.String("format", "chrome", "输出格式：chrome 或 jaeger")
+    output := flag.String("o", "", "输出文件，默认为标准输出")
+    flag.Parse()
+
+    write, ok := map[string]func(io.Writer, ...*protocol.MessageTrace) error{
+        "chrome": protocol.WriteChromeTrace,
+        "jaeger": protocol.WriteJaegerTrace,
+    }[*format]
+    if !ok {
+        fail(fmt.Errorf("unsupported format: %s", *format))
+    }
+
+    var traces []*protocol.MessageTrace
+    if flag.NArg() == 0 {
+        t, err := readTraces(os.Stdin)
+        if err != nil {
+            fail(fmt.Errorf("stdin: %w", err))
+        }
+        traces = t
+    }
+    for _, name := range flag.Args() {
+        f, err := os.Open(name)
+        if err != nil {
+            fail(err)
+        }
+        t, err := readTraces(f)
+        f.Close()
+        if err != nil {
+            fail(fmt.Errorf("%s: %w", name, err))
+        }
+        traces = append(traces, t...)
+    }
+
+    if *output == "" {
+        if err := write(os.Stdout, traces...); err != nil {
+            fail(err)
+        }
+        return
+    }
+    f, err := os.Create(*output)
+    if err != nil {
+        fail(err)
+    }
+    if err := write(f, traces...); err != nil {
+        f.Close()
+        fail(err)
+    }
+    if err := f.Close(); err != nil {
+        fail(err)
+    }
+}
+
+// readTraces 依次解析 r 中的 JSON 值，每个值为追踪、追踪数组或带 trace 字段的消息
+func readTraces(r io.Reader) ([]*protocol.MessageTrace, error) {
+    var traces []*protocol.MessageTrace
+    dec := json.NewDecoder(r)
+    for {
+        var value json.RawMessage
+        if err := dec.Decode(&value); err == io.EOF {
+            return traces, nil
+        } else if err != nil {
+            return nil, err
+        }
+
+        if value = bytes.TrimSpace(value); len(value) > 0 && value[0] == '[' {
+            var items []json.RawMessage
+            if err := json.Unmarshal(value, &items); err != nil {
+                return nil, err
+            }
+            for _, item := range items {
+                trace, err := decodeTrace(item)
+                if err != nil {
+                    return nil, err
+                }
+                traces = append(traces, trace)
+            }
+            continue
+        }
+        trace, err := decodeTrace(value)
+        if err != nil {
+            return nil, err
+        }
+        traces = append(traces, trace)
+    }
+}
+
+// decodeTrace 解析单个追踪；带 trace 字段（消息或 trace_report 的 content）时取该字段
+func decodeTrace(data json.RawMessage) (*protocol.MessageTrace, error) {
+    var probe struct {
+        Trace   json.RawMessage `json:"trace"`
+        Content struct {
+            Trace json.RawMessage `json:"trace"`
+        } `json:"content"`
+    }
+    if err := json.Unmarshal(data, &probe); err != nil {
+        return nil, err
+    }
+    switch {
+    case len(probe.Content.Trace) > 0 && string(probe.Content.Trace) != "null":
+        data = probe.Content.Trace
+    case len(probe.Trace) > 0 && string(probe.Trace) != "null":
+        data = probe.Trace
+    }
+
+    trace := &protocol.MessageTrace{}
+    if err := json.Unmarshal(data, trace); err != nil {
+        return nil, err
+    }
+    if trace.TraceId == "" {
+        return nil, fmt.Errorf("not a trace: missing trace_id")
+    }
+    return trace, nil
+}
+
+func fail(err error) {
+    fmt.Fprintln(os.Stderr, "traceexport:", err)
+    os.Exit(1)
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestReadTraces(t *testing.T) {
+    // 单个追踪、追踪数组、带 trace 字段的消息和 trace_report 可以混合出现
+    input := `{"trace_id": "t1", "hops": []}
+[{"trace_id": "t2"}, {"trace_id": "t3"}]
+{"header": {}, "trace": {"trace_id": "t4"}}
+{"header": {}, "content": {"trace": {"trace_id": "t5"}}, "trace": {"trace_id": "request"}}`
+
+    traces, err := readTraces(strings.NewReader(input))
+    if err != nil {
+        t.Fatal(err)
+    }
+    var ids []string
+    for _, trace := range traces {
+        ids = append(ids, trace.TraceId)
+    }
+    if got := strings.Join(ids, ","); got != "t1,t2,t3,t4,t5" {
+        t.Fatalf("got trace ids %s", got)
+    }
+
+    for _, bad := range []string{`{"hops": []}`, `[{"trace_id": "t1"}, 1]`, `{"trace_id": `} {
+        if _, err := readTraces(strings.NewReader(bad)); err == nil {
+            t.Fatalf("%s: expected error", bad)
+        }
+    }
+}
@@ -0,0 +1,88 @@
+package protocol
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// Codec 消息帧编解码器，EncodeCustom 时通过 Header.Codec 指定名称，由注册表查找
+type Codec interface {
+    Name() string
+    Marshal(v interface{}) ([]byte, error)
+    Unmarshal(data []byte, v interface{}) error
+}
+
+var (
+    codecsMu sync.RWMutex
+    codecs   = make(map[string]Codec)
+)
+
+// RegisterCodec 注册自定义编解码器，名称不能为空、不能与内置编码或已注册的编解码器重名
+func RegisterCodec(codec Codec) error {
+    if codec == nil || codec.Name() == "" {
+        return ErrInvalidFormat.WithDetails("codec name is required")
+    }
+    name := codec.Name()
+    if name == string(EncodeJSON) || name == string(EncodeProtobuf) || name == string(EncodeCustom) {
+        return ErrInvalidFormat.WithDetails("codec name is reserved: " + name)
+    }
+
+    codecsMu.Lock()
+    defer codecsMu.Unlock()
+    if _, exists := codecs[name]; exists {
+        return ErrInvalidFormat.WithDetails("codec already registered: " + name)
+    }
+    codecs[name] = codec
+    return nil
+}
+
+// UnregisterCodec 移除已注册的自定义编解码器
+func UnregisterCodec(name string) {
+    codecsMu.Lock()
+    defer codecsMu.Unlock()
+    delete(codecs, name)
+}
+
+// GetCodec 按名称查找自定义编解码器
+func GetCodec(name string) (Codec, bool) {
+    codecsMu.RLock()
+    defer codecsMu.RUnlock()
+    codec, ok := codecs[name]
+    return codec, ok
+}
+
+// CodecForHeader 根据 header 的 encoding 和 codec 字段选择编解码器
+func CodecForHeader(h *Header) (Codec, error) {
+    switch h.Encoding {
+    case "", EncodeJSON:
+        return jsonCodec{}, nil
+    case EncodeProtobuf:
+        return protobufCodec{}, nil
+    case EncodeCustom:
+        if h.Codec == "" {
+            return nil, ErrInvalidFormat.WithDetails("codec is required for custom encoding")
+        }
+        codec, ok := GetCodec(h.Codec)
+        if !ok {
+            return nil, ErrInvalidFormat.WithDetails("unknown codec: " + h.Codec)
+        }
+        return codec, nil
+    default:
+        return nil, ErrInvalidFormat.WithDetails("unsupported encoding: " + string(h.Encoding))
+    }
+}
+
+// jsonCodec 默认的 JSON 编码
+type jsonCodec struct{}
+
+func (jsonCodec) Name() string {
+    return string(EncodeJSON)
+}
+
+func (jsonCodec) Marshal(v interface{}) ([]byte, error) {
+    return json.Marshal(v)
+}
+
+func (jsonCodec) Unmarshal(data []byte, v interface{}) error {
+    return json.Unmarshal(data, v)
+}
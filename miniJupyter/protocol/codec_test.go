@@ -0,0 +1,169 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// prefixCodec 测试用编解码器：在 JSON 前加上前缀，便于确认确实经过了自定义编码
+type prefixCodec struct {
+    name string
+}
+
+func (c prefixCodec) Name() string { return c.name }
+
+func (c prefixCodec) Marshal(v interface{}) ([]byte, error) {
+    data, err := json.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    return append([]byte(c.name+":"), data...), nil
+}
+
+func (c prefixCodec) Unmarshal(data []byte, v interface{}) error {
+    prefix := []byte(c.name + ":")
+    if !bytes.HasPrefix(data, prefix) {
+        return errors.New("missing codec prefix")
+    }
+    return json.Unmarshal(data[len(prefix):], v)
+}
+
+func registerTestCodec(t *testing.T, name string) {
+    t.Helper()
+    if err := RegisterCodec(prefixCodec{name: name}); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { UnregisterCodec(name) })
+}
+
+func newTestCodecMessage(t *testing.T, codec string) *Message {
+    t.Helper()
+    msg, err := NewMessageBuilder().
+        WithType(MsgTypeExecuteRequest).
+        WithSession("s").
+        WithUser("u").
+        WithTransport(TransportZMQ).
+        WithCodec(codec).
+        WithContent(&ExecuteRequestContent{CommandId: "c", Service: "svc", Method: "run", Params: map[string]interface{}{"n": 1.0}}).
+        Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return msg
+}
+
+func TestRegisterCodec(t *testing.T) {
+    registerTestCodec(t, "test-register")
+    if codec, ok := GetCodec("test-register"); !ok || codec.Name() != "test-register" {
+        t.Fatalf("registered codec not found: %v", codec)
+    }
+    for name, codec := range map[string]Codec{
+        "nil":       nil,
+        "empty":     prefixCodec{},
+        "json":      prefixCodec{name: string(EncodeJSON)},
+        "protobuf":  prefixCodec{name: string(EncodeProtobuf)},
+        "custom":    prefixCodec{name: string(EncodeCustom)},
+        "duplicate": prefixCodec{name: "test-register"},
+    } {
+        if err := RegisterCodec(codec); !errors.Is(err, ErrInvalidFormat) {
+            t.Errorf("%s: expected ErrInvalidFormat, got %v", name, err)
+        }
+    }
+    UnregisterCodec("test-register")
+    if _, ok := GetCodec("test-register"); ok {
+        t.Fatal("codec still registered after UnregisterCodec")
+    }
+}
+
+func TestCodecForHeader(t *testing.T) {
+    registerTestCodec(t, "test-dispatch")
+    for _, tc := range []struct {
+        encoding Encoding
+        codec    string
+        want     string
+    }{
+        {"", "", string(EncodeJSON)},
+        {EncodeJSON, "", string(EncodeJSON)},
+        {EncodeProtobuf, "", string(EncodeProtobuf)},
+        {EncodeCustom, "test-dispatch", "test-dispatch"},
+    } {
+        codec, err := CodecForHeader(&Header{Encoding: tc.encoding, Codec: tc.codec})
+        if err != nil {
+            t.Fatalf("%s/%s: %v", tc.encoding, tc.codec, err)
+        }
+        if codec.Name() != tc.want {
+            t.Errorf("%s/%s: got %s, want %s", tc.encoding, tc.codec, codec.Name(), tc.want)
+        }
+    }
+    for _, h := range []Header{
+        {Encoding: EncodeCustom},
+        {Encoding: EncodeCustom, Codec: "no-such-codec"},
+        {Encoding: "yaml"},
+    } {
+        if _, err := CodecForHeader(&h); !errors.Is(err, ErrInvalidFormat) {
+            t.Errorf("%+v: expected ErrInvalidFormat, got %v", h, err)
+        }
+    }
+}
+
+func TestCustomCodecSerializeMessage(t *testing.T) {
+    registerTestCodec(t, "test-json")
+    msg := newTestCodecMessage(t, "test-json")
+
+    data, err := SerializeMessage(msg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var env struct {
+        Content []byte `json:"content"`
+    }
+    if err := json.Unmarshal(data, &env); err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.HasPrefix(env.Content, []byte("test-json:")) {
+        t.Fatalf("content not encoded by the custom codec: %q", env.Content)
+    }
+    got, err := ParseMessage(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got.Content, msg.Content) {
+        t.Fatalf("content mismatch: %#v", got.Content)
+    }
+
+    UnregisterCodec("test-json")
+    if _, err := ParseMessage(data); !errors.Is(err, ErrInvalidFormat) {
+        t.Fatalf("parsed with unknown codec: %v", err)
+    }
+    if _, err := SerializeMessage(msg); !errors.Is(err, ErrInvalidFormat) {
+        t.Fatalf("serialized with unknown codec: %v", err)
+    }
+}
+
+func TestCustomCodecWire(t *testing.T) {
+    registerTestCodec(t, "test-wire")
+    msg := newTestCodecMessage(t, "test-wire")
+
+    wire, err := NewWireCodec().Encode(nil, msg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if content := wire[2+frameContent]; !bytes.HasPrefix(content, []byte("test-wire:")) {
+        t.Fatalf("content frame not encoded by the custom codec: %q", content)
+    }
+    _, got, err := NewWireCodec().Decode(wire)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got.Header.Codec != "test-wire" || !reflect.DeepEqual(got.Content, msg.Content) {
+        t.Fatalf("round trip mismatch: %+v %#v", got.Header, got.Content)
+    }
+
+    UnregisterCodec("test-wire")
+    if _, _, err := NewWireCodec().Decode(wire); !errors.Is(err, ErrInvalidFormat) {
+        t.Fatalf("decoded with unknown codec: %v", err)
+    }
+}
@@ -0,0 +1,382 @@
+package protocol
+
+import (
+	"sort"
+	"sync"
+)
+
+// CommSender 发送 CommManager 生成的消息（comm_open / comm_msg / comm_close），由调用方绑定到具体 socket
+type CommSender func(msg *Message) error
+
+// CommTargetHandler 对端打开 target 的 comm 时调用，可在其中注册 OnMsg / OnClose；
+// 返回错误时 comm 会被关闭
+type CommTargetHandler func(comm *Comm, open *Message) error
+
+// CommHandler 处理 comm 收到的 comm_msg 或 comm_close，本地清理会话时 msg 为 nil
+type CommHandler func(comm *Comm, msg *Message)
+
+// CommManager 管理 comm 的生命周期，前端和 kernel 都可使用：
+// 注册 target、打开 comm 并分配 comm_id、将 comm_msg 路由到对应的 comm、处理任一端发起的关闭，
+// 在会话结束时清理该会话的所有 comm，并应答 comm_info_request 以便重连的客户端重新接入
+type CommManager struct {
+    mu      sync.Mutex
+    send    CommSender
+    targets map[string]CommTargetHandler
+    comms   map[string]*Comm
+}
+
+// Comm 一条双向通信通道，属于打开它的会话
+type Comm struct {
+    mu         sync.Mutex
+    id         string
+    targetName string
+    sessionId  string
+    userId     string
+    manager    *CommManager
+    onMsg      CommHandler
+    onClose    CommHandler
+    closed     bool
+}
+
+// NewCommManager 创建 comm 管理器，send 用于发出消息
+func NewCommManager(send CommSender) *CommManager {
+    return &CommManager{
+        send:    send,
+        targets: make(map[string]CommTargetHandler),
+        comms:   make(map[string]*Comm),
+    }
+}
+
+// RegisterTarget 注册 target 的处理函数，重复注册返回错误
+func (m *CommManager) RegisterTarget(targetName string, handler CommTargetHandler) error {
+    if targetName == "" || handler == nil {
+        return ErrInvalidParams.WithDetails("target name and handler are required")
+    }
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if _, exists := m.targets[targetName]; exists {
+        return ErrCommFailed.WithDetails("target already registered: " + targetName)
+    }
+    m.targets[targetName] = handler
+    return nil
+}
+
+// UnregisterTarget 移除 target，已打开的 comm 不受影响
+func (m *CommManager) UnregisterTarget(targetName string) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    delete(m.targets, targetName)
+}
+
+// Open 以新分配的 comm_id 打开到对端 target 的 comm 并发送 comm_open
+func (m *CommManager) Open(sessionId, userId, targetName string, data interface{}) (*Comm, error) {
+    if targetName == "" {
+        return nil, ErrCommFailed.WithDetails("target name is required")
+    }
+    comm := &Comm{
+        id:         GenerateUUID(),
+        targetName: targetName,
+        sessionId:  sessionId,
+        userId:     userId,
+        manager:    m,
+    }
+    msg, err := comm.newMessage(MsgTypeCommOpen, nil, &CommOpenContent{
+        CommId:     comm.id,
+        TargetName: targetName,
+        Data:       data,
+    })
+    if err != nil {
+        return nil, err
+    }
+
+    m.mu.Lock()
+    m.comms[comm.id] = comm
+    m.mu.Unlock()
+    if err := m.send(msg); err != nil {
+        m.remove(comm.id)
+        return nil, ErrCommFailed.WithCause(err)
+    }
+    return comm, nil
+}
+
+// HandleMessage 处理收到的 comm 消息：
+// comm_open 交给 target 处理函数（target 不存在或 comm_id 已被占用时回复 comm_close），comm_msg 路由到对应 comm，
+// comm_close 移除 comm 并调用其 OnClose，comm_info_request 回复 comm_info_reply
+func (m *CommManager) HandleMessage(msg *Message) error {
+    switch msg.Header.MsgType {
+    case MsgTypeCommInfoRequest:
+        var targetName string
+        if req, ok := msg.Content.(*CommInfoRequestContent); ok {
+            targetName = req.TargetName
+        }
+        reply, err := NewReplyBuilder(msg).
+            WithContent(&CommInfoReplyContent{
+                Status: StatusOK,
+                Comms:  m.CommInfo(targetName, msg.Header.UserId),
+            }).
+            Build()
+        if err != nil {
+            return err
+        }
+        if err := m.send(reply); err != nil {
+            return ErrCommFailed.WithCause(err)
+        }
+        return nil
+    case MsgTypeCommOpen:
+        content, ok := msg.Content.(*CommOpenContent)
+        if !ok {
+            return ErrValidationFailed.WithDetails("unexpected content for comm_open")
+        }
+        return m.handleOpen(msg, content)
+    case MsgTypeCommMsg, MsgTypeCommClose:
+        content, ok := msg.Content.(*CommMsgContent)
+        if !ok {
+            return ErrValidationFailed.WithDetails("unexpected content for " + msg.Header.MsgType)
+        }
+        comm, err := m.lookup(content.CommId, msg.Header.SessionId)
+        if err != nil {
+            return err
+        }
+        if msg.Header.MsgType == MsgTypeCommClose {
+            comm.closeLocal(msg)
+            return nil
+        }
+        comm.mu.Lock()
+        handler := comm.onMsg
+        comm.mu.Unlock()
+        if handler != nil {
+            handler(comm, msg)
+        }
+        return nil
+    default:
+        return ErrInvalidMessageType.WithDetails(msg.Header.MsgType)
+    }
+}
+
+func (m *CommManager) handleOpen(msg *Message, content *CommOpenContent) error {
+    comm := &Comm{
+        id:         content.CommId,
+        targetName: content.TargetName,
+        sessionId:  msg.Header.SessionId,
+        userId:     msg.Header.UserId,
+        manager:    m,
+    }
+
+    m.mu.Lock()
+    handler, ok := m.targets[content.TargetName]
+    _, exists := m.comms[content.CommId]
+    if ok && !exists {
+        m.comms[comm.id] = comm
+    }
+    m.mu.Unlock()
+
+    if exists || !ok {
+        // 通知对端该 comm 无法建立，已存在的同 id comm 不受影响
+        comm.sendClose(msg, nil)
+        if exists {
+            return ErrCommFailed.WithDetails("comm_id already in use: " + content.CommId)
+        }
+        return ErrCommFailed.WithDetails("unknown target: " + content.TargetName)
+    }
+    if err := handler(comm, msg); err != nil {
+        comm.Close(nil)
+        return err
+    }
+    return nil
+}
+
+// lookup 查找 comm 并确认消息来自同一会话
+func (m *CommManager) lookup(commId, sessionId string) (*Comm, error) {
+    m.mu.Lock()
+    comm, ok := m.comms[commId]
+    m.mu.Unlock()
+    if !ok {
+        return nil, ErrCommFailed.WithDetails("unknown comm_id: " + commId)
+    }
+    if comm.sessionId != sessionId {
+        return nil, ErrInsufficientPerms.WithDetails("comm belongs to another session")
+    }
+    return comm, nil
+}
+
+func (m *CommManager) remove(commId string) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    delete(m.comms, commId)
+}
+
+// Get 按 comm_id 查找已打开的 comm
+func (m *CommManager) Get(commId string) (*Comm, bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    comm, ok := m.comms[commId]
+    return comm, ok
+}
+
+// Comms 返回已打开的 comm（按 comm_id 排序），targetName 为空时返回全部
+func (m *CommManager) Comms(targetName string) []*Comm {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    comms := make([]*Comm, 0, len(m.comms))
+    for _, comm := range m.comms {
+        if targetName == "" || comm.targetName == targetName {
+            comms = append(comms, comm)
+        }
+    }
+    sort.Slice(comms, func(i, j int) bool { return comms[i].id < comms[j].id })
+    return comms
+}
+
+// CommInfo 列出 userId 拥有的已打开 comm（comm_id -> 信息），targetName 不为空时只列出该 target
+func (m *CommManager) CommInfo(targetName, userId string) map[string]CommInfo {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    infos := make(map[string]CommInfo)
+    for id, comm := range m.comms {
+        if comm.userId != userId || (targetName != "" && comm.targetName != targetName) {
+            continue
+        }
+        infos[id] = CommInfo{TargetName: comm.targetName, SessionId: comm.sessionId}
+    }
+    return infos
+}
+
+// Attach 重新接入对端仍然打开的 comm（通常来自 comm_info_reply），不发送 comm_open；
+// 之后发出的消息沿用该 comm 所属的会话。comm_id 已在本地存在时返回已有的 comm
+func (m *CommManager) Attach(commId, userId string, info CommInfo) *Comm {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    if comm, ok := m.comms[commId]; ok {
+        return comm
+    }
+    comm := &Comm{
+        id:         commId,
+        targetName: info.TargetName,
+        sessionId:  info.SessionId,
+        userId:     userId,
+        manager:    m,
+    }
+    m.comms[commId] = comm
+    return comm
+}
+
+// CloseSession 会话结束时清理其所有 comm，不再向对端发送 comm_close，OnClose 收到的 msg 为 nil
+func (m *CommManager) CloseSession(sessionId string) {
+    m.mu.Lock()
+    var comms []*Comm
+    for _, comm := range m.comms {
+        if comm.sessionId == sessionId {
+            comms = append(comms, comm)
+        }
+    }
+    m.mu.Unlock()
+    for _, comm := range comms {
+        comm.closeLocal(nil)
+    }
+}
+
+///////////////////////////////////////////////////////////////////////////////////////
+
+// Id 返回 comm_id
+func (c *Comm) Id() string { return c.id }
+
+// TargetName 返回 target 名称
+func (c *Comm) TargetName() string { return c.targetName }
+
+// SessionId 返回 comm 所属的会话
+func (c *Comm) SessionId() string { return c.sessionId }
+
+// OnMsg 设置收到 comm_msg 时的处理函数
+func (c *Comm) OnMsg(handler CommHandler) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.onMsg = handler
+}
+
+// OnClose 设置 comm 关闭（对端关闭或会话清理）时的处理函数，本端调用 Close 时不触发
+func (c *Comm) OnClose(handler CommHandler) {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.onClose = handler
+}
+
+// IsClosed comm 是否已关闭
+func (c *Comm) IsClosed() bool {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.closed
+}
+
+// Send 发送 comm_msg
+func (c *Comm) Send(data interface{}) error {
+    return c.Reply(nil, data)
+}
+
+// Reply 发送 comm_msg，parent 不为 nil 时作为其应答（设置 parent_header 并延续追踪）
+func (c *Comm) Reply(parent *Message, data interface{}) error {
+    if c.IsClosed() {
+        return ErrCommFailed.WithDetails("comm is closed: " + c.id)
+    }
+    msg, err := c.newMessage(MsgTypeCommMsg, parent, &CommMsgContent{CommId: c.id, Data: data})
+    if err != nil {
+        return err
+    }
+    if err := c.manager.send(msg); err != nil {
+        return ErrCommFailed.WithCause(err)
+    }
+    return nil
+}
+
+// Close 发送 comm_close 并移除 comm，重复关闭无效果
+func (c *Comm) Close(data interface{}) error {
+    c.mu.Lock()
+    if c.closed {
+        c.mu.Unlock()
+        return nil
+    }
+    c.closed = true
+    c.mu.Unlock()
+    c.manager.remove(c.id)
+    return c.sendClose(nil, data)
+}
+
+// closeLocal 对端关闭或会话清理时移除 comm 并调用 OnClose
+func (c *Comm) closeLocal(msg *Message) {
+    c.mu.Lock()
+    if c.closed {
+        c.mu.Unlock()
+        return
+    }
+    c.closed = true
+    handler := c.onClose
+    c.mu.Unlock()
+    c.manager.remove(c.id)
+    if handler != nil {
+        handler(c, msg)
+    }
+}
+
+func (c *Comm) sendClose(parent *Message, data interface{}) error {
+    msg, err := c.newMessage(MsgTypeCommClose, parent, &CommMsgContent{CommId: c.id, Data: data})
+    if err != nil {
+        return err
+    }
+    if err := c.manager.send(msg); err != nil {
+        return ErrCommFailed.WithCause(err)
+    }
+    return nil
+}
+
+// newMessage 构建本 comm 的消息
+func (c *Comm) newMessage(msgType string, parent *Message, content interface{}) (*Message, error) {
+    b := NewMessageBuilder()
+    if parent != nil {
+        b.ReplyTo(parent)
+    }
+    return b.WithType(msgType).
+        WithSession(c.sessionId).
+        WithUser(c.userId).
+        WithTransport(TransportZMQ).
+        WithContent(content).
+        Build()
+}
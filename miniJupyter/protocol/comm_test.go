@@ -0,0 +1,346 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"sync"
+	"testing"
+)
+
+// commRecorder 记录 CommManager 发出的消息
+type commRecorder struct {
+    mu   sync.Mutex
+    sent []*Message
+    err  error
+}
+
+func (r *commRecorder) send(msg *Message) error {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    if r.err != nil {
+        return r.err
+    }
+    r.sent = append(r.sent, msg)
+    return nil
+}
+
+// take 返回并清空已发出的消息
+func (r *commRecorder) take() []*Message {
+    r.mu.Lock()
+    defer r.mu.Unlock()
+    sent := r.sent
+    r.sent = nil
+    return sent
+}
+
+// takeOne 要求恰好发出一条 msgType 消息
+func (r *commRecorder) takeOne(t *testing.T, msgType string) *Message {
+    t.Helper()
+    sent := r.take()
+    if len(sent) != 1 || sent[0].Header.MsgType != msgType {
+        t.Fatalf("expected one %s, got %d messages", msgType, len(sent))
+    }
+    return sent[0]
+}
+
+func newTestCommOpen(t *testing.T, sessionId, commId, targetName string) *Message {
+    t.Helper()
+    msg, err := NewMessageBuilder().
+        WithType(MsgTypeCommOpen).
+        WithSession(sessionId).
+        WithUser("alice").
+        WithTransport(TransportZMQ).
+        WithContent(&CommOpenContent{CommId: commId, TargetName: targetName}).
+        Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return msg
+}
+
+func TestCommOpenMsgClose(t *testing.T) {
+    frontOut, kernelOut := &commRecorder{}, &commRecorder{}
+    front, kernel := NewCommManager(frontOut.send), NewCommManager(kernelOut.send)
+
+    var kernelClosed *Message
+    err := kernel.RegisterTarget("echo", func(comm *Comm, open *Message) error {
+        comm.OnMsg(func(comm *Comm, msg *Message) {
+            comm.Reply(msg, msg.Content.(*CommMsgContent).Data)
+        })
+        comm.OnClose(func(comm *Comm, msg *Message) { kernelClosed = msg })
+        return nil
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := kernel.RegisterTarget("echo", func(*Comm, *Message) error { return nil }); !errors.Is(err, ErrCommFailed) {
+        t.Fatalf("duplicate target: %v", err)
+    }
+
+    comm, err := front.Open("s1", "alice", "echo", "hello")
+    if err != nil {
+        t.Fatal(err)
+    }
+    open := frontOut.takeOne(t, MsgTypeCommOpen)
+    if c := open.Content.(*CommOpenContent); c.CommId != comm.Id() || c.TargetName != "echo" || c.Data != "hello" {
+        t.Fatalf("comm_open content %+v", c)
+    }
+    if err := kernel.HandleMessage(open); err != nil {
+        t.Fatal(err)
+    }
+    remote, ok := kernel.Get(comm.Id())
+    if !ok || remote.SessionId() != "s1" || remote.TargetName() != "echo" {
+        t.Fatalf("kernel comm %+v, %v", remote, ok)
+    }
+
+    var echoed *Message
+    comm.OnMsg(func(_ *Comm, msg *Message) { echoed = msg })
+    if err := comm.Send("ping"); err != nil {
+        t.Fatal(err)
+    }
+    request := frontOut.takeOne(t, MsgTypeCommMsg)
+    if err := kernel.HandleMessage(request); err != nil {
+        t.Fatal(err)
+    }
+    reply := kernelOut.takeOne(t, MsgTypeCommMsg)
+    if reply.ParentHeader.MsgId != request.Header.MsgId {
+        t.Fatalf("reply parent %q, want %q", reply.ParentHeader.MsgId, request.Header.MsgId)
+    }
+    if err := front.HandleMessage(reply); err != nil {
+        t.Fatal(err)
+    }
+    if echoed == nil || echoed.Content.(*CommMsgContent).Data != "ping" {
+        t.Fatalf("echo not delivered: %+v", echoed)
+    }
+
+    if err := comm.Close("bye"); err != nil {
+        t.Fatal(err)
+    }
+    closeMsg := frontOut.takeOne(t, MsgTypeCommClose)
+    if err := kernel.HandleMessage(closeMsg); err != nil {
+        t.Fatal(err)
+    }
+    if kernelClosed != closeMsg || !remote.IsClosed() {
+        t.Fatal("kernel comm not closed by comm_close")
+    }
+    if _, ok := kernel.Get(comm.Id()); ok {
+        t.Fatal("closed comm still registered")
+    }
+
+    // 关闭后不能再发送，重复关闭不再发出 comm_close
+    if err := comm.Send("late"); !errors.Is(err, ErrCommFailed) {
+        t.Fatalf("send on closed comm: %v", err)
+    }
+    if err := comm.Close(nil); err != nil || len(frontOut.take()) != 0 {
+        t.Fatalf("second close: %v", err)
+    }
+    if err := kernel.HandleMessage(request); !errors.Is(err, ErrCommFailed) {
+        t.Fatalf("comm_msg for closed comm: %v", err)
+    }
+}
+
+func TestCommOpenErrors(t *testing.T) {
+    out := &commRecorder{}
+    m := NewCommManager(out.send)
+
+    if _, err := m.Open("s1", "alice", "", nil); !errors.Is(err, ErrCommFailed) {
+        t.Fatalf("empty target: %v", err)
+    }
+    if len(out.take()) != 0 {
+        t.Fatal("comm_open sent for empty target")
+    }
+
+    out.err = errors.New("socket closed")
+    if _, err := m.Open("s1", "alice", "echo", nil); !errors.Is(err, ErrCommFailed) {
+        t.Fatalf("send failure: %v", err)
+    }
+    if len(m.Comms("")) != 0 {
+        t.Fatal("comm kept after send failure")
+    }
+}
+
+func TestCommUnknownTarget(t *testing.T) {
+    out := &commRecorder{}
+    m := NewCommManager(out.send)
+
+    open := newTestCommOpen(t, "s1", "c1", "missing")
+    if err := m.HandleMessage(open); !errors.Is(err, ErrCommFailed) {
+        t.Fatalf("unknown target: %v", err)
+    }
+    reply := out.takeOne(t, MsgTypeCommClose)
+    if reply.Content.(*CommMsgContent).CommId != "c1" || reply.ParentHeader.MsgId != open.Header.MsgId {
+        t.Fatalf("comm_close %+v", reply)
+    }
+    if _, ok := m.Get("c1"); ok {
+        t.Fatal("comm registered for unknown target")
+    }
+
+    // target 处理函数返回错误时关闭 comm
+    m.RegisterTarget("broken", func(*Comm, *Message) error { return ErrInvalidParams })
+    if err := m.HandleMessage(newTestCommOpen(t, "s1", "c2", "broken")); !errors.Is(err, ErrInvalidParams) {
+        t.Fatalf("failing target: %v", err)
+    }
+    out.takeOne(t, MsgTypeCommClose)
+    if _, ok := m.Get("c2"); ok {
+        t.Fatal("comm kept after target handler failed")
+    }
+}
+
+func TestCommDuplicateId(t *testing.T) {
+    out := &commRecorder{}
+    m := NewCommManager(out.send)
+    opened := 0
+    m.RegisterTarget("echo", func(*Comm, *Message) error {
+        opened++
+        return nil
+    })
+
+    if err := m.HandleMessage(newTestCommOpen(t, "s1", "c1", "echo")); err != nil {
+        t.Fatal(err)
+    }
+    original, _ := m.Get("c1")
+
+    duplicate := newTestCommOpen(t, "s2", "c1", "echo")
+    if err := m.HandleMessage(duplicate); !errors.Is(err, ErrCommFailed) {
+        t.Fatalf("duplicate comm_id: %v", err)
+    }
+    reply := out.takeOne(t, MsgTypeCommClose)
+    if reply.Header.SessionId != "s2" || reply.ParentHeader.MsgId != duplicate.Header.MsgId {
+        t.Fatalf("comm_close not addressed to the duplicate open: %+v", reply.Header)
+    }
+
+    // 已存在的 comm 不受影响
+    if comm, ok := m.Get("c1"); !ok || comm != original || comm.IsClosed() || comm.SessionId() != "s1" || opened != 1 {
+        t.Fatalf("original comm changed: %+v, %v, opened %d", comm, ok, opened)
+    }
+}
+
+func TestCommSessionCheck(t *testing.T) {
+    out := &commRecorder{}
+    m := NewCommManager(out.send)
+    m.RegisterTarget("echo", func(*Comm, *Message) error { return nil })
+    if err := m.HandleMessage(newTestCommOpen(t, "s1", "c1", "echo")); err != nil {
+        t.Fatal(err)
+    }
+
+    msg, err := NewMessageBuilder().
+        WithType(MsgTypeCommMsg).
+        WithSession("s2").
+        WithUser("alice").
+        WithTransport(TransportZMQ).
+        WithContent(&CommMsgContent{CommId: "c1"}).
+        Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := m.HandleMessage(msg); !errors.Is(err, ErrInsufficientPerms) {
+        t.Fatalf("comm_msg from another session: %v", err)
+    }
+    msg.Header.MsgType = MsgTypeCommClose
+    if err := m.HandleMessage(msg); !errors.Is(err, ErrInsufficientPerms) {
+        t.Fatalf("comm_close from another session: %v", err)
+    }
+    if comm, ok := m.Get("c1"); !ok || comm.IsClosed() {
+        t.Fatal("comm closed by another session")
+    }
+}
+
+func TestCommCloseSession(t *testing.T) {
+    out := &commRecorder{}
+    m := NewCommManager(out.send)
+    var closed []string
+    var mu sync.Mutex
+    m.RegisterTarget("echo", func(comm *Comm, _ *Message) error {
+        comm.OnClose(func(comm *Comm, msg *Message) {
+            if msg != nil {
+                t.Errorf("OnClose for %s got message %v", comm.Id(), msg.Header.MsgType)
+            }
+            mu.Lock()
+            closed = append(closed, comm.Id())
+            mu.Unlock()
+        })
+        return nil
+    })
+    for _, open := range []struct{ session, id string }{{"s1", "c1"}, {"s1", "c2"}, {"s2", "c3"}} {
+        if err := m.HandleMessage(newTestCommOpen(t, open.session, open.id, "echo")); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    m.CloseSession("s1")
+    if len(closed) != 2 {
+        t.Fatalf("OnClose called for %v", closed)
+    }
+    if len(out.take()) != 0 {
+        t.Fatal("comm_close sent while cleaning up a session")
+    }
+    if comms := m.Comms(""); len(comms) != 1 || comms[0].Id() != "c3" {
+        t.Fatalf("remaining comms %v", comms)
+    }
+}
+
+func TestCommInfoReply(t *testing.T) {
+    out := &commRecorder{}
+    m := NewCommManager(out.send)
+    for _, target := range []string{"widgets", "plots"} {
+        m.RegisterTarget(target, func(*Comm, *Message) error { return nil })
+    }
+    for _, open := range []struct{ session, user, id, target string }{
+        {"s1", "alice", "c1", "widgets"},
+        {"s1", "alice", "c2", "plots"},
+        {"s2", "alice", "c3", "widgets"},
+        {"s3", "bob", "c4", "widgets"},
+    } {
+        msg := newTestCommOpen(t, open.session, open.id, open.target)
+        msg.Header.UserId = open.user
+        if err := m.HandleMessage(msg); err != nil {
+            t.Fatal(err)
+        }
+    }
+
+    request := func(session, user, target string) map[string]CommInfo {
+        t.Helper()
+        req, err := NewMessageBuilder().
+            WithType(MsgTypeCommInfoRequest).
+            WithSession(session).
+            WithUser(user).
+            WithTransport(TransportZMQ).
+            WithContent(&CommInfoRequestContent{TargetName: target}).
+            Build()
+        if err != nil {
+            t.Fatal(err)
+        }
+        if err := m.HandleMessage(req); err != nil {
+            t.Fatal(err)
+        }
+        reply := out.takeOne(t, MsgTypeCommInfoReply)
+        content, ok := reply.Content.(*CommInfoReplyContent)
+        if !ok || content.Status != StatusOK || reply.ParentHeader.MsgId != req.Header.MsgId {
+            t.Fatalf("comm_info_reply %+v", reply)
+        }
+        return content.Comms
+    }
+
+    // 重连的客户端使用新会话，仍能看到同一用户在其他会话中打开的 comm
+    got := request("s9", "alice", "")
+    want := map[string]CommInfo{
+        "c1": {TargetName: "widgets", SessionId: "s1"},
+        "c2": {TargetName: "plots", SessionId: "s1"},
+        "c3": {TargetName: "widgets", SessionId: "s2"},
+    }
+    if !reflect.DeepEqual(got, want) {
+        t.Fatalf("alice: got %v, want %v", got, want)
+    }
+    if got := request("s1", "alice", "widgets"); len(got) != 2 || got["c2"] != (CommInfo{}) {
+        t.Fatalf("alice widgets: %v", got)
+    }
+    if got := request("s3", "bob", ""); len(got) != 1 || got["c4"].SessionId != "s3" {
+        t.Fatalf("bob: %v", got)
+    }
+    if got := request("s1", "alice", "missing"); len(got) != 0 {
+        t.Fatalf("unknown target: %v", got)
+    }
+    if got := request("s4", "carol", ""); got == nil || len(got) != 0 {
+        t.Fatalf("user without comms: %v", got)
+    }
+}
@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+)
+
+// 压缩相关默认参数
+const (
+    DefaultCompressThreshold = 1024     // auto 模式下超过该字节数才压缩
+    MaxDecompressedSize      = 64 << 20 // 单帧解压后的最大字节数，防止压缩炸弹
+)
+
+// IsValidCompression 检查压缩方式是否可用于 wire 消息
+func IsValidCompression(c Compression) bool {
+    switch c {
+    case "", CompressNone, CompressGzip, CompressSnappy:
+        return true
+    }
+    return false
+}
+
+// Compress 按指定方式压缩数据
+func Compress(c Compression, data []byte) ([]byte, error) {
+    switch c {
+    case "", CompressNone:
+        return data, nil
+    case CompressGzip:
+        var buf bytes.Buffer
+        w := gzip.NewWriter(&buf)
+        if _, err := w.Write(data); err != nil {
+            return nil, ErrSerializeFailed.WithDetails("gzip: " + err.Error())
+        }
+        if err := w.Close(); err != nil {
+            return nil, ErrSerializeFailed.WithDetails("gzip: " + err.Error())
+        }
+        return buf.Bytes(), nil
+    case CompressSnappy:
+        return snappyEncode(data), nil
+    default:
+        return nil, ErrSerializeFailed.WithDetails("unsupported compression: " + string(c))
+    }
+}
+
+// Decompress 按指定方式解压数据
+func Decompress(c Compression, data []byte) ([]byte, error) {
+    switch c {
+    case "", CompressNone:
+        return data, nil
+    case CompressGzip:
+        r, err := gzip.NewReader(bytes.NewReader(data))
+        if err != nil {
+            return nil, ErrDeserializeFailed.WithDetails("gzip: " + err.Error())
+        }
+        defer r.Close()
+        out, err := io.ReadAll(io.LimitReader(r, MaxDecompressedSize+1))
+        if err != nil {
+            return nil, ErrDeserializeFailed.WithDetails("gzip: " + err.Error())
+        }
+        if len(out) > MaxDecompressedSize {
+            return nil, ErrDeserializeFailed.WithDetails("gzip: decompressed frame too large")
+        }
+        return out, nil
+    case CompressSnappy:
+        out, err := snappyDecode(data, MaxDecompressedSize)
+        if err != nil {
+            return nil, ErrDeserializeFailed.WithDetails(err.Error())
+        }
+        return out, nil
+    default:
+        return nil, ErrDeserializeFailed.WithDetails("unsupported compression: " + string(c))
+    }
+}
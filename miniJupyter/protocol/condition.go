@@ -0,0 +1,371 @@
+package protocol
+
+import (
+	"fmt"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// ConditionExprKey ExecuteRequestContent.Condition 中保存条件表达式的键
+const ConditionExprKey = "expr"
+
+// Condition 编译后的执行条件（ExecuteRequestContent.Condition）
+//
+// condition 中 "expr" 为条件表达式，其余每个键为一个引用、值为期望值，相当于 `引用 == 值`，
+// 所有条件同时满足才执行命令。表达式语法：
+//
+//  expr    = or
+//  or      = and { "||" and }
+//  and     = unary { "&&" unary }
+//  unary   = "!" unary | compare
+//  compare = operand [ ( "==" | "!=" | "<" | "<=" | ">" | ">=" ) operand ]
+//  operand = "(" expr ")" | 引用 | 字符串 | 数字 | true | false | null
+//
+// 引用：
+//
+//  dep.<command_id>.status    依赖的状态：success || error || skipped
+//  dep.<command_id>.result    依赖的结果，可继续用 . 访问字段
+//  dep.<command_id>.error     依赖的错误（code / message / details），成功时为 null
+//  dep.<command_id>.attempts  依赖的执行次数
+//  params.<key>               请求的 params
+//  session.<key>              会话变量
+//
+// 只能引用 dependency 中列出的命令；不存在的字段为 null。
+// 依赖被跳过时，只有条件引用了该依赖的命令才会求值（从而可以判断 status == "skipped"），其他命令直接跳过。
+// 单独的操作数按真值判断：null、false、0、空字符串、空数组和空对象为假。
+// < <= > >= 只比较两个数字或两个字符串，其他情况为假。
+// 例如 `dep.fetch.status == "success" && params.retries < 3 || session.debug`
+type Condition struct {
+    eval func(env ConditionEnv) interface{}
+    deps []string
+}
+
+// ConditionEnv 条件求值时可引用的数据
+type ConditionEnv struct {
+    Deps    map[string]TaskState   // 依赖的状态，按 command_id
+    Params  map[string]interface{} // 请求的 params
+    Session map[string]interface{} // 会话变量
+}
+
+// CompileCondition 编译执行条件，condition 为空时返回 nil（始终执行）；语法错误返回 ErrInvalidParams
+func CompileCondition(condition map[string]interface{}) (*Condition, error) {
+    if len(condition) == 0 {
+        return nil, nil
+    }
+    keys := make([]string, 0, len(condition))
+    for key := range condition {
+        keys = append(keys, key)
+    }
+    sort.Strings(keys)
+
+    c := &Condition{}
+    var terms []func(env ConditionEnv) interface{}
+    for _, key := range keys {
+        value := condition[key]
+        if key == ConditionExprKey {
+            expr, ok := value.(string)
+            if !ok {
+                return nil, ErrInvalidParams.WithDetails("condition: expr must be a string")
+            }
+            term, err := c.parse(expr)
+            if err != nil {
+                return nil, err
+            }
+            terms = append(terms, term)
+            continue
+        }
+        ref, err := c.reference(key)
+        if err != nil {
+            return nil, ErrInvalidParams.WithDetails("condition: " + err.Error())
+        }
+        expected, err := cloneJSON(value)
+        if err != nil {
+            return nil, ErrInvalidParams.WithDetails("condition: invalid value for " + key)
+        }
+        terms = append(terms, func(env ConditionEnv) interface{} {
+            return reflect.DeepEqual(ref(env), expected)
+        })
+    }
+    c.eval = func(env ConditionEnv) interface{} {
+        for _, term := range terms {
+            if !conditionTruthy(term(env)) {
+                return false
+            }
+        }
+        return true
+    }
+    return c, nil
+}
+
+// Eval 对 env 求值，判断是否执行命令
+func (c *Condition) Eval(env ConditionEnv) bool {
+    return conditionTruthy(c.eval(env))
+}
+
+// Deps 返回条件引用的依赖 command_id（去重，按出现顺序）
+func (c *Condition) Deps() []string {
+    return c.deps
+}
+
+func (c *Condition) parse(expr string) (func(ConditionEnv) interface{}, error) {
+    return newConditionParser(c).parse(expr)
+}
+
+// reference 解析引用并记录引用的依赖
+func (c *Condition) reference(ref string) (func(ConditionEnv) interface{}, error) {
+    parts := strings.Split(ref, ".")
+    for _, part := range parts {
+        if part == "" {
+            return nil, fmt.Errorf("invalid reference %q", ref)
+        }
+    }
+    switch parts[0] {
+    case "dep":
+        if len(parts) < 3 {
+            return nil, fmt.Errorf("invalid reference %q, expected dep.<command_id>.<field>", ref)
+        }
+        id, field, path := parts[1], parts[2], parts[3:]
+        switch field {
+        case "status", "result", "error", "attempts":
+        default:
+            return nil, fmt.Errorf("unknown dependency field %q", field)
+        }
+        c.addDep(id)
+        return func(env ConditionEnv) interface{} {
+            state, ok := env.Deps[id]
+            if !ok {
+                return nil
+            }
+            return lookupConditionPath(dependencyValue(state, field), path)
+        }, nil
+    case "params":
+        if len(parts) < 2 {
+            return nil, fmt.Errorf("invalid reference %q, expected params.<key>", ref)
+        }
+        return func(env ConditionEnv) interface{} {
+            return lookupConditionPath(env.Params, parts[1:])
+        }, nil
+    case "session":
+        if len(parts) < 2 {
+            return nil, fmt.Errorf("invalid reference %q, expected session.<key>", ref)
+        }
+        return func(env ConditionEnv) interface{} {
+            return lookupConditionPath(env.Session, parts[1:])
+        }, nil
+    default:
+        return nil, fmt.Errorf("unknown reference %q", ref)
+    }
+}
+
+func (c *Condition) addDep(id string) {
+    for _, dep := range c.deps {
+        if dep == id {
+            return
+        }
+    }
+    c.deps = append(c.deps, id)
+}
+
+// dependencyValue 依赖状态中被引用的字段
+func dependencyValue(state TaskState, field string) interface{} {
+    switch field {
+    case "status":
+        return string(state.Status)
+    case "result":
+        return state.Result
+    case "error":
+        if state.Err == nil {
+            return nil
+        }
+        return NewErrorContent(state.Err)
+    case "attempts":
+        return state.Attempts
+    }
+    return nil
+}
+
+// lookupConditionPath 沿 path 访问 JSON 值，不存在时为 nil；值先规范化为 JSON 基本类型
+func lookupConditionPath(root interface{}, path []string) interface{} {
+    cur, err := cloneJSON(root)
+    if err != nil {
+        return nil
+    }
+    for _, key := range path {
+        switch node := cur.(type) {
+        case map[string]interface{}:
+            cur = node[key]
+        case []interface{}:
+            i, err := strconv.Atoi(key)
+            if err != nil || i < 0 || i >= len(node) {
+                return nil
+            }
+            cur = node[i]
+        default:
+            return nil
+        }
+    }
+    return cur
+}
+
+// conditionTruthy 操作数的真值
+func conditionTruthy(v interface{}) bool {
+    switch v := v.(type) {
+    case nil:
+        return false
+    case bool:
+        return v
+    case float64:
+        return v != 0
+    case string:
+        return v != ""
+    case []interface{}:
+        return len(v) > 0
+    case map[string]interface{}:
+        return len(v) > 0
+    default:
+        return true
+    }
+}
+
+// compareCondition 比较两个操作数，不可比较时返回 false
+func compareCondition(op string, left, right interface{}) bool {
+    switch op {
+    case "==":
+        return reflect.DeepEqual(left, right)
+    case "!=":
+        return !reflect.DeepEqual(left, right)
+    }
+    var cmp int
+    switch l := left.(type) {
+    case float64:
+        r, ok := right.(float64)
+        if !ok {
+            return false
+        }
+        switch {
+        case l < r:
+            cmp = -1
+        case l > r:
+            cmp = 1
+        }
+    case string:
+        r, ok := right.(string)
+        if !ok {
+            return false
+        }
+        cmp = strings.Compare(l, r)
+    default:
+        return false
+    }
+    switch op {
+    case "<":
+        return cmp < 0
+    case "<=":
+        return cmp <= 0
+    case ">":
+        return cmp > 0
+    case ">=":
+        return cmp >= 0
+    }
+    return false
+}
+
+///////////////////////////////////////////////////////////////////////////////////////
+
+// conditionSyntax 条件表达式的词法：引用、数字和比较运算符
+var conditionSyntax = &exprSyntax{
+    name:     "condition",
+    err:      ErrInvalidParams,
+    wordByte: isConditionWordByte,
+    compare:  true,
+}
+
+// isConditionWordByte 引用和数字中允许的字符，command_id 通常为带 - 的 UUID
+func isConditionWordByte(c byte) bool {
+    return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+        strings.IndexByte("_-.+", c) >= 0
+}
+
+// conditionParser 递归下降解析，直接生成求值闭包
+type conditionParser struct {
+    exprParser[func(ConditionEnv) interface{}]
+    cond *Condition
+}
+
+func newConditionParser(cond *Condition) *conditionParser {
+    p := &conditionParser{cond: cond}
+    p.syntax = conditionSyntax
+    p.unary = p.parseUnary
+    p.or = func(l, r func(ConditionEnv) interface{}) func(ConditionEnv) interface{} {
+        return func(env ConditionEnv) interface{} { return conditionTruthy(l(env)) || conditionTruthy(r(env)) }
+    }
+    p.and = func(l, r func(ConditionEnv) interface{}) func(ConditionEnv) interface{} {
+        return func(env ConditionEnv) interface{} { return conditionTruthy(l(env)) && conditionTruthy(r(env)) }
+    }
+    return p
+}
+
+func (p *conditionParser) parseUnary() (func(ConditionEnv) interface{}, error) {
+    if p.peek().kind == exprNot {
+        p.next()
+        inner, err := p.parseUnary()
+        if err != nil {
+            return nil, err
+        }
+        return func(env ConditionEnv) interface{} { return !conditionTruthy(inner(env)) }, nil
+    }
+    left, err := p.parseOperand()
+    if err != nil {
+        return nil, err
+    }
+    if p.peek().kind != exprCompare {
+        return left, nil
+    }
+    op := p.next().text
+    right, err := p.parseOperand()
+    if err != nil {
+        return nil, err
+    }
+    return func(env ConditionEnv) interface{} { return compareCondition(op, left(env), right(env)) }, nil
+}
+
+func (p *conditionParser) parseOperand() (func(ConditionEnv) interface{}, error) {
+    tok := p.next()
+    switch tok.kind {
+    case exprLParen:
+        return p.parseGroup()
+    case exprString:
+        value := tok.text
+        return func(ConditionEnv) interface{} { return value }, nil
+    case exprWord:
+        var value interface{}
+        switch tok.text {
+        case "true":
+            value = true
+        case "false":
+            value = false
+        case "null":
+        default:
+            if c := tok.text[0]; c >= '0' && c <= '9' || c == '-' || c == '+' {
+                n, err := strconv.ParseFloat(tok.text, 64)
+                if err != nil {
+                    return nil, p.errorf(tok, "invalid number %q", tok.text)
+                }
+                value = n
+                break
+            }
+            ref, err := p.cond.reference(tok.text)
+            if err != nil {
+                return nil, p.errorf(tok, "%v", err)
+            }
+            return ref, nil
+        }
+        return func(ConditionEnv) interface{} { return value }, nil
+    case exprEOF:
+        return nil, p.errorf(tok, "unexpected end of expression")
+    default:
+        return nil, p.errorf(tok, "unexpected %q", tok.text)
+    }
+}
@@ -0,0 +1,40 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCompileCondition(t *testing.T) {
+    env := ConditionEnv{
+        Deps: map[string]TaskState{
+            "fetch": {Status: StatusSuccess, Result: map[string]interface{}{"rows": []interface{}{1, 2}}, Attempts: 2},
+        },
+        Params:  map[string]interface{}{"retries": 1, "mode": "fast"},
+        Session: map[string]interface{}{"debug": false},
+    }
+    for expr, want := range map[string]bool{
+        `dep.fetch.status == "success" && (params.retries < 3 || session.debug)`: true,
+        `dep.fetch.result.rows.1 >= 2 && dep.fetch.attempts != 1`:                true,
+        `!dep.fetch.error && params.missing == null`:                             true,
+        `params.mode > "slow" || -1 > 0`:                                         false,
+        `params.mode < 3`:                                                        false,
+    } {
+        c, err := CompileCondition(map[string]interface{}{"expr": expr})
+        if err != nil {
+            t.Fatalf("%s: %v", expr, err)
+        }
+        if got := c.Eval(env); got != want {
+            t.Errorf("%s: got %v, want %v", expr, got, want)
+        }
+        if deps := c.Deps(); len(deps) > 1 || len(deps) == 1 && deps[0] != "fetch" {
+            t.Errorf("%s: unexpected deps %v", expr, deps)
+        }
+    }
+
+    for _, expr := range []string{"", "params.a ==", "(true", "true)", `"a`, "foo.bar", "dep.x", "1.2.3", "a:b", "params.a = 1"} {
+        if _, err := CompileCondition(map[string]interface{}{"expr": expr}); !errors.Is(err, ErrInvalidParams) {
+            t.Errorf("%q: expected ErrInvalidParams, got %v", expr, err)
+        }
+    }
+}
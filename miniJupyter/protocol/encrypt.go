@@ -0,0 +1,201 @@
+package protocol
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/binary"
+	"io"
+	"strings"
+)
+
+// security.encryption 取值
+const (
+    EncryptionNone = "None"
+    EncryptionAES  = "AES"
+    EncryptionRSA  = "RSA"
+)
+
+// IsValidEncryption 检查加密方式是否受支持（不区分大小写，空值视为 None）
+func IsValidEncryption(encryption string) bool {
+    switch normalizeEncryption(encryption) {
+    case EncryptionNone, EncryptionAES, EncryptionRSA:
+        return true
+    }
+    return false
+}
+
+// normalizeEncryption 统一加密方式的大小写
+func normalizeEncryption(encryption string) string {
+    switch strings.ToUpper(encryption) {
+    case "", "NONE":
+        return EncryptionNone
+    case "AES":
+        return EncryptionAES
+    case "RSA":
+        return EncryptionRSA
+    }
+    return encryption
+}
+
+// ContentCipher 按 security.encryption 加解密 content 帧
+//
+// AES: AES-GCM，密钥为会话密钥（WithSessionKeys）或共享密钥（WithAESKey），输出 nonce || ciphertext
+// RSA: 随机生成 AES-256 密钥加密 content，再用接收方公钥以 RSA-OAEP(SHA-256) 包装该密钥，
+//      输出 len(wrapped key) (2 字节) || wrapped key || nonce || ciphertext
+//
+// 两种方式都以 msg_id 作为附加认证数据，密文无法被挪用到其他消息
+type ContentCipher struct {
+    aesKey      []byte
+    sessionKeys func(sessionId string) ([]byte, bool)
+    publicKey   *rsa.PublicKey  // 接收方公钥，用于加密
+    privateKey  *rsa.PrivateKey // 本节点私钥，用于解密
+}
+
+// NewContentCipher 创建 content 加解密器
+func NewContentCipher() *ContentCipher {
+    return &ContentCipher{}
+}
+
+// WithAESKey 设置 AES 共享密钥（16、24 或 32 字节）
+func (c *ContentCipher) WithAESKey(key []byte) *ContentCipher {
+    c.aesKey = append([]byte(nil), key...)
+    return c
+}
+
+// WithSessionKeys 设置按 session_id 查找 AES 密钥的函数，找到时优先于共享密钥
+func (c *ContentCipher) WithSessionKeys(lookup func(sessionId string) ([]byte, bool)) *ContentCipher {
+    c.sessionKeys = lookup
+    return c
+}
+
+// WithRSAPublicKey 设置接收方公钥，用于 RSA 模式加密
+func (c *ContentCipher) WithRSAPublicKey(key *rsa.PublicKey) *ContentCipher {
+    c.publicKey = key
+    return c
+}
+
+// WithRSAPrivateKey 设置本节点私钥，用于 RSA 模式解密
+func (c *ContentCipher) WithRSAPrivateKey(key *rsa.PrivateKey) *ContentCipher {
+    c.privateKey = key
+    return c
+}
+
+// Encrypt 按 encryption 加密 content，None 时原样返回
+func (c *ContentCipher) Encrypt(h *Header, encryption string, plaintext []byte) ([]byte, error) {
+    switch normalizeEncryption(encryption) {
+    case EncryptionNone:
+        return plaintext, nil
+    case EncryptionAES:
+        key, err := c.aesKeyFor(h.SessionId)
+        if err != nil {
+            return nil, err
+        }
+        return sealGCM(key, plaintext, []byte(h.MsgId))
+    case EncryptionRSA:
+        if c.publicKey == nil {
+            return nil, ErrSerializeFailed.WithDetails("RSA public key is not configured")
+        }
+        key := make([]byte, 32)
+        if _, err := io.ReadFull(rand.Reader, key); err != nil {
+            return nil, ErrSerializeFailed.WithDetails(err.Error())
+        }
+        wrapped, err := rsa.EncryptOAEP(sha256.New(), rand.Reader, c.publicKey, key, []byte(h.MsgId))
+        if err != nil {
+            return nil, ErrSerializeFailed.WithDetails(err.Error())
+        }
+        sealed, err := sealGCM(key, plaintext, []byte(h.MsgId))
+        if err != nil {
+            return nil, err
+        }
+        out := binary.BigEndian.AppendUint16(nil, uint16(len(wrapped)))
+        out = append(out, wrapped...)
+        return append(out, sealed...), nil
+    default:
+        return nil, ErrValidationFailed.WithDetails("unsupported encryption: " + encryption)
+    }
+}
+
+// Decrypt 按 encryption 解密 content，None 时原样返回
+func (c *ContentCipher) Decrypt(h *Header, encryption string, ciphertext []byte) ([]byte, error) {
+    switch normalizeEncryption(encryption) {
+    case EncryptionNone:
+        return ciphertext, nil
+    case EncryptionAES:
+        key, err := c.aesKeyFor(h.SessionId)
+        if err != nil {
+            return nil, err
+        }
+        return openGCM(key, ciphertext, []byte(h.MsgId))
+    case EncryptionRSA:
+        if c.privateKey == nil {
+            return nil, ErrDeserializeFailed.WithDetails("RSA private key is not configured")
+        }
+        if len(ciphertext) < 2 {
+            return nil, ErrDeserializeFailed.WithDetails("malformed RSA content")
+        }
+        n := int(binary.BigEndian.Uint16(ciphertext))
+        if len(ciphertext) < 2+n {
+            return nil, ErrDeserializeFailed.WithDetails("malformed RSA content")
+        }
+        key, err := rsa.DecryptOAEP(sha256.New(), nil, c.privateKey, ciphertext[2:2+n], []byte(h.MsgId))
+        if err != nil {
+            return nil, ErrDeserializeFailed.WithDetails("failed to unwrap content key")
+        }
+        return openGCM(key, ciphertext[2+n:], []byte(h.MsgId))
+    default:
+        return nil, ErrValidationFailed.WithDetails("unsupported encryption: " + encryption)
+    }
+}
+
+// aesKeyFor 返回会话密钥，没有时使用共享密钥
+func (c *ContentCipher) aesKeyFor(sessionId string) ([]byte, error) {
+    if c.sessionKeys != nil {
+        if key, ok := c.sessionKeys(sessionId); ok {
+            return key, nil
+        }
+    }
+    if c.aesKey == nil {
+        return nil, NewProtocolError(ErrCodeUnauthorized, "no AES key for session", sessionId)
+    }
+    return c.aesKey, nil
+}
+
+// sealGCM 使用 AES-GCM 加密，输出 nonce || ciphertext
+func sealGCM(key, plaintext, aad []byte) ([]byte, error) {
+    gcm, err := newGCM(key)
+    if err != nil {
+        return nil, ErrSerializeFailed.WithDetails(err.Error())
+    }
+    nonce := make([]byte, gcm.NonceSize())
+    if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+        return nil, ErrSerializeFailed.WithDetails(err.Error())
+    }
+    return gcm.Seal(nonce, nonce, plaintext, aad), nil
+}
+
+// openGCM 解密 sealGCM 的输出
+func openGCM(key, data, aad []byte) ([]byte, error) {
+    gcm, err := newGCM(key)
+    if err != nil {
+        return nil, ErrDeserializeFailed.WithDetails(err.Error())
+    }
+    if len(data) < gcm.NonceSize() {
+        return nil, ErrDeserializeFailed.WithDetails("malformed encrypted content")
+    }
+    plaintext, err := gcm.Open(nil, data[:gcm.NonceSize()], data[gcm.NonceSize():], aad)
+    if err != nil {
+        return nil, ErrDeserializeFailed.WithDetails("failed to decrypt content")
+    }
+    return plaintext, nil
+}
+
+func newGCM(key []byte) (cipher.AEAD, error) {
+    block, err := aes.NewCipher(key)
+    if err != nil {
+        return nil, err
+    }
+    return cipher.NewGCM(block)
+}
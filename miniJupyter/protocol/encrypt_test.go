@@ -0,0 +1,134 @@
+package protocol
+
+import (
+	"bytes"
+	"crypto/rand"
+	"crypto/rsa"
+	"testing"
+)
+
+func testAESKey(b byte) []byte {
+    return bytes.Repeat([]byte{b}, 32)
+}
+
+func TestContentCipherAES(t *testing.T) {
+    h := &Header{MsgId: "m1", SessionId: "s1"}
+    plaintext := []byte(`{"params":{"password":"hunter2"}}`)
+    c := NewContentCipher().WithAESKey(testAESKey(1))
+
+    sealed, err := c.Encrypt(h, EncryptionAES, plaintext)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if bytes.Contains(sealed, []byte("hunter2")) {
+        t.Fatal("plaintext visible in ciphertext")
+    }
+    out, err := c.Decrypt(h, "aes", sealed)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(out, plaintext) {
+        t.Fatalf("got %q", out)
+    }
+
+    // 每次加密使用新的 nonce
+    again, _ := c.Encrypt(h, EncryptionAES, plaintext)
+    if bytes.Equal(again, sealed) {
+        t.Fatal("nonce reused")
+    }
+}
+
+func TestContentCipherAESTamper(t *testing.T) {
+    h := &Header{MsgId: "m1", SessionId: "s1"}
+    c := NewContentCipher().WithAESKey(testAESKey(1))
+    sealed, _ := c.Encrypt(h, EncryptionAES, []byte("secret content"))
+
+    for i := range sealed {
+        tampered := append([]byte(nil), sealed...)
+        tampered[i] ^= 0x01
+        if _, err := c.Decrypt(h, EncryptionAES, tampered); GetErrorCode(err) != ErrCodeDeserializeFailed {
+            t.Fatalf("byte %d: tampered ciphertext accepted: %v", i, err)
+        }
+    }
+    if _, err := c.Decrypt(h, EncryptionAES, sealed[:5]); GetErrorCode(err) != ErrCodeDeserializeFailed {
+        t.Fatalf("truncated ciphertext accepted: %v", err)
+    }
+    // msg_id 作为附加认证数据，密文不能挪用到其他消息
+    if _, err := c.Decrypt(&Header{MsgId: "m2", SessionId: "s1"}, EncryptionAES, sealed); GetErrorCode(err) != ErrCodeDeserializeFailed {
+        t.Fatalf("ciphertext replayed under another msg_id: %v", err)
+    }
+    if _, err := NewContentCipher().WithAESKey(testAESKey(2)).Decrypt(h, EncryptionAES, sealed); GetErrorCode(err) != ErrCodeDeserializeFailed {
+        t.Fatalf("wrong key accepted: %v", err)
+    }
+}
+
+func TestContentCipherSessionKeys(t *testing.T) {
+    keys := map[string][]byte{"s1": testAESKey(7)}
+    c := NewContentCipher().WithSessionKeys(func(id string) ([]byte, bool) {
+        key, ok := keys[id]
+        return key, ok
+    })
+    h := &Header{MsgId: "m1", SessionId: "s1"}
+    sealed, err := c.Encrypt(h, EncryptionAES, []byte("x"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := NewContentCipher().WithAESKey(testAESKey(7)).Decrypt(h, EncryptionAES, sealed); err != nil {
+        t.Fatalf("session key not used: %v", err)
+    }
+    if _, err := c.Encrypt(&Header{MsgId: "m1", SessionId: "s2"}, EncryptionAES, []byte("x")); GetErrorCode(err) != ErrCodeUnauthorized {
+        t.Fatalf("expected ErrUnauthorized without key, got %v", err)
+    }
+}
+
+func TestContentCipherRSA(t *testing.T) {
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatal(err)
+    }
+    other, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatal(err)
+    }
+    h := &Header{MsgId: "m1", SessionId: "s1"}
+    sender := NewContentCipher().WithRSAPublicKey(&key.PublicKey)
+    receiver := NewContentCipher().WithRSAPrivateKey(key)
+
+    sealed, err := sender.Encrypt(h, EncryptionRSA, []byte("top secret"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    out, err := receiver.Decrypt(h, EncryptionRSA, sealed)
+    if err != nil || string(out) != "top secret" {
+        t.Fatalf("got %q, %v", out, err)
+    }
+
+    // 篡改被包装的密钥或密文
+    for _, i := range []int{0, 1, 10, len(sealed) - 1} {
+        tampered := append([]byte(nil), sealed...)
+        tampered[i] ^= 0x01
+        if _, err := receiver.Decrypt(h, EncryptionRSA, tampered); GetErrorCode(err) != ErrCodeDeserializeFailed {
+            t.Fatalf("byte %d: tampered content accepted: %v", i, err)
+        }
+    }
+    if _, err := NewContentCipher().WithRSAPrivateKey(other).Decrypt(h, EncryptionRSA, sealed); GetErrorCode(err) != ErrCodeDeserializeFailed {
+        t.Fatalf("wrong private key accepted: %v", err)
+    }
+    if _, err := sender.Decrypt(h, EncryptionRSA, sealed); GetErrorCode(err) != ErrCodeDeserializeFailed {
+        t.Fatalf("decrypt without private key: %v", err)
+    }
+    if _, err := receiver.Decrypt(h, EncryptionRSA, []byte{0xff}); GetErrorCode(err) != ErrCodeDeserializeFailed {
+        t.Fatalf("malformed content accepted: %v", err)
+    }
+}
+
+func TestContentCipherUnsupported(t *testing.T) {
+    c := NewContentCipher().WithAESKey(testAESKey(1))
+    if _, err := c.Encrypt(&Header{}, "DES", []byte("x")); GetErrorCode(err) != ErrCodeValidationFailed {
+        t.Fatalf("expected ErrValidationFailed, got %v", err)
+    }
+    out, err := c.Encrypt(&Header{}, "", []byte("x"))
+    if err != nil || string(out) != "x" {
+        t.Fatalf("None should pass through: %q %v", out, err)
+    }
+}
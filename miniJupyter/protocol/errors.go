@@ -1,20 +1,44 @@
 package protocol
 
-import "fmt"
+import (
+	"errors"
+	"fmt"
+)
 
 // ProtocolError 定义协议错误类型
 type ProtocolError struct {
     Code    int         `json:"code"`
     Message string      `json:"message"`
     Details interface{} `json:"details,omitempty"`
+    Cause   error       `json:"-"` // 引发该错误的底层错误（可选），不参与序列化
 }
 
 // Error 实现 error 接口
 func (e *ProtocolError) Error() string {
+    msg := fmt.Sprintf("[%d] %s", e.Code, e.Message)
     if e.Details != nil {
-        return fmt.Sprintf("[%d] %s: %v", e.Code, e.Message, e.Details)
+        msg = fmt.Sprintf("%s: %v", msg, e.Details)
+    }
+    if e.Cause != nil {
+        msg = fmt.Sprintf("%s: %v", msg, e.Cause)
     }
-    return fmt.Sprintf("[%d] %s", e.Code, e.Message)
+    return msg
+}
+
+// Is 按错误码比较，使 errors.Is(err, ErrTimeout) 对 WithDetails / WithCause 产生的实例和被包装的错误同样成立
+func (e *ProtocolError) Is(target error) bool {
+    t, ok := target.(*ProtocolError)
+    return ok && t.Code == e.Code
+}
+
+// Unwrap 返回底层错误
+func (e *ProtocolError) Unwrap() error {
+    return e.Cause
+}
+
+// Category 返回错误码所属类别
+func (e *ProtocolError) Category() ErrorCategory {
+    return CategoryOf(e.Code)
 }
 
 // NewProtocolError 创建新的协议错误
@@ -26,6 +50,49 @@ func NewProtocolError(code int, message string, details interface{}) *ProtocolEr
     }
 }
 
+// ErrorCategory 错误码类别，对应错误码范围
+type ErrorCategory int
+
+const (
+    CategoryUnknown       ErrorCategory = iota
+    CategoryProtocol                    // 1000-1099
+    CategoryAuth                        // 1100-1199
+    CategoryExecution                   // 1200-1299
+    CategoryCommunication               // 1300-1399
+)
+
+// String 返回类别名称
+func (c ErrorCategory) String() string {
+    switch c {
+    case CategoryProtocol:
+        return "protocol"
+    case CategoryAuth:
+        return "auth"
+    case CategoryExecution:
+        return "execution"
+    case CategoryCommunication:
+        return "communication"
+    default:
+        return "unknown"
+    }
+}
+
+// CategoryOf 根据错误码范围返回类别
+func CategoryOf(code int) ErrorCategory {
+    switch {
+    case code >= 1000 && code < 1100:
+        return CategoryProtocol
+    case code >= 1100 && code < 1200:
+        return CategoryAuth
+    case code >= 1200 && code < 1300:
+        return CategoryExecution
+    case code >= 1300 && code < 1400:
+        return CategoryCommunication
+    default:
+        return CategoryUnknown
+    }
+}
+
 // 预定义错误码
 const (
     // 1000-1099: Protocol level errors 协议级错误
@@ -36,12 +103,14 @@ const (
     ErrCodeValidationFailed   = 1004  // 消息内容验证失败（如字段值不合法）
     ErrCodeSerializeFailed    = 1005  // 消息序列化失败（转JSON等）
     ErrCodeDeserializeFailed  = 1006  // 消息反序列化失败（解析JSON等）
+    ErrCodeReplayDetected     = 1007  // 重放消息或时间戳超出允许窗口
 
     // 1100-1199: Authentication/Authorization errors 认证/授权错误
     ErrCodeUnauthorized      = 1100  // 未经授权的访问
     ErrCodeInvalidToken      = 1101  // 无效的认证令牌
     ErrCodeInsufficientPerms = 1102  // 权限不足
     ErrCodeSessionExpired    = 1103  // 会话已过期
+    ErrCodeInvalidSignature  = 1104  // 消息签名校验失败
 
     // 1200-1299: Execution errors 执行错误
     ErrCodeExecutionFailed   = 1200  // 执行失败
@@ -57,6 +126,7 @@ const (
     ErrCodeSubscribeFailed   = 1302  // 订阅失败
     ErrCodePublishFailed     = 1303  // 发布失败
     ErrCodeCommFailed        = 1304  // 通信操作失败
+    ErrCodeQueueClosed       = 1305  // 消息队列已关闭
 )
 
 // 预定义错误实例
@@ -69,12 +139,14 @@ var (
     ErrValidationFailed   = NewProtocolError(ErrCodeValidationFailed, "Message validation failed", nil)
     ErrSerializeFailed    = NewProtocolError(ErrCodeSerializeFailed, "Message serialization failed", nil)
     ErrDeserializeFailed  = NewProtocolError(ErrCodeDeserializeFailed, "Message deserialization failed", nil)
+    ErrReplayDetected     = NewProtocolError(ErrCodeReplayDetected, "Message replay detected", nil)
 
     // Auth errors
     ErrUnauthorized       = NewProtocolError(ErrCodeUnauthorized, "Unauthorized access", nil)
     ErrInvalidToken       = NewProtocolError(ErrCodeInvalidToken, "Invalid token", nil)
     ErrInsufficientPerms  = NewProtocolError(ErrCodeInsufficientPerms, "Insufficient permissions", nil)
     ErrSessionExpired     = NewProtocolError(ErrCodeSessionExpired, "Session expired", nil)
+    ErrInvalidSignature   = NewProtocolError(ErrCodeInvalidSignature, "Invalid message signature", nil)
 
     // Execution errors
     ErrExecutionFailed    = NewProtocolError(ErrCodeExecutionFailed, "Execution failed", nil)
@@ -90,6 +162,7 @@ var (
     ErrSubscribeFailed   = NewProtocolError(ErrCodeSubscribeFailed, "Subscribe failed", nil)
     ErrPublishFailed     = NewProtocolError(ErrCodePublishFailed, "Publish failed", nil)
     ErrCommFailed        = NewProtocolError(ErrCodeCommFailed, "Comm operation failed", nil)
+    ErrQueueClosed       = NewProtocolError(ErrCodeQueueClosed, "Queue closed", nil)
 )
 
 // WithDetails 添加错误详情
@@ -98,19 +171,109 @@ func (e *ProtocolError) WithDetails(details interface{}) *ProtocolError {
         Code:    e.Code,
         Message: e.Message,
         Details: details,
+        Cause:   e.Cause,
+    }
+}
+
+// WithCause 包装底层错误
+func (e *ProtocolError) WithCause(cause error) *ProtocolError {
+    return &ProtocolError{
+        Code:    e.Code,
+        Message: e.Message,
+        Details: e.Details,
+        Cause:   cause,
+    }
+}
+
+// AsProtocolError 在错误链中查找协议错误
+func AsProtocolError(err error) (*ProtocolError, bool) {
+    var pe *ProtocolError
+    if errors.As(err, &pe) {
+        return pe, true
     }
+    return nil, false
 }
 
-// IsProtocolError 检查是否为协议错误
+// IsProtocolError 检查错误链中是否有协议错误
 func IsProtocolError(err error) bool {
-    _, ok := err.(*ProtocolError)
+    _, ok := AsProtocolError(err)
     return ok
 }
 
-// GetErrorCode 获取错误码，如果不是协议错误则返回0
+// GetErrorCode 获取错误链中第一个协议错误的错误码，如果没有则返回0
 func GetErrorCode(err error) int {
-    if pe, ok := err.(*ProtocolError); ok {
+    if pe, ok := AsProtocolError(err); ok {
         return pe.Code
     }
     return 0
+}
+
+// GetErrorCategory 获取错误链中协议错误的类别
+func GetErrorCategory(err error) ErrorCategory {
+    return CategoryOf(GetErrorCode(err))
+}
+
+// IsProtocolLevelError 是否为协议级错误（1000-1099）
+func IsProtocolLevelError(err error) bool {
+    return GetErrorCategory(err) == CategoryProtocol
+}
+
+// IsAuthError 是否为认证/授权错误（1100-1199）
+func IsAuthError(err error) bool {
+    return GetErrorCategory(err) == CategoryAuth
+}
+
+// IsExecutionError 是否为执行错误（1200-1299）
+func IsExecutionError(err error) bool {
+    return GetErrorCategory(err) == CategoryExecution
+}
+
+// IsCommunicationError 是否为通信错误（1300-1399）
+func IsCommunicationError(err error) bool {
+    return GetErrorCategory(err) == CategoryCommunication
+}
+
+// NewErrorContent 将任意错误转换为 error 消息的 content，非协议错误和 nil 按执行失败处理
+func NewErrorContent(err error) *ErrorContent {
+    if err == nil {
+        err = ErrExecutionFailed.WithDetails("unknown error")
+    }
+    pe, ok := AsProtocolError(err)
+    if !ok {
+        pe = ErrExecutionFailed.WithDetails(err.Error())
+    }
+    details := pe.Details
+    if details == nil && pe.Cause != nil {
+        // 底层错误不参与序列化，以详情的形式保留其描述
+        details = pe.Cause.Error()
+    }
+    return &ErrorContent{
+        Code:    pe.Code,
+        Message: pe.Message,
+        Details: details,
+    }
+}
+
+// Err 将 error 消息的 content 还原为协议错误
+func (c *ErrorContent) Err() *ProtocolError {
+    return NewProtocolError(c.Code, c.Message, c.Details)
+}
+
+// NewErrorReply 构建对 req 的 error 应答，保留 parent_header 和追踪信息；err 为 nil 时按执行失败应答
+func NewErrorReply(req *Message, err error) (*Message, error) {
+    return NewReplyBuilder(req).
+        WithType(MsgTypeError).
+        WithContent(NewErrorContent(err)).
+        Build()
+}
+
+// ErrorFromMessage 如果消息是 error 应答，返回其中的协议错误，否则返回 nil
+func ErrorFromMessage(msg *Message) error {
+    if msg == nil || msg.Header.MsgType != MsgTypeError {
+        return nil
+    }
+    if content, ok := msg.Content.(*ErrorContent); ok {
+        return content.Err()
+    }
+    return ErrInvalidFormat.WithDetails("malformed error content")
 }
\ No newline at end of file
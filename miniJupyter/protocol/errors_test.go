@@ -0,0 +1,173 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+func TestNewErrorContent(t *testing.T) {
+    tests := []struct {
+        name string
+        err  error
+        want ErrorContent
+    }{
+        {"protocol error", ErrTimeout.WithDetails("db"), ErrorContent{ErrCodeTimeout, "Operation timeout", "db"}},
+        {"cause as details", ErrConnectionFailed.WithCause(errors.New("refused")), ErrorContent{ErrCodeConnectionFailed, "Connection failed", "refused"}},
+        {"plain error", errors.New("boom"), ErrorContent{ErrCodeExecutionFailed, "Execution failed", "boom"}},
+        {"nil", nil, ErrorContent{ErrCodeExecutionFailed, "Execution failed", "unknown error"}},
+    }
+    for _, tt := range tests {
+        got := NewErrorContent(tt.err)
+        if !reflect.DeepEqual(*got, tt.want) {
+            t.Fatalf("%s: got %+v, want %+v", tt.name, *got, tt.want)
+        }
+        if pe := got.Err(); pe.Code != tt.want.Code || pe.Message != tt.want.Message || pe.Details != tt.want.Details {
+            t.Fatalf("%s: Err() = %v", tt.name, pe)
+        }
+    }
+}
+
+func TestNewErrorReply(t *testing.T) {
+    req := newTestExecuteRequest(t, EncryptionNone, CompressNone)
+    req.Trace = NewMessageTrace()
+    req.Trace.AddHop("core-1", "core", "localhost")
+
+    reply, err := NewErrorReply(req, ErrServiceNotFound.WithDetails("db"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if reply.Header.MsgType != MsgTypeError || reply.ParentHeader.MsgId != req.Header.MsgId {
+        t.Fatalf("reply header %+v, parent %+v", reply.Header, reply.ParentHeader)
+    }
+    if reply.Header.SessionId != req.Header.SessionId || reply.Header.UserId != req.Header.UserId {
+        t.Fatalf("reply session/user %+v", reply.Header)
+    }
+    if reply.Trace == nil || reply.Trace.TraceId != req.Trace.TraceId {
+        t.Fatalf("reply trace %+v", reply.Trace)
+    }
+
+    // 经过序列化后仍能还原为原来的协议错误
+    data, err := SerializeMessage(reply)
+    if err != nil {
+        t.Fatal(err)
+    }
+    parsed, err := ParseMessage(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    got := ErrorFromMessage(parsed)
+    if GetErrorCode(got) != ErrCodeServiceNotFound {
+        t.Fatalf("ErrorFromMessage = %v", got)
+    }
+    if pe, _ := AsProtocolError(got); pe.Details != "db" {
+        t.Fatalf("details %v", pe.Details)
+    }
+
+    reply, err = NewErrorReply(req, nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if GetErrorCode(ErrorFromMessage(reply)) != ErrCodeExecutionFailed {
+        t.Fatalf("nil error reply: %+v", reply.Content)
+    }
+}
+
+func TestErrorFromMessage(t *testing.T) {
+    if err := ErrorFromMessage(nil); err != nil {
+        t.Fatalf("nil message: %v", err)
+    }
+    if err := ErrorFromMessage(newTestExecuteRequest(t, EncryptionNone, CompressNone)); err != nil {
+        t.Fatalf("non-error message: %v", err)
+    }
+    malformed := &Message{Header: Header{MsgType: MsgTypeError}, Content: "oops"}
+    if err := ErrorFromMessage(malformed); GetErrorCode(err) != ErrCodeInvalidFormat {
+        t.Fatalf("malformed error content: %v", err)
+    }
+}
+
+func TestErrorsIsThroughWrapping(t *testing.T) {
+    cause := errors.New("refused")
+    err := fmt.Errorf("dial core: %w", ErrConnectionFailed.WithDetails("core-1").WithCause(cause))
+
+    if !errors.Is(err, ErrConnectionFailed) {
+        t.Fatal("errors.Is does not match through WithDetails, WithCause and fmt.Errorf")
+    }
+    if !errors.Is(err, cause) {
+        t.Fatal("errors.Is does not reach the cause")
+    }
+    if errors.Is(err, ErrTimeout) || errors.Is(ErrTimeout.WithDetails("x"), ErrConnectionFailed) {
+        t.Fatal("errors.Is matched a different code")
+    }
+    if errors.Is(errors.New("Connection failed"), ErrConnectionFailed) {
+        t.Fatal("errors.Is matched a plain error")
+    }
+
+    // 以协议错误作为 cause 时，外层和内层的错误码都能匹配
+    nested := ErrDependencyFailed.WithCause(ErrTimeout.WithDetails("db"))
+    if !errors.Is(nested, ErrDependencyFailed) || !errors.Is(nested, ErrTimeout) {
+        t.Fatal("errors.Is does not match nested protocol errors")
+    }
+    if GetErrorCode(nested) != ErrCodeDependencyFailed {
+        t.Fatalf("GetErrorCode(nested) = %d", GetErrorCode(nested))
+    }
+
+    pe, ok := AsProtocolError(err)
+    if !ok || pe.Code != ErrCodeConnectionFailed || pe.Details != "core-1" || pe.Cause != cause {
+        t.Fatalf("AsProtocolError = %+v, %v", pe, ok)
+    }
+    if _, ok := AsProtocolError(cause); ok || IsProtocolError(nil) || GetErrorCode(cause) != 0 {
+        t.Fatal("plain errors reported as protocol errors")
+    }
+
+    // WithDetails / WithCause 不修改预定义实例
+    if ErrConnectionFailed.Details != nil || ErrConnectionFailed.Cause != nil {
+        t.Fatalf("predefined error mutated: %+v", ErrConnectionFailed)
+    }
+}
+
+func TestErrorCategories(t *testing.T) {
+    tests := []struct {
+        err      error
+        category ErrorCategory
+        name     string
+    }{
+        {ErrInvalidVersion, CategoryProtocol, "protocol"},
+        {ErrReplayDetected, CategoryProtocol, "protocol"},
+        {ErrInvalidSignature, CategoryAuth, "auth"},
+        {ErrInvalidParams, CategoryExecution, "execution"},
+        {fmt.Errorf("wrapped: %w", ErrQueueClosed.WithDetails("q")), CategoryCommunication, "communication"},
+        {errors.New("plain"), CategoryUnknown, "unknown"},
+        {nil, CategoryUnknown, "unknown"},
+        {NewProtocolError(9999, "custom", nil), CategoryUnknown, "unknown"},
+    }
+    for _, tt := range tests {
+        if got := GetErrorCategory(tt.err); got != tt.category || got.String() != tt.name {
+            t.Fatalf("GetErrorCategory(%v) = %v", tt.err, got)
+        }
+        checks := map[ErrorCategory]bool{
+            CategoryProtocol:      IsProtocolLevelError(tt.err),
+            CategoryAuth:          IsAuthError(tt.err),
+            CategoryExecution:     IsExecutionError(tt.err),
+            CategoryCommunication: IsCommunicationError(tt.err),
+        }
+        for category, got := range checks {
+            if got != (category == tt.category) {
+                t.Fatalf("%v: Is%s helper = %v", tt.err, category, got)
+            }
+        }
+        if pe, ok := AsProtocolError(tt.err); ok && pe.Category() != tt.category {
+            t.Fatalf("%v: Category() = %v", tt.err, pe.Category())
+        }
+    }
+
+    for code, want := range map[int]ErrorCategory{
+        999: CategoryUnknown, 1000: CategoryProtocol, 1099: CategoryProtocol, 1100: CategoryAuth,
+        1299: CategoryExecution, 1300: CategoryCommunication, 1399: CategoryCommunication, 1400: CategoryUnknown,
+    } {
+        if got := CategoryOf(code); got != want {
+            t.Fatalf("CategoryOf(%d) = %v, want %v", code, got, want)
+        }
+    }
+}
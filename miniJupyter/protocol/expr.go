@@ -0,0 +1,197 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// 过滤表达式（MessageFilter）和执行条件（Condition）共用的词法分析与 || / && 解析，
+// 两者只在词的字符集、是否有 : 和比较运算符、以及操作数的语法上不同
+
+// exprSyntax 一种表达式语言的词法差异和错误格式
+type exprSyntax struct {
+    name     string         // 错误信息前缀
+    err      *ProtocolError // 语法错误的类型
+    wordByte func(c byte) bool
+    colon    bool // 识别 :
+    compare  bool // 识别 == != < <= > >=
+}
+
+func (s *exprSyntax) errorf(format string, args ...interface{}) error {
+    return s.err.WithDetails(s.name + ": " + fmt.Sprintf(format, args...))
+}
+
+type exprTokenKind int
+
+const (
+    exprEOF exprTokenKind = iota
+    exprWord
+    exprString
+    exprColon
+    exprNot
+    exprAnd
+    exprOr
+    exprCompare
+    exprLParen
+    exprRParen
+)
+
+type exprToken struct {
+    kind exprTokenKind
+    text string
+    pos  int
+}
+
+// lexExpr 将表达式切分为记号
+func lexExpr(syntax *exprSyntax, expr string) ([]exprToken, error) {
+    var tokens []exprToken
+    for i := 0; i < len(expr); {
+        c := expr[i]
+        switch {
+        case c == ' ' || c == '\t' || c == '\n' || c == '\r':
+            i++
+        case c == '(':
+            tokens = append(tokens, exprToken{exprLParen, "(", i})
+            i++
+        case c == ')':
+            tokens = append(tokens, exprToken{exprRParen, ")", i})
+            i++
+        case syntax.colon && c == ':':
+            tokens = append(tokens, exprToken{exprColon, ":", i})
+            i++
+        case strings.HasPrefix(expr[i:], "&&"):
+            tokens = append(tokens, exprToken{exprAnd, "&&", i})
+            i += 2
+        case strings.HasPrefix(expr[i:], "||"):
+            tokens = append(tokens, exprToken{exprOr, "||", i})
+            i += 2
+        case syntax.compare && (strings.HasPrefix(expr[i:], "==") || strings.HasPrefix(expr[i:], "!=") ||
+            strings.HasPrefix(expr[i:], "<=") || strings.HasPrefix(expr[i:], ">=")):
+            tokens = append(tokens, exprToken{exprCompare, expr[i : i+2], i})
+            i += 2
+        case syntax.compare && (c == '<' || c == '>'):
+            tokens = append(tokens, exprToken{exprCompare, expr[i : i+1], i})
+            i++
+        case c == '!':
+            tokens = append(tokens, exprToken{exprNot, "!", i})
+            i++
+        case c == '"':
+            end := i + 1
+            for end < len(expr) && expr[end] != '"' {
+                if expr[end] == '\\' {
+                    end++
+                }
+                end++
+            }
+            if end >= len(expr) {
+                return nil, syntax.errorf("unterminated string at %d", i)
+            }
+            text, err := strconv.Unquote(expr[i : end+1])
+            if err != nil {
+                return nil, syntax.errorf("invalid string at %d", i)
+            }
+            tokens = append(tokens, exprToken{exprString, text, i})
+            i = end + 1
+        case syntax.wordByte(c):
+            start := i
+            for i < len(expr) && syntax.wordByte(expr[i]) {
+                i++
+            }
+            tokens = append(tokens, exprToken{exprWord, expr[start:i], start})
+        default:
+            return nil, syntax.errorf("unexpected character %q at %d", c, i)
+        }
+    }
+    return append(tokens, exprToken{exprEOF, "", len(expr)}), nil
+}
+
+// exprParser 递归下降解析的公共部分，T 为生成的求值闭包。
+// 使用方提供 && 的操作数（unary）的解析以及 || / && 的组合方式
+type exprParser[T any] struct {
+    syntax *exprSyntax
+    expr   string
+    tokens []exprToken
+    pos    int
+
+    unary func() (T, error)
+    or    func(left, right T) T
+    and   func(left, right T) T
+}
+
+func (p *exprParser[T]) peek() exprToken { return p.tokens[p.pos] }
+
+func (p *exprParser[T]) next() exprToken {
+    tok := p.tokens[p.pos]
+    if tok.kind != exprEOF {
+        p.pos++
+    }
+    return tok
+}
+
+func (p *exprParser[T]) errorf(tok exprToken, format string, args ...interface{}) error {
+    return p.syntax.errorf("%s at %d in %q", fmt.Sprintf(format, args...), tok.pos, p.expr)
+}
+
+// parse 对 expr 分词并解析完整的表达式
+func (p *exprParser[T]) parse(expr string) (T, error) {
+    var zero T
+    tokens, err := lexExpr(p.syntax, expr)
+    if err != nil {
+        return zero, err
+    }
+    p.expr, p.tokens, p.pos = expr, tokens, 0
+    eval, err := p.parseOr()
+    if err != nil {
+        return zero, err
+    }
+    if tok := p.peek(); tok.kind != exprEOF {
+        return zero, p.errorf(tok, "unexpected %q", tok.text)
+    }
+    return eval, nil
+}
+
+func (p *exprParser[T]) parseOr() (T, error) {
+    left, err := p.parseAnd()
+    if err != nil {
+        return left, err
+    }
+    for p.peek().kind == exprOr {
+        p.next()
+        right, err := p.parseAnd()
+        if err != nil {
+            return right, err
+        }
+        left = p.or(left, right)
+    }
+    return left, nil
+}
+
+func (p *exprParser[T]) parseAnd() (T, error) {
+    left, err := p.unary()
+    if err != nil {
+        return left, err
+    }
+    for p.peek().kind == exprAnd {
+        p.next()
+        right, err := p.unary()
+        if err != nil {
+            return right, err
+        }
+        left = p.and(left, right)
+    }
+    return left, nil
+}
+
+// parseGroup 解析 "(" 之后的子表达式和右括号
+func (p *exprParser[T]) parseGroup() (T, error) {
+    inner, err := p.parseOr()
+    if err != nil {
+        return inner, err
+    }
+    if closing := p.next(); closing.kind != exprRParen {
+        var zero T
+        return zero, p.errorf(closing, "expected ')'")
+    }
+    return inner, nil
+}
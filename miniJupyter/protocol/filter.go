@@ -0,0 +1,222 @@
+package protocol
+
+import "strings"
+
+// MessageFilter 编译后的消息过滤表达式，可被订阅者和路由并发复用
+//
+// 语法：
+//
+//  expr      = or
+//  or        = and { "||" and }
+//  and       = unary { "&&" unary }
+//  unary     = "!" unary | "(" expr ")" | predicate
+//  predicate = field ":" value
+//
+// field 可以是 tag（任意一个 Meta.Tags 匹配）、priority（未设置视为 NORMAL，不区分大小写）、
+// msg_type、user、session；value 为不含空白和运算符的词或双引号字符串，支持 * 通配。
+// 例如 `tag:gpu && !tag:debug`、`msg_type:comm_* || (priority:high && user:"alice")`
+type MessageFilter struct {
+    expr string
+    eval func(msg *Message) bool
+}
+
+// filterFields 支持的字段
+var filterFields = map[string]func(msg *Message, m valueMatcher) bool{
+    "tag": func(msg *Message, m valueMatcher) bool {
+        for _, tag := range msg.Meta.Tags {
+            if m.match(tag) {
+                return true
+            }
+        }
+        return false
+    },
+    "priority": func(msg *Message, m valueMatcher) bool {
+        return m.match(string(queuePriority(msg.Meta.Priority)))
+    },
+    "msg_type": func(msg *Message, m valueMatcher) bool { return m.match(msg.Header.MsgType) },
+    "user":     func(msg *Message, m valueMatcher) bool { return m.match(msg.Header.UserId) },
+    "session":  func(msg *Message, m valueMatcher) bool { return m.match(msg.Header.SessionId) },
+}
+
+// CompileFilter 编译过滤表达式，语法错误返回 ErrInvalidFormat
+func CompileFilter(expr string) (*MessageFilter, error) {
+    eval, err := newFilterParser().parse(expr)
+    if err != nil {
+        return nil, err
+    }
+    return &MessageFilter{expr: expr, eval: eval}, nil
+}
+
+// MustCompileFilter 编译过滤表达式，失败时 panic，用于包级变量初始化
+func MustCompileFilter(expr string) *MessageFilter {
+    f, err := CompileFilter(expr)
+    if err != nil {
+        panic(err)
+    }
+    return f
+}
+
+// Match 判断消息是否满足过滤条件
+func (f *MessageFilter) Match(msg *Message) bool {
+    return f.eval(msg)
+}
+
+// String 返回原始表达式
+func (f *MessageFilter) String() string {
+    return f.expr
+}
+
+// FilterRouter 按添加顺序匹配过滤表达式，将消息交给第一个匹配的处理函数
+type FilterRouter struct {
+    routes   []filterRoute
+    fallback func(msg *Message)
+}
+
+type filterRoute struct {
+    filter  *MessageFilter
+    handler func(msg *Message)
+}
+
+// NewFilterRouter 创建按过滤表达式路由的路由器
+func NewFilterRouter() *FilterRouter {
+    return &FilterRouter{}
+}
+
+// Handle 添加路由，表达式在此时编译
+func (r *FilterRouter) Handle(expr string, handler func(msg *Message)) error {
+    f, err := CompileFilter(expr)
+    if err != nil {
+        return err
+    }
+    r.routes = append(r.routes, filterRoute{filter: f, handler: handler})
+    return nil
+}
+
+// WithFallback 设置没有路由匹配时的处理函数
+func (r *FilterRouter) WithFallback(handler func(msg *Message)) *FilterRouter {
+    r.fallback = handler
+    return r
+}
+
+// Route 分发消息，返回是否有路由（或 fallback）处理了该消息
+func (r *FilterRouter) Route(msg *Message) bool {
+    for _, route := range r.routes {
+        if route.filter.Match(msg) {
+            route.handler(msg)
+            return true
+        }
+    }
+    if r.fallback != nil {
+        r.fallback(msg)
+        return true
+    }
+    return false
+}
+
+///////////////////////////////////////////////////////////////////////////////////////
+
+// valueMatcher 预处理后的值，不含 * 时直接比较
+type valueMatcher struct {
+    value string
+    parts []string // 按 * 切分，仅在含通配符时使用
+    glob  bool
+    fold  bool // 不区分大小写
+}
+
+func newValueMatcher(value string, fold bool) valueMatcher {
+    if fold {
+        value = strings.ToUpper(value)
+    }
+    m := valueMatcher{value: value, fold: fold}
+    if strings.Contains(value, "*") {
+        m.glob = true
+        m.parts = strings.Split(value, "*")
+    }
+    return m
+}
+
+func (m valueMatcher) match(s string) bool {
+    if m.fold {
+        s = strings.ToUpper(s)
+    }
+    if !m.glob {
+        return s == m.value
+    }
+    // 首尾片段固定，中间片段依次贪心查找
+    first, last := m.parts[0], m.parts[len(m.parts)-1]
+    if !strings.HasPrefix(s, first) {
+        return false
+    }
+    s = s[len(first):]
+    for _, part := range m.parts[1 : len(m.parts)-1] {
+        i := strings.Index(s, part)
+        if i < 0 {
+            return false
+        }
+        s = s[i+len(part):]
+    }
+    return strings.HasSuffix(s, last)
+}
+
+// filterSyntax 过滤表达式的词法：field:value，value 中允许 * 通配
+var filterSyntax = &exprSyntax{
+    name:     "filter",
+    err:      ErrInvalidFormat,
+    wordByte: isFilterWordByte,
+    colon:    true,
+}
+
+func isFilterWordByte(c byte) bool {
+    return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' ||
+        strings.IndexByte("_-.*/@+", c) >= 0
+}
+
+// filterParser 递归下降解析，直接生成求值闭包
+type filterParser struct {
+    exprParser[func(*Message) bool]
+}
+
+func newFilterParser() *filterParser {
+    p := &filterParser{}
+    p.syntax = filterSyntax
+    p.unary = p.parseUnary
+    p.or = func(l, r func(*Message) bool) func(*Message) bool {
+        return func(msg *Message) bool { return l(msg) || r(msg) }
+    }
+    p.and = func(l, r func(*Message) bool) func(*Message) bool {
+        return func(msg *Message) bool { return l(msg) && r(msg) }
+    }
+    return p
+}
+
+func (p *filterParser) parseUnary() (func(*Message) bool, error) {
+    tok := p.next()
+    switch tok.kind {
+    case exprNot:
+        inner, err := p.parseUnary()
+        if err != nil {
+            return nil, err
+        }
+        return func(msg *Message) bool { return !inner(msg) }, nil
+    case exprLParen:
+        return p.parseGroup()
+    case exprWord:
+        field, ok := filterFields[tok.text]
+        if !ok {
+            return nil, p.errorf(tok, "unknown field %q", tok.text)
+        }
+        if colon := p.next(); colon.kind != exprColon {
+            return nil, p.errorf(colon, "expected ':' after %s", tok.text)
+        }
+        value := p.next()
+        if value.kind != exprWord && value.kind != exprString {
+            return nil, p.errorf(value, "expected value for %s", tok.text)
+        }
+        m := newValueMatcher(value.text, tok.text == "priority")
+        return func(msg *Message) bool { return field(msg, m) }, nil
+    case exprEOF:
+        return nil, p.errorf(tok, "unexpected end of expression")
+    default:
+        return nil, p.errorf(tok, "unexpected %q", tok.text)
+    }
+}
@@ -0,0 +1,82 @@
+package protocol
+
+import (
+	"errors"
+	"testing"
+)
+
+func newTestFilterMessage(t *testing.T) *Message {
+    t.Helper()
+    msg, err := NewMessageBuilder().
+        WithType(MsgTypeExecuteRequest).
+        WithSession("s1").
+        WithUser("alice").
+        WithTransport(TransportZMQ).
+        WithPriority(PriorityHigh).
+        WithTags([]string{"gpu", "batch"}).
+        WithContent(&ExecuteRequestContent{CommandId: "c", Service: "svc", Method: "run"}).
+        Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return msg
+}
+
+func TestCompileFilter(t *testing.T) {
+    msg := newTestFilterMessage(t)
+    for expr, want := range map[string]bool{
+        `tag:gpu && !tag:debug`:                               true,
+        `msg_type:execute_* || (priority:low && user:"bob")`: true,
+        `priority:high && session:s*`:                         true,
+        `!(tag:gpu || tag:cpu)`:                               false,
+        `user:"al ice" || tag:*atc*`:                          true,
+        `tag:g*u*`:                                            true,
+        `msg_type:*_reply`:                                    false,
+    } {
+        f, err := CompileFilter(expr)
+        if err != nil {
+            t.Fatalf("%s: %v", expr, err)
+        }
+        if got := f.Match(msg); got != want {
+            t.Errorf("%s: got %v, want %v", expr, got, want)
+        }
+    }
+
+    // 未设置 priority 视为 NORMAL
+    msg.Meta.Priority = ""
+    if !MustCompileFilter("priority:NORMAL").Match(msg) {
+        t.Error("empty priority should match NORMAL")
+    }
+
+    for _, expr := range []string{"", "tag", "tag:", "nope:x", "(tag:a", "tag:a)", `tag:"a`, "tag:a == b", "tag:a &&", "!"} {
+        if _, err := CompileFilter(expr); !errors.Is(err, ErrInvalidFormat) {
+            t.Errorf("%q: expected ErrInvalidFormat, got %v", expr, err)
+        }
+    }
+}
+
+func TestFilterRouter(t *testing.T) {
+    var routed []string
+    r := NewFilterRouter().WithFallback(func(*Message) { routed = append(routed, "fallback") })
+    if err := r.Handle("tag:cpu", func(*Message) { routed = append(routed, "cpu") }); err != nil {
+        t.Fatal(err)
+    }
+    if err := r.Handle("tag:gpu", func(*Message) { routed = append(routed, "gpu") }); err != nil {
+        t.Fatal(err)
+    }
+    if err := r.Handle("priority:high", func(*Message) { routed = append(routed, "high") }); err != nil {
+        t.Fatal(err)
+    }
+    if err := r.Handle("tag:(", nil); err == nil {
+        t.Fatal("invalid expression accepted")
+    }
+
+    msg := newTestFilterMessage(t)
+    r.Route(msg)
+    msg.Meta.Tags = nil
+    msg.Meta.Priority = PriorityLow
+    r.Route(msg)
+    if len(routed) != 2 || routed[0] != "gpu" || routed[1] != "fallback" {
+        t.Fatalf("unexpected routing: %v", routed)
+    }
+}
@@ -0,0 +1,250 @@
+package protocol
+
+import (
+	"encoding/json"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// JSON Patch（RFC 6902）操作
+const (
+    PatchAdd     = "add"
+    PatchRemove  = "remove"
+    PatchReplace = "replace"
+    PatchMove    = "move"
+    PatchCopy    = "copy"
+    PatchTest    = "test"
+)
+
+// PatchOp 一个 JSON Patch 操作，path / from 为 JSON Pointer（RFC 6901）
+type PatchOp struct {
+    Op    string      `json:"op"`
+    Path  string      `json:"path"`
+    From  string      `json:"from,omitempty"`
+    Value interface{} `json:"value"`
+}
+
+// ApplyPatch 对 JSON 文档（由 map[string]interface{}、[]interface{} 和基本类型组成）依次应用操作，
+// 返回新文档，doc 本身不被修改；任一操作失败时整体失败
+func ApplyPatch(doc interface{}, ops []PatchOp) (interface{}, error) {
+    doc, err := cloneJSON(doc)
+    if err != nil {
+        return nil, err
+    }
+    for i, op := range ops {
+        if doc, err = applyPatchOp(doc, op); err != nil {
+            return nil, ErrValidationFailed.WithDetails("patch op " + strconv.Itoa(i) + ": " + err.Error())
+        }
+    }
+    return doc, nil
+}
+
+func applyPatchOp(doc interface{}, op PatchOp) (interface{}, error) {
+    switch op.Op {
+    case PatchAdd:
+        value, err := cloneJSON(op.Value)
+        if err != nil {
+            return nil, err
+        }
+        return pointerSet(doc, op.Path, value, true)
+    case PatchRemove:
+        doc, _, err := pointerRemove(doc, op.Path)
+        return doc, err
+    case PatchReplace:
+        if _, err := pointerGet(doc, op.Path); err != nil {
+            return nil, err
+        }
+        value, err := cloneJSON(op.Value)
+        if err != nil {
+            return nil, err
+        }
+        return pointerSet(doc, op.Path, value, false)
+    case PatchMove:
+        if op.Path != op.From && strings.HasPrefix(op.Path, op.From+"/") {
+            return nil, patchError("cannot move a value into itself: " + op.From)
+        }
+        doc, value, err := pointerRemove(doc, op.From)
+        if err != nil {
+            return nil, err
+        }
+        return pointerSet(doc, op.Path, value, true)
+    case PatchCopy:
+        value, err := pointerGet(doc, op.From)
+        if err != nil {
+            return nil, err
+        }
+        if value, err = cloneJSON(value); err != nil {
+            return nil, err
+        }
+        return pointerSet(doc, op.Path, value, true)
+    case PatchTest:
+        value, err := pointerGet(doc, op.Path)
+        if err != nil {
+            return nil, err
+        }
+        expected, err := cloneJSON(op.Value)
+        if err != nil {
+            return nil, err
+        }
+        if !reflect.DeepEqual(value, expected) {
+            return nil, patchError("test failed at " + op.Path)
+        }
+        return doc, nil
+    default:
+        return nil, patchError("unsupported op: " + op.Op)
+    }
+}
+
+type patchError string
+
+func (e patchError) Error() string { return string(e) }
+
+// parsePointer 将 JSON Pointer 拆分为各级引用
+func parsePointer(path string) ([]string, error) {
+    if path == "" {
+        return nil, nil
+    }
+    if path[0] != '/' {
+        return nil, patchError("invalid JSON pointer: " + path)
+    }
+    tokens := strings.Split(path[1:], "/")
+    for i, t := range tokens {
+        tokens[i] = strings.ReplaceAll(strings.ReplaceAll(t, "~1", "/"), "~0", "~")
+    }
+    return tokens, nil
+}
+
+// pointerGet 读取 path 处的值
+func pointerGet(doc interface{}, path string) (interface{}, error) {
+    tokens, err := parsePointer(path)
+    if err != nil {
+        return nil, err
+    }
+    cur := doc
+    for _, t := range tokens {
+        switch node := cur.(type) {
+        case map[string]interface{}:
+            v, ok := node[t]
+            if !ok {
+                return nil, patchError("path not found: " + path)
+            }
+            cur = v
+        case []interface{}:
+            i, err := arrayIndex(t, len(node), false)
+            if err != nil {
+                return nil, err
+            }
+            cur = node[i]
+        default:
+            return nil, patchError("path not found: " + path)
+        }
+    }
+    return cur, nil
+}
+
+// pointerSet 在 path 处写入 value，insert 为 true 时按 add 语义插入数组元素，否则替换
+func pointerSet(doc interface{}, path string, value interface{}, insert bool) (interface{}, error) {
+    tokens, err := parsePointer(path)
+    if err != nil {
+        return nil, err
+    }
+    if len(tokens) == 0 {
+        return value, nil
+    }
+    parentPath := path[:strings.LastIndex(path, "/")]
+    parent, err := pointerGet(doc, parentPath)
+    if err != nil {
+        return nil, err
+    }
+    last := tokens[len(tokens)-1]
+    switch node := parent.(type) {
+    case map[string]interface{}:
+        node[last] = value
+        return doc, nil
+    case []interface{}:
+        i, err := arrayIndex(last, len(node), insert)
+        if err != nil {
+            return nil, err
+        }
+        if !insert {
+            node[i] = value
+            return doc, nil
+        }
+        node = append(node, nil)
+        copy(node[i+1:], node[i:])
+        node[i] = value
+        // 切片可能重新分配，需写回父节点
+        return pointerSet(doc, parentPath, node, false)
+    default:
+        return nil, patchError("parent is not a container: " + path)
+    }
+}
+
+// pointerRemove 删除 path 处的值并返回被删除的值
+func pointerRemove(doc interface{}, path string) (interface{}, interface{}, error) {
+    tokens, err := parsePointer(path)
+    if err != nil {
+        return nil, nil, err
+    }
+    if len(tokens) == 0 {
+        return nil, nil, patchError("cannot remove the whole document")
+    }
+    parentPath := path[:strings.LastIndex(path, "/")]
+    parent, err := pointerGet(doc, parentPath)
+    if err != nil {
+        return nil, nil, err
+    }
+    last := tokens[len(tokens)-1]
+    switch node := parent.(type) {
+    case map[string]interface{}:
+        value, ok := node[last]
+        if !ok {
+            return nil, nil, patchError("path not found: " + path)
+        }
+        delete(node, last)
+        return doc, value, nil
+    case []interface{}:
+        i, err := arrayIndex(last, len(node), false)
+        if err != nil {
+            return nil, nil, err
+        }
+        value := node[i]
+        node = append(node[:i:i], node[i+1:]...)
+        doc, err = pointerSet(doc, parentPath, node, false)
+        return doc, value, err
+    default:
+        return nil, nil, patchError("path not found: " + path)
+    }
+}
+
+// arrayIndex 解析数组下标，insert 时允许 "-" 和等于长度的下标（追加）
+func arrayIndex(token string, length int, insert bool) (int, error) {
+    if insert && token == "-" {
+        return length, nil
+    }
+    i, err := strconv.Atoi(token)
+    if err != nil || i < 0 || (token != "0" && token[0] == '0') {
+        return 0, patchError("invalid array index: " + token)
+    }
+    if i > length || (!insert && i == length) {
+        return 0, patchError("array index out of range: " + token)
+    }
+    return i, nil
+}
+
+// cloneJSON 通过 JSON 往返深拷贝，同时将任意值规范化为 JSON 基本类型
+func cloneJSON(v interface{}) (interface{}, error) {
+    if v == nil {
+        return nil, nil
+    }
+    data, err := json.Marshal(v)
+    if err != nil {
+        return nil, err
+    }
+    var out interface{}
+    if err := json.Unmarshal(data, &out); err != nil {
+        return nil, err
+    }
+    return out, nil
+}
@@ -0,0 +1,113 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func mustParseJSON(t *testing.T, s string) interface{} {
+    t.Helper()
+    var v interface{}
+    if err := json.Unmarshal([]byte(s), &v); err != nil {
+        t.Fatalf("%s: %v", s, err)
+    }
+    return v
+}
+
+func TestApplyPatch(t *testing.T) {
+    tests := []struct {
+        name string
+        doc  string
+        ops  []PatchOp
+        want string // 为空表示应失败
+    }{
+        {"add member", `{"a": 1}`, []PatchOp{{Op: PatchAdd, Path: "/b", Value: 2}}, `{"a": 1, "b": 2}`},
+        {"add replaces member", `{"a": 1}`, []PatchOp{{Op: PatchAdd, Path: "/a", Value: []int{1}}}, `{"a": [1]}`},
+        {"add nested", `{"a": {"b": {}}}`, []PatchOp{{Op: PatchAdd, Path: "/a/b/c", Value: "x"}}, `{"a": {"b": {"c": "x"}}}`},
+        {"add inserts into array", `{"a": [1, 3]}`, []PatchOp{{Op: PatchAdd, Path: "/a/1", Value: 2}}, `{"a": [1, 2, 3]}`},
+        {"add at array length", `{"a": [1]}`, []PatchOp{{Op: PatchAdd, Path: "/a/1", Value: 2}}, `{"a": [1, 2]}`},
+        {"add dash appends", `{"a": [1]}`, []PatchOp{{Op: PatchAdd, Path: "/a/-", Value: 2}}, `{"a": [1, 2]}`},
+        {"add to top-level array", `[1]`, []PatchOp{{Op: PatchAdd, Path: "/0", Value: 0}}, `[0, 1]`},
+        {"add whole document", `{"a": 1}`, []PatchOp{{Op: PatchAdd, Path: "", Value: map[string]int{"b": 2}}}, `{"b": 2}`},
+        {"add past array end", `{"a": [1]}`, []PatchOp{{Op: PatchAdd, Path: "/a/2", Value: 2}}, ``},
+        {"add missing parent", `{}`, []PatchOp{{Op: PatchAdd, Path: "/a/b", Value: 1}}, ``},
+        {"add into scalar", `{"a": 1}`, []PatchOp{{Op: PatchAdd, Path: "/a/b", Value: 1}}, ``},
+
+        {"remove member", `{"a": 1, "b": 2}`, []PatchOp{{Op: PatchRemove, Path: "/a"}}, `{"b": 2}`},
+        {"remove array element", `{"a": [1, 2, 3]}`, []PatchOp{{Op: PatchRemove, Path: "/a/1"}}, `{"a": [1, 3]}`},
+        {"remove missing member", `{"a": 1}`, []PatchOp{{Op: PatchRemove, Path: "/b"}}, ``},
+        {"remove dash", `{"a": [1]}`, []PatchOp{{Op: PatchRemove, Path: "/a/-"}}, ``},
+        {"remove past array end", `{"a": [1]}`, []PatchOp{{Op: PatchRemove, Path: "/a/1"}}, ``},
+        {"remove whole document", `{"a": 1}`, []PatchOp{{Op: PatchRemove, Path: ""}}, ``},
+
+        {"replace member", `{"a": 1}`, []PatchOp{{Op: PatchReplace, Path: "/a", Value: nil}}, `{"a": null}`},
+        {"replace array element", `{"a": [1, 2]}`, []PatchOp{{Op: PatchReplace, Path: "/a/0", Value: 9}}, `{"a": [9, 2]}`},
+        {"replace whole document", `{"a": 1}`, []PatchOp{{Op: PatchReplace, Path: "", Value: []int{1}}}, `[1]`},
+        {"replace missing member", `{"a": 1}`, []PatchOp{{Op: PatchReplace, Path: "/b", Value: 2}}, ``},
+
+        {"move member", `{"a": {"b": 1}, "c": {}}`, []PatchOp{{Op: PatchMove, From: "/a/b", Path: "/c/d"}}, `{"a": {}, "c": {"d": 1}}`},
+        {"move within array", `{"a": [1, 2, 3]}`, []PatchOp{{Op: PatchMove, From: "/a/0", Path: "/a/-"}}, `{"a": [2, 3, 1]}`},
+        {"move to same path", `{"a": 1}`, []PatchOp{{Op: PatchMove, From: "/a", Path: "/a"}}, `{"a": 1}`},
+        {"move into itself", `{"a": {"b": {}}}`, []PatchOp{{Op: PatchMove, From: "/a", Path: "/a/b/c"}}, ``},
+        {"move missing", `{"a": 1}`, []PatchOp{{Op: PatchMove, From: "/b", Path: "/c"}}, ``},
+
+        {"copy member", `{"a": {"b": [1]}}`, []PatchOp{{Op: PatchCopy, From: "/a", Path: "/c"}}, `{"a": {"b": [1]}, "c": {"b": [1]}}`},
+        {"copy into array", `{"a": [1, 2]}`, []PatchOp{{Op: PatchCopy, From: "/a/1", Path: "/a/0"}}, `{"a": [2, 1, 2]}`},
+        {"copy missing", `{"a": 1}`, []PatchOp{{Op: PatchCopy, From: "/b", Path: "/c"}}, ``},
+
+        {"test equal", `{"a": {"b": [1, "x"]}}`, []PatchOp{{Op: PatchTest, Path: "/a", Value: map[string]interface{}{"b": []interface{}{1, "x"}}}}, `{"a": {"b": [1, "x"]}}`},
+        {"test not equal", `{"a": 1}`, []PatchOp{{Op: PatchTest, Path: "/a", Value: 2}}, ``},
+        {"test missing", `{"a": 1}`, []PatchOp{{Op: PatchTest, Path: "/b", Value: nil}}, ``},
+        {"test guards later ops", `{"a": 1}`, []PatchOp{{Op: PatchTest, Path: "/a", Value: 2}, {Op: PatchRemove, Path: "/a"}}, ``},
+
+        // RFC 6901：~1 表示 /，~0 表示 ~，~01 解码为 ~1 而不是 /
+        {"escaped slash", `{"a/b": 1}`, []PatchOp{{Op: PatchReplace, Path: "/a~1b", Value: 2}}, `{"a/b": 2}`},
+        {"escaped tilde", `{}`, []PatchOp{{Op: PatchAdd, Path: "/m~0n", Value: 1}}, `{"m~n": 1}`},
+        {"escape order", `{"~1": 1}`, []PatchOp{{Op: PatchRemove, Path: "/~01"}}, `{}`},
+        {"empty key", `{"": 1}`, []PatchOp{{Op: PatchReplace, Path: "/", Value: 2}}, `{"": 2}`},
+
+        {"pointer without slash", `{"a": 1}`, []PatchOp{{Op: PatchRemove, Path: "a"}}, ``},
+        {"index with leading zero", `{"a": [1, 2]}`, []PatchOp{{Op: PatchRemove, Path: "/a/01"}}, ``},
+        {"negative index", `{"a": [1, 2]}`, []PatchOp{{Op: PatchRemove, Path: "/a/-1"}}, ``},
+        {"unsupported op", `{}`, []PatchOp{{Op: "merge", Path: "/a"}}, ``},
+    }
+    for _, tt := range tests {
+        doc := mustParseJSON(t, tt.doc)
+        got, err := ApplyPatch(doc, tt.ops)
+        if tt.want == "" {
+            if !errors.Is(err, ErrValidationFailed) {
+                t.Errorf("%s: expected ErrValidationFailed, got %v (%v)", tt.name, err, got)
+            }
+        } else if err != nil {
+            t.Errorf("%s: %v", tt.name, err)
+        } else if want := mustParseJSON(t, tt.want); !reflect.DeepEqual(got, want) {
+            t.Errorf("%s: got %v, want %v", tt.name, got, want)
+        }
+
+        // 无论成功与否，原文档都不被修改
+        if !reflect.DeepEqual(doc, mustParseJSON(t, tt.doc)) {
+            t.Errorf("%s: input document modified: %v", tt.name, doc)
+        }
+    }
+}
+
+func TestApplyPatchDeepCopiesValues(t *testing.T) {
+    value := map[string]interface{}{"list": []interface{}{1}}
+    got, err := ApplyPatch(map[string]interface{}{}, []PatchOp{
+        {Op: PatchAdd, Path: "/a", Value: value},
+        {Op: PatchCopy, From: "/a", Path: "/b"},
+        {Op: PatchAdd, Path: "/b/list/-", Value: 2},
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := mustParseJSON(t, `{"a": {"list": [1]}, "b": {"list": [1, 2]}}`)
+    if !reflect.DeepEqual(got, want) {
+        t.Fatalf("got %v, want %v", got, want)
+    }
+    if len(value["list"].([]interface{})) != 1 {
+        t.Fatal("op value modified")
+    }
+}
@@ -0,0 +1,160 @@
+package protocol
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// JWT 签名算法
+const (
+    JWTAlgHS256 = "HS256"
+    JWTAlgRS256 = "RS256"
+)
+
+// TokenClaims security.token 中的 JWT 声明
+type TokenClaims struct {
+    Subject   string                 `json:"sub"`           // 用户ID，需与 header.user_id 一致
+    Issuer    string                 `json:"iss,omitempty"` // 签发者
+    ExpiresAt float64                `json:"exp,omitempty"` // 过期时间（Unix 秒）
+    NotBefore float64                `json:"nbf,omitempty"` // 生效时间（Unix 秒）
+    IssuedAt  float64                `json:"iat,omitempty"` // 签发时间（Unix 秒）
+    Extra     map[string]interface{} `json:"-"`             // 全部声明，便于读取自定义字段
+}
+
+// TokenVerifier 校验 security.token 中的 JWT，仅依赖标准库
+type TokenVerifier struct {
+    hmacKey []byte
+    rsaKey  *rsa.PublicKey
+    leeway  time.Duration // 允许的时钟偏差
+    now     func() time.Time
+
+    optionalExpiry bool // 为 true 时接受不带 exp 的令牌
+}
+
+// NewTokenVerifier 创建 JWT 校验器，需通过 WithHMACKey / WithRSAKey 至少配置一种算法
+func NewTokenVerifier() *TokenVerifier {
+    return &TokenVerifier{now: time.Now}
+}
+
+// WithHMACKey 启用 HS256，使用共享密钥
+func (v *TokenVerifier) WithHMACKey(key []byte) *TokenVerifier {
+    v.hmacKey = append([]byte(nil), key...)
+    return v
+}
+
+// WithRSAKey 启用 RS256，使用签发方公钥
+func (v *TokenVerifier) WithRSAKey(key *rsa.PublicKey) *TokenVerifier {
+    v.rsaKey = key
+    return v
+}
+
+// WithLeeway 设置校验 exp / nbf 时允许的时钟偏差
+func (v *TokenVerifier) WithLeeway(leeway time.Duration) *TokenVerifier {
+    v.leeway = leeway
+    return v
+}
+
+// WithOptionalExpiry 接受不带 exp 的令牌。默认拒绝，避免签发时遗漏 exp 的令牌永久有效
+func (v *TokenVerifier) WithOptionalExpiry() *TokenVerifier {
+    v.optionalExpiry = true
+    return v
+}
+
+// Verify 校验 JWT 的签名和有效期，返回声明。除非设置了 WithOptionalExpiry，令牌必须带 exp
+func (v *TokenVerifier) Verify(token string) (*TokenClaims, error) {
+    parts := strings.Split(token, ".")
+    if len(parts) != 3 {
+        return nil, ErrInvalidToken.WithDetails("malformed token")
+    }
+
+    var header struct {
+        Alg string `json:"alg"`
+        Typ string `json:"typ"`
+    }
+    if err := decodeJWTPart(parts[0], &header); err != nil {
+        return nil, ErrInvalidToken.WithDetails("malformed header: " + err.Error())
+    }
+    signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+    if err != nil {
+        return nil, ErrInvalidToken.WithDetails("malformed signature")
+    }
+
+    // 只接受已配置密钥的算法，防止算法混淆攻击
+    signed := []byte(parts[0] + "." + parts[1])
+    switch {
+    case header.Alg == JWTAlgHS256 && v.hmacKey != nil:
+        mac := hmac.New(sha256.New, v.hmacKey)
+        mac.Write(signed)
+        if !hmac.Equal(mac.Sum(nil), signature) {
+            return nil, ErrInvalidToken.WithDetails("signature mismatch")
+        }
+    case header.Alg == JWTAlgRS256 && v.rsaKey != nil:
+        digest := sha256.Sum256(signed)
+        if err := rsa.VerifyPKCS1v15(v.rsaKey, crypto.SHA256, digest[:], signature); err != nil {
+            return nil, ErrInvalidToken.WithDetails("signature mismatch")
+        }
+    default:
+        return nil, ErrInvalidToken.WithDetails("unsupported alg: " + header.Alg)
+    }
+
+    var claims TokenClaims
+    if err := decodeJWTPart(parts[1], &claims); err != nil {
+        return nil, ErrInvalidToken.WithDetails("malformed claims: " + err.Error())
+    }
+    if err := decodeJWTPart(parts[1], &claims.Extra); err != nil {
+        return nil, ErrInvalidToken.WithDetails("malformed claims: " + err.Error())
+    }
+
+    // exp 按是否出现判断而不是按零值判断，"exp": 0 表示 1970 年过期而不是永不过期
+    now := v.now()
+    _, hasExp := claims.Extra["exp"]
+    if !hasExp && !v.optionalExpiry {
+        return nil, ErrInvalidToken.WithDetails("token has no exp claim")
+    }
+    if hasExp && now.After(unixSeconds(claims.ExpiresAt).Add(v.leeway)) {
+        return nil, ErrSessionExpired.WithDetails("token expired")
+    }
+    if claims.NotBefore != 0 && now.Add(v.leeway).Before(unixSeconds(claims.NotBefore)) {
+        return nil, ErrInvalidToken.WithDetails("token not valid yet")
+    }
+    return &claims, nil
+}
+
+// VerifyMessage 校验消息的 security.token，并确认 sub 非空且与 header.user_id 一致，
+// 可作为 MessageCheck 传给 ValidateMessage
+func (v *TokenVerifier) VerifyMessage(msg *Message) error {
+    if msg.Security.Token == "" {
+        return ErrUnauthorized.WithDetails("token is required")
+    }
+    claims, err := v.Verify(msg.Security.Token)
+    if err != nil {
+        return err
+    }
+    if claims.Subject == "" {
+        return ErrUnauthorized.WithDetails("token has no sub claim")
+    }
+    if claims.Subject != msg.Header.UserId {
+        return ErrUnauthorized.WithDetails("token subject does not match user_id")
+    }
+    return nil
+}
+
+// decodeJWTPart 解码 base64url 编码的 JSON 片段
+func decodeJWTPart(part string, v interface{}) error {
+    data, err := base64.RawURLEncoding.DecodeString(part)
+    if err != nil {
+        return err
+    }
+    return json.Unmarshal(data, v)
+}
+
+// unixSeconds 将可能带小数的 Unix 秒转换为时间
+func unixSeconds(sec float64) time.Time {
+    return time.Unix(0, int64(sec*float64(time.Second)))
+}
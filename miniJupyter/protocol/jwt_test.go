@@ -0,0 +1,229 @@
+package protocol
+
+import (
+	"crypto"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+)
+
+var jwtTestNow = time.Unix(1700000000, 0)
+
+// signTestJWT 按 alg 生成测试用 JWT，key 为 []byte（HS256）或 *rsa.PrivateKey（RS256）
+func signTestJWT(t *testing.T, alg string, claims map[string]interface{}, key interface{}) string {
+    t.Helper()
+    header, _ := json.Marshal(map[string]string{"alg": alg, "typ": "JWT"})
+    payload, _ := json.Marshal(claims)
+    signed := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+
+    var signature []byte
+    switch k := key.(type) {
+    case []byte:
+        mac := hmac.New(sha256.New, k)
+        mac.Write([]byte(signed))
+        signature = mac.Sum(nil)
+    case *rsa.PrivateKey:
+        digest := sha256.Sum256([]byte(signed))
+        var err error
+        if signature, err = rsa.SignPKCS1v15(rand.Reader, k, crypto.SHA256, digest[:]); err != nil {
+            t.Fatal(err)
+        }
+    }
+    return signed + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+func newTestVerifier() *TokenVerifier {
+    v := NewTokenVerifier().WithHMACKey([]byte("secret"))
+    v.now = func() time.Time { return jwtTestNow }
+    return v
+}
+
+func validClaims() map[string]interface{} {
+    return map[string]interface{}{
+        "sub":  "alice",
+        "exp":  jwtTestNow.Add(time.Hour).Unix(),
+        "role": "admin",
+    }
+}
+
+func TestTokenVerifierHS256(t *testing.T) {
+    v := newTestVerifier()
+    claims, err := v.Verify(signTestJWT(t, JWTAlgHS256, validClaims(), []byte("secret")))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if claims.Subject != "alice" || claims.Extra["role"] != "admin" {
+        t.Fatalf("unexpected claims: %+v", claims)
+    }
+
+    if _, err := v.Verify(signTestJWT(t, JWTAlgHS256, validClaims(), []byte("wrong"))); GetErrorCode(err) != ErrCodeInvalidToken {
+        t.Fatalf("wrong key accepted: %v", err)
+    }
+}
+
+func TestTokenVerifierTamperedPayload(t *testing.T) {
+    v := newTestVerifier()
+    token := signTestJWT(t, JWTAlgHS256, validClaims(), []byte("secret"))
+    forged := validClaims()
+    forged["sub"] = "mallory"
+    payload, _ := json.Marshal(forged)
+
+    parts := strings.Split(token, ".")
+    tampered := parts[0] + "." + base64.RawURLEncoding.EncodeToString(payload) + "." + parts[2]
+    if _, err := v.Verify(tampered); GetErrorCode(err) != ErrCodeInvalidToken {
+        t.Fatalf("tampered payload accepted: %v", err)
+    }
+}
+
+func TestTokenVerifierRejectsUnconfiguredAlg(t *testing.T) {
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatal(err)
+    }
+
+    // alg none
+    header := base64.RawURLEncoding.EncodeToString([]byte(`{"alg":"none"}`))
+    payload, _ := json.Marshal(validClaims())
+    none := header + "." + base64.RawURLEncoding.EncodeToString(payload) + "."
+    if _, err := newTestVerifier().Verify(none); GetErrorCode(err) != ErrCodeInvalidToken {
+        t.Fatalf("alg none accepted: %v", err)
+    }
+
+    // 只配置 HMAC 时拒绝 RS256
+    rs := signTestJWT(t, JWTAlgRS256, validClaims(), key)
+    if _, err := newTestVerifier().Verify(rs); GetErrorCode(err) != ErrCodeInvalidToken {
+        t.Fatalf("RS256 accepted without RSA key: %v", err)
+    }
+
+    // 算法混淆：只配置 RSA 公钥时，用公钥字节作为 HMAC 密钥签发的 HS256 令牌必须被拒绝
+    rsaOnly := NewTokenVerifier().WithRSAKey(&key.PublicKey)
+    rsaOnly.now = func() time.Time { return jwtTestNow }
+    pub, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+    confused := signTestJWT(t, JWTAlgHS256, validClaims(), pub)
+    if _, err := rsaOnly.Verify(confused); GetErrorCode(err) != ErrCodeInvalidToken {
+        t.Fatalf("HS256 accepted with RSA-only verifier: %v", err)
+    }
+}
+
+func TestTokenVerifierRS256(t *testing.T) {
+    key, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatal(err)
+    }
+    other, err := rsa.GenerateKey(rand.Reader, 2048)
+    if err != nil {
+        t.Fatal(err)
+    }
+    v := NewTokenVerifier().WithRSAKey(&key.PublicKey)
+    v.now = func() time.Time { return jwtTestNow }
+
+    if _, err := v.Verify(signTestJWT(t, JWTAlgRS256, validClaims(), key)); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := v.Verify(signTestJWT(t, JWTAlgRS256, validClaims(), other)); GetErrorCode(err) != ErrCodeInvalidToken {
+        t.Fatalf("token signed by another key accepted: %v", err)
+    }
+}
+
+func TestTokenVerifierTimeClaims(t *testing.T) {
+    v := newTestVerifier()
+
+    expired := validClaims()
+    expired["exp"] = jwtTestNow.Add(-time.Minute).Unix()
+    token := signTestJWT(t, JWTAlgHS256, expired, []byte("secret"))
+    if _, err := v.Verify(token); GetErrorCode(err) != ErrCodeSessionExpired {
+        t.Fatalf("expired token accepted: %v", err)
+    }
+    if _, err := v.WithLeeway(2 * time.Minute).Verify(token); err != nil {
+        t.Fatalf("leeway not applied: %v", err)
+    }
+
+    early := validClaims()
+    early["nbf"] = jwtTestNow.Add(time.Hour).Unix()
+    if _, err := newTestVerifier().Verify(signTestJWT(t, JWTAlgHS256, early, []byte("secret"))); GetErrorCode(err) != ErrCodeInvalidToken {
+        t.Fatalf("token used before nbf accepted: %v", err)
+    }
+
+    // 默认要求 exp，可显式放宽
+    noExp := validClaims()
+    delete(noExp, "exp")
+    token = signTestJWT(t, JWTAlgHS256, noExp, []byte("secret"))
+    if _, err := newTestVerifier().Verify(token); GetErrorCode(err) != ErrCodeInvalidToken {
+        t.Fatalf("token without exp accepted: %v", err)
+    }
+    if _, err := newTestVerifier().WithOptionalExpiry().Verify(token); err != nil {
+        t.Fatalf("optional expiry not applied: %v", err)
+    }
+
+    // "exp": 0 是 1970 年，不表示永不过期
+    zeroExp := validClaims()
+    zeroExp["exp"] = 0
+    token = signTestJWT(t, JWTAlgHS256, zeroExp, []byte("secret"))
+    if _, err := newTestVerifier().Verify(token); GetErrorCode(err) != ErrCodeSessionExpired {
+        t.Fatalf("token with zero exp accepted: %v", err)
+    }
+    if _, err := newTestVerifier().WithOptionalExpiry().Verify(token); GetErrorCode(err) != ErrCodeSessionExpired {
+        t.Fatalf("token with zero exp accepted with optional expiry: %v", err)
+    }
+}
+
+func TestTokenVerifierMalformed(t *testing.T) {
+    v := newTestVerifier()
+    valid := signTestJWT(t, JWTAlgHS256, validClaims(), []byte("secret"))
+    parts := strings.Split(valid, ".")
+    for name, token := range map[string]string{
+        "empty":          "",
+        "two parts":      parts[0] + "." + parts[1],
+        "bad header":     "!!!." + parts[1] + "." + parts[2],
+        "bad signature":  parts[0] + "." + parts[1] + ".***",
+        "non-json claim": parts[0] + "." + base64.RawURLEncoding.EncodeToString([]byte("nope")) + "." + parts[2],
+    } {
+        if _, err := v.Verify(token); GetErrorCode(err) != ErrCodeInvalidToken {
+            t.Errorf("%s: expected ErrInvalidToken, got %v", name, err)
+        }
+    }
+}
+
+func TestTokenVerifierVerifyMessage(t *testing.T) {
+    v := newTestVerifier()
+    build := func(user, token string) *Message {
+        msg, err := NewMessageBuilder().
+            WithType(MsgTypeCoreInfoRequest).
+            WithSession("s").
+            WithUser(user).
+            WithTransport(TransportZMQ).
+            WithToken(token).
+            WithContent(&struct{}{}).
+            Build()
+        if err != nil {
+            t.Fatal(err)
+        }
+        return msg
+    }
+    token := signTestJWT(t, JWTAlgHS256, validClaims(), []byte("secret"))
+    if err := v.VerifyMessage(build("alice", token)); err != nil {
+        t.Fatal(err)
+    }
+    if err := v.VerifyMessage(build("bob", token)); GetErrorCode(err) != ErrCodeUnauthorized {
+        t.Fatalf("subject mismatch accepted: %v", err)
+    }
+    if err := v.VerifyMessage(build("alice", "")); GetErrorCode(err) != ErrCodeUnauthorized {
+        t.Fatalf("missing token accepted: %v", err)
+    }
+
+    // 没有 sub 的令牌不能匹配空的 user_id
+    noSub := validClaims()
+    delete(noSub, "sub")
+    msg := build("alice", signTestJWT(t, JWTAlgHS256, noSub, []byte("secret")))
+    msg.Header.UserId = ""
+    if err := v.VerifyMessage(msg); GetErrorCode(err) != ErrCodeUnauthorized {
+        t.Fatalf("token without sub accepted: %v", err)
+    }
+}
@@ -20,7 +20,9 @@ type Header struct {
     Timestamp   time.Time   `json:"timestamp"`
     MsgType     string      `json:"msg_type"`
     Compression Compression `json:"compression"`
+    CompressAll bool        `json:"compress_all,omitempty"` // 为 true 时除 header 外的帧均被压缩，否则仅压缩 content
     Encoding    Encoding    `json:"encoding"`
+    Codec       string      `json:"codec,omitempty"` // encoding 为 custom 时使用的编解码器名称
     Transport   Transport   `json:"transport"`
     Version     string      `json:"version"`
 }
@@ -75,6 +77,7 @@ type CoreInfoContent struct {
     ActiveConnections int    `json:"active_connections"`
     RunningTasks      int    `json:"running_tasks"`
     TaskQueueSize     int    `json:"task_queue_size"`
+    TaskQueueDepth    map[Priority]int `json:"task_queue_depth,omitempty"` // 各优先级的排队任务数
 }
 
 // Execute Result Content
@@ -101,6 +104,65 @@ type CommMsgContent struct {
     Data   interface{} `json:"data"`
 }
 
+type CommInfoRequestContent struct {
+    TargetName string `json:"target_name,omitempty"` // 只列出该 target 的 comm，为空表示全部
+}
+
+type CommInfoReplyContent struct {
+    Status Status              `json:"status"`
+    Comms  map[string]CommInfo `json:"comms"` // comm_id -> comm 信息
+}
+
+type CommInfo struct {
+    TargetName string `json:"target_name"`
+    SessionId  string `json:"session_id"` // 打开该 comm 的会话
+}
+
+// Error Content，对应 ProtocolError，可作为任意请求或 comm 消息的应答
+type ErrorContent struct {
+    Code    int         `json:"code"`
+    Message string      `json:"message"`
+    Details interface{} `json:"details,omitempty"`
+}
+
+// Version Handshake
+type VersionRequestContent struct {
+    Versions []string `json:"versions"` // 请求方支持的协议版本
+}
+
+type VersionReplyContent struct {
+    Status   Status   `json:"status"`   // ok || error（没有共同版本）
+    Version  string   `json:"version"`  // 协商出的版本
+    Versions []string `json:"versions"` // 应答方支持的协议版本
+}
+
+// Trace Collection
+type TraceReportContent struct {
+    Trace *MessageTrace `json:"trace"` // 已完成的追踪
+}
+
+type TraceStatsRequestContent struct {
+    Services []string `json:"services,omitempty"` // 需要查询的服务名称，为空表示全部
+}
+
+type TraceStatsReplyContent struct {
+    Status   Status         `json:"status"`
+    Traces   int            `json:"traces"`   // 已收集的追踪数
+    Services []ServiceStats `json:"services"` // 按服务名称排序
+}
+
+// ServiceStats 单个服务的节点耗时统计
+type ServiceStats struct {
+    ServiceName string   `json:"service_name"`
+    Count       int      `json:"count"`      // 已完成的节点数
+    Errors      int      `json:"errors"`     // Error 非空的节点数
+    ErrorRate   float64  `json:"error_rate"` // Errors / Count
+    P50         Duration `json:"p50"`
+    P95         Duration `json:"p95"`
+    P99         Duration `json:"p99"`
+    Max         Duration `json:"max"`
+}
+
 ///////////////////////////////////////////////////////////////////////////////////////
 
 // Message 的追踪相关方法
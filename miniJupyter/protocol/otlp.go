@@ -0,0 +1,263 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// DefaultOTLPEndpoint 本地 OpenTelemetry Collector 的 OTLP/HTTP traces 地址
+const DefaultOTLPEndpoint = "http://localhost:4318/v1/traces"
+
+// otlpScopeName 导出的 span 所属的 instrumentation scope
+const otlpScopeName = "miniJupyter/protocol"
+
+// OTLP span kind / status code
+const (
+    otlpSpanKindServer = 2
+    otlpStatusUnset    = 0
+    otlpStatusOK       = 1
+    otlpStatusError    = 2
+)
+
+// OTLPExporter 将完成的追踪以 OTLP/JSON 格式导出：写入文件（每次导出追加一行）或 POST 到 collector
+//
+// 每个 MessageHop 导出为一个 span，按 ServiceName / ServiceId / HostName 分组为 resource；
+// 未采样（trace_flags 未置采样位）的追踪会被跳过
+type OTLPExporter struct {
+    mu       sync.Mutex
+    path     string
+    endpoint string
+    client   *http.Client
+}
+
+// NewOTLPExporter 创建导出器，默认 POST 到 DefaultOTLPEndpoint
+func NewOTLPExporter() *OTLPExporter {
+    return &OTLPExporter{
+        endpoint: DefaultOTLPEndpoint,
+        client:   &http.Client{Timeout: 10 * time.Second},
+    }
+}
+
+// WithFile 改为追加写入文件（OTLP/JSON Lines），设置后不再发送 HTTP 请求
+func (e *OTLPExporter) WithFile(path string) *OTLPExporter {
+    e.path = path
+    return e
+}
+
+// WithEndpoint 设置 collector 的 OTLP/HTTP traces 地址
+func (e *OTLPExporter) WithEndpoint(endpoint string) *OTLPExporter {
+    e.endpoint = endpoint
+    return e
+}
+
+// WithHTTPClient 设置发送请求使用的 HTTP 客户端
+func (e *OTLPExporter) WithHTTPClient(client *http.Client) *OTLPExporter {
+    e.client = client
+    return e
+}
+
+// Export 导出追踪，没有可导出的 span 时不做任何事
+func (e *OTLPExporter) Export(traces ...*MessageTrace) error {
+    req := MarshalOTLP(traces...)
+    if len(req.ResourceSpans) == 0 {
+        return nil
+    }
+    data, err := json.Marshal(req)
+    if err != nil {
+        return ErrSerializeFailed.WithCause(err)
+    }
+
+    if e.path != "" {
+        return e.writeFile(data)
+    }
+    return e.post(data)
+}
+
+func (e *OTLPExporter) writeFile(data []byte) error {
+    e.mu.Lock()
+    defer e.mu.Unlock()
+    f, err := os.OpenFile(e.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+    if err != nil {
+        return ErrPublishFailed.WithCause(err)
+    }
+    defer f.Close()
+    if _, err := f.Write(append(data, '\n')); err != nil {
+        return ErrPublishFailed.WithCause(err)
+    }
+    return nil
+}
+
+func (e *OTLPExporter) post(data []byte) error {
+    resp, err := e.client.Post(e.endpoint, "application/json", bytes.NewReader(data))
+    if err != nil {
+        return ErrConnectionFailed.WithCause(err)
+    }
+    defer resp.Body.Close()
+    io.Copy(io.Discard, resp.Body)
+    if resp.StatusCode/100 != 2 {
+        return ErrPublishFailed.WithDetails(fmt.Sprintf("collector responded %s", resp.Status))
+    }
+    return nil
+}
+
+// OTLPTraceRequest OTLP/JSON ExportTraceServiceRequest
+type OTLPTraceRequest struct {
+    ResourceSpans []OTLPResourceSpans `json:"resourceSpans"`
+}
+
+// OTLPResourceSpans 同一服务实例产生的 span
+type OTLPResourceSpans struct {
+    Resource   OTLPResource     `json:"resource"`
+    ScopeSpans []OTLPScopeSpans `json:"scopeSpans"`
+}
+
+// OTLPResource 服务实例的属性
+type OTLPResource struct {
+    Attributes []OTLPKeyValue `json:"attributes"`
+}
+
+// OTLPScopeSpans 同一 instrumentation scope 下的 span
+type OTLPScopeSpans struct {
+    Scope OTLPScope  `json:"scope"`
+    Spans []OTLPSpan `json:"spans"`
+}
+
+// OTLPScope instrumentation scope
+type OTLPScope struct {
+    Name string `json:"name"`
+}
+
+// OTLPSpan 对应一个 MessageHop，traceId / spanId 为十六进制，时间为 Unix 纳秒字符串
+type OTLPSpan struct {
+    TraceId           string         `json:"traceId"`
+    SpanId            string         `json:"spanId"`
+    ParentSpanId      string         `json:"parentSpanId,omitempty"`
+    TraceState        string         `json:"traceState,omitempty"`
+    Name              string         `json:"name"`
+    Kind              int            `json:"kind"`
+    StartTimeUnixNano string         `json:"startTimeUnixNano"`
+    EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+    Attributes        []OTLPKeyValue `json:"attributes,omitempty"`
+    Status            OTLPStatus     `json:"status"`
+}
+
+// OTLPStatus span 状态
+type OTLPStatus struct {
+    Code    int    `json:"code"`
+    Message string `json:"message,omitempty"`
+}
+
+// OTLPKeyValue 字符串属性
+type OTLPKeyValue struct {
+    Key   string       `json:"key"`
+    Value OTLPAnyValue `json:"value"`
+}
+
+// OTLPAnyValue 属性值，这里只使用字符串
+type OTLPAnyValue struct {
+    StringValue string `json:"stringValue"`
+}
+
+// MarshalOTLP 将追踪转换为 OTLP/JSON 请求，跳过未采样的追踪；
+// 未完成的节点以进入时间作为结束时间，状态为 Unset
+func MarshalOTLP(traces ...*MessageTrace) *OTLPTraceRequest {
+    type resourceKey struct{ service, instance, host string }
+    var order []resourceKey
+    spans := make(map[resourceKey][]OTLPSpan)
+
+    for _, mt := range traces {
+        if mt == nil || !mt.Sampled() {
+            continue
+        }
+        mt.mu.Lock()
+        spanIds, renamed := otlpSpanIds(mt)
+        for i, hop := range mt.Hops {
+            key := resourceKey{hop.ServiceName, hop.ServiceId, hop.HostName}
+            if _, ok := spans[key]; !ok {
+                order = append(order, key)
+            }
+            span := hop.otlpSpan(mt)
+            span.SpanId = spanIds[i]
+            if id, ok := renamed[hop.ParentSpanId]; ok {
+                span.ParentSpanId = id
+            }
+            spans[key] = append(spans[key], span)
+        }
+        mt.mu.Unlock()
+    }
+
+    req := &OTLPTraceRequest{ResourceSpans: make([]OTLPResourceSpans, 0, len(order))}
+    for _, key := range order {
+        req.ResourceSpans = append(req.ResourceSpans, OTLPResourceSpans{
+            Resource: OTLPResource{Attributes: []OTLPKeyValue{
+                otlpString("service.name", key.service),
+                otlpString("service.instance.id", key.instance),
+                otlpString("host.name", key.host),
+            }},
+            ScopeSpans: []OTLPScopeSpans{{
+                Scope: OTLPScope{Name: otlpScopeName},
+                Spans: spans[key],
+            }},
+        })
+    }
+    return req
+}
+
+// otlpSpan 需持有 mt 的锁
+func (h *MessageHop) otlpSpan(mt *MessageTrace) OTLPSpan {
+    span := OTLPSpan{
+        TraceId:           mt.TraceId,
+        SpanId:            h.SpanId,
+        ParentSpanId:      h.ParentSpanId,
+        TraceState:        mt.TraceState,
+        Name:              h.ServiceName,
+        Kind:              otlpSpanKindServer,
+        StartTimeUnixNano: strconv.FormatInt(h.EntryTime.UnixNano(), 10),
+        EndTimeUnixNano:   strconv.FormatInt(h.endTime().UnixNano(), 10),
+        Status:            OTLPStatus{Code: otlpStatusUnset},
+    }
+    if h.Status != "" {
+        span.Attributes = append(span.Attributes, otlpString("minijupyter.status", h.Status))
+    }
+    switch {
+    case h.Error != "":
+        span.Status = OTLPStatus{Code: otlpStatusError, Message: h.Error}
+    case !h.ExitTime.IsZero():
+        span.Status = OTLPStatus{Code: otlpStatusOK}
+    }
+    return span
+}
+
+// otlpSpanIds 返回各节点导出时使用的 spanId。空的或不符合 W3C 格式的 span_id（如旧版本的追踪）
+// 按追踪ID和节点序号生成，重复导出时保持不变；renamed 记录被替换的非空 span_id，
+// 用于替换子节点的 parentSpanId。需持有 mt 的锁
+func otlpSpanIds(mt *MessageTrace) (spanIds []string, renamed map[string]string) {
+    spanIds = make([]string, len(mt.Hops))
+    renamed = make(map[string]string)
+    for i, hop := range mt.Hops {
+        if isLowerHex(hop.SpanId, 16) && strings.Trim(hop.SpanId, "0") != "" {
+            spanIds[i] = hop.SpanId
+            continue
+        }
+        h := fnv.New64a()
+        fmt.Fprintf(h, "%s/%d", mt.TraceId, i)
+        spanIds[i] = fmt.Sprintf("%016x", h.Sum64()|1) // 全零的 spanId 无效
+        if _, ok := renamed[hop.SpanId]; hop.SpanId != "" && !ok {
+            renamed[hop.SpanId] = spanIds[i]
+        }
+    }
+    return spanIds, renamed
+}
+
+func otlpString(key, value string) OTLPKeyValue {
+    return OTLPKeyValue{Key: key, Value: OTLPAnyValue{StringValue: value}}
+}
@@ -0,0 +1,203 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+// newTestOTLPTrace 构造 core -> db（失败）、core -> cache（未完成）的追踪
+func newTestOTLPTrace(t *testing.T) *MessageTrace {
+    t.Helper()
+    trace, err := ParseTraceparent("00-"+testTraceId+"-"+testParentId+"-01", "rojo=1")
+    if err != nil {
+        t.Fatal(err)
+    }
+    core := trace.AddHop("core-1", "core", "host-a")
+    db := core.StartChild("db-1", "db", "host-b")
+    core.StartChild("cache-1", "cache", "host-b")
+    db.Complete(string(StatusError), errors.New("db unavailable"))
+    core.Complete(string(StatusOK), nil)
+    return trace
+}
+
+func otlpSpansByName(req *OTLPTraceRequest) map[string]OTLPSpan {
+    spans := make(map[string]OTLPSpan)
+    for _, rs := range req.ResourceSpans {
+        for _, ss := range rs.ScopeSpans {
+            for _, span := range ss.Spans {
+                spans[span.Name] = span
+            }
+        }
+    }
+    return spans
+}
+
+func TestMarshalOTLP(t *testing.T) {
+    trace := newTestOTLPTrace(t)
+    req := MarshalOTLP(trace, nil)
+
+    if len(req.ResourceSpans) != 3 {
+        t.Fatalf("got %d resources, want 3", len(req.ResourceSpans))
+    }
+    resource := req.ResourceSpans[0]
+    if got := resource.Resource.Attributes; len(got) != 3 ||
+        got[0] != otlpString("service.name", "core") ||
+        got[1] != otlpString("service.instance.id", "core-1") ||
+        got[2] != otlpString("host.name", "host-a") {
+        t.Fatalf("resource attributes %+v", got)
+    }
+    if resource.ScopeSpans[0].Scope.Name != otlpScopeName {
+        t.Fatalf("scope %+v", resource.ScopeSpans[0].Scope)
+    }
+
+    spans := otlpSpansByName(req)
+    core, db, cache := spans["core"], spans["db"], spans["cache"]
+    hops := trace.Hops
+    if core.TraceId != testTraceId || core.SpanId != hops[0].SpanId || core.ParentSpanId != testParentId {
+        t.Fatalf("core span ids %+v", core)
+    }
+    if db.ParentSpanId != core.SpanId || cache.ParentSpanId != core.SpanId {
+        t.Fatalf("child parent ids %q %q, want %q", db.ParentSpanId, cache.ParentSpanId, core.SpanId)
+    }
+    if core.Kind != otlpSpanKindServer || core.TraceState != "rojo=1" {
+        t.Fatalf("core span %+v", core)
+    }
+    if core.StartTimeUnixNano != strconv.FormatInt(hops[0].EntryTime.UnixNano(), 10) ||
+        core.EndTimeUnixNano != strconv.FormatInt(hops[0].ExitTime.UnixNano(), 10) {
+        t.Fatalf("core span times %s %s", core.StartTimeUnixNano, core.EndTimeUnixNano)
+    }
+
+    if core.Status != (OTLPStatus{Code: otlpStatusOK}) {
+        t.Fatalf("core status %+v", core.Status)
+    }
+    if db.Status != (OTLPStatus{Code: otlpStatusError, Message: "db unavailable"}) {
+        t.Fatalf("db status %+v", db.Status)
+    }
+    // 未完成的节点以进入时间为结束时间，状态为 Unset
+    if cache.Status.Code != otlpStatusUnset || cache.EndTimeUnixNano != cache.StartTimeUnixNano || len(cache.Attributes) != 0 {
+        t.Fatalf("unfinished span %+v", cache)
+    }
+    if len(db.Attributes) != 1 || db.Attributes[0] != otlpString("minijupyter.status", string(StatusError)) {
+        t.Fatalf("db attributes %+v", db.Attributes)
+    }
+
+    trace.SetSampled(false)
+    if req := MarshalOTLP(trace); len(req.ResourceSpans) != 0 {
+        t.Fatalf("unsampled trace exported: %+v", req)
+    }
+}
+
+func TestMarshalOTLPLegacySpanIds(t *testing.T) {
+    // 旧版本的追踪没有 span_id，或 span_id 不符合 W3C 格式
+    start := time.Unix(1700000000, 0)
+    trace := &MessageTrace{TraceId: testTraceId, Hops: []*MessageHop{
+        {ServiceName: "gateway", EntryTime: start},
+        {ServiceName: "core", SpanId: "a", EntryTime: start},
+        {ServiceName: "db", SpanId: "b", ParentSpanId: "a", EntryTime: start},
+        {ServiceName: "cache", SpanId: "00f067aa0ba902b7", ParentSpanId: "a", EntryTime: start},
+    }}
+
+    spans := otlpSpansByName(MarshalOTLP(trace))
+    seen := make(map[string]bool)
+    for name, span := range spans {
+        if !isLowerHex(span.SpanId, 16) || strings.Trim(span.SpanId, "0") == "" {
+            t.Fatalf("%s: invalid spanId %q", name, span.SpanId)
+        }
+        if seen[span.SpanId] {
+            t.Fatalf("%s: duplicate spanId %q", name, span.SpanId)
+        }
+        seen[span.SpanId] = true
+    }
+    if spans["cache"].SpanId != "00f067aa0ba902b7" {
+        t.Fatalf("valid spanId replaced: %q", spans["cache"].SpanId)
+    }
+    if spans["db"].ParentSpanId != spans["core"].SpanId || spans["cache"].ParentSpanId != spans["core"].SpanId {
+        t.Fatalf("parent links lost: %+v", spans)
+    }
+    if spans["gateway"].ParentSpanId != "" || spans["core"].ParentSpanId != "" {
+        t.Fatalf("unexpected root parents: %+v", spans)
+    }
+
+    // 重复导出时生成的 ID 不变
+    again := otlpSpansByName(MarshalOTLP(trace))
+    for name, span := range spans {
+        if again[name].SpanId != span.SpanId {
+            t.Fatalf("%s: spanId changed from %q to %q", name, span.SpanId, again[name].SpanId)
+        }
+    }
+}
+
+func TestOTLPExporterFile(t *testing.T) {
+    path := filepath.Join(t.TempDir(), "traces.jsonl")
+    exporter := NewOTLPExporter().WithFile(path)
+
+    // 没有可导出的 span 时不创建文件
+    if err := exporter.Export(NewMessageTrace()); err != nil {
+        t.Fatal(err)
+    }
+    if _, err := os.Stat(path); !os.IsNotExist(err) {
+        t.Fatalf("file created for empty export: %v", err)
+    }
+
+    for i := 0; i < 2; i++ {
+        if err := exporter.Export(newTestOTLPTrace(t)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    data, err := os.ReadFile(path)
+    if err != nil {
+        t.Fatal(err)
+    }
+    lines := strings.Split(strings.TrimSpace(string(data)), "\n")
+    if len(lines) != 2 {
+        t.Fatalf("got %d lines, want 2", len(lines))
+    }
+    for _, line := range lines {
+        var req OTLPTraceRequest
+        if err := json.Unmarshal([]byte(line), &req); err != nil || len(req.ResourceSpans) != 3 {
+            t.Fatalf("line %q: %v", line, err)
+        }
+    }
+}
+
+func TestOTLPExporterHTTP(t *testing.T) {
+    var got OTLPTraceRequest
+    status := http.StatusOK
+    server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+        if r.Method != http.MethodPost || r.Header.Get("Content-Type") != "application/json" {
+            t.Errorf("unexpected request %s %s", r.Method, r.Header.Get("Content-Type"))
+        }
+        body, _ := io.ReadAll(r.Body)
+        if err := json.Unmarshal(body, &got); err != nil {
+            t.Error(err)
+        }
+        w.WriteHeader(status)
+    }))
+
+    exporter := NewOTLPExporter().WithEndpoint(server.URL).WithHTTPClient(server.Client())
+    if err := exporter.Export(newTestOTLPTrace(t)); err != nil {
+        t.Fatal(err)
+    }
+    if len(otlpSpansByName(&got)) != 3 {
+        t.Fatalf("collector received %+v", got)
+    }
+
+    status = http.StatusInternalServerError
+    if err := exporter.Export(newTestOTLPTrace(t)); !errors.Is(err, ErrPublishFailed) {
+        t.Fatalf("collector error: %v", err)
+    }
+
+    server.Close()
+    if err := exporter.Export(newTestOTLPTrace(t)); !errors.Is(err, ErrConnectionFailed) {
+        t.Fatalf("collector down: %v", err)
+    }
+}
@@ -0,0 +1,185 @@
+package protocol
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// DefaultAgingInterval 低优先级消息每等待该时长，有效优先级提升一级
+const DefaultAgingInterval = 2 * time.Second
+
+// priorityLevels 按从高到低排列的优先级
+var priorityLevels = []Priority{PriorityHigh, PriorityNormal, PriorityLow}
+
+// PriorityQueue 按 Meta.Priority 出队的消息队列，放在接收节点的 socket 和处理函数之间
+//
+// 出队顺序为 HIGH > NORMAL > LOW，同一优先级先进先出。
+// 为防止饥饿，消息每等待 agingInterval 有效优先级提升一级（最多提升到 HIGH），
+// 有效优先级相同时先入队的先出队，因此等待足够久的低优先级消息不会被持续到达的 HIGH 消息压住；
+// 入队时间也相同时原始优先级高的先出队
+type PriorityQueue struct {
+    mu            sync.Mutex
+    queues        map[Priority][]queuedMessage
+    size          int
+    agingInterval time.Duration
+    notify        chan struct{} // 有新消息时通知等待的 Pop
+    closed        chan struct{}
+    closeOnce     sync.Once
+    now           func() time.Time
+}
+
+type queuedMessage struct {
+    msg      *Message
+    enqueued time.Time
+}
+
+// NewPriorityQueue 创建优先级队列
+func NewPriorityQueue() *PriorityQueue {
+    return &PriorityQueue{
+        queues:        make(map[Priority][]queuedMessage, len(priorityLevels)),
+        agingInterval: DefaultAgingInterval,
+        notify:        make(chan struct{}, 1),
+        closed:        make(chan struct{}),
+        now:           time.Now,
+    }
+}
+
+// WithAgingInterval 设置老化间隔，<= 0 时关闭老化（严格按优先级出队）
+func (q *PriorityQueue) WithAgingInterval(interval time.Duration) *PriorityQueue {
+    q.agingInterval = interval
+    return q
+}
+
+// Push 入队，未设置或未知的优先级按 NORMAL 处理；队列关闭后返回 ErrQueueClosed
+func (q *PriorityQueue) Push(msg *Message) error {
+    select {
+    case <-q.closed:
+        return ErrQueueClosed
+    default:
+    }
+
+    priority := queuePriority(msg.Meta.Priority)
+    q.mu.Lock()
+    q.queues[priority] = append(q.queues[priority], queuedMessage{msg: msg, enqueued: q.now()})
+    q.size++
+    q.mu.Unlock()
+    q.signal()
+    return nil
+}
+
+// TryPop 非阻塞出队，队列为空时返回 nil
+func (q *PriorityQueue) TryPop() *Message {
+    q.mu.Lock()
+    msg := q.popLocked()
+    remaining := q.size
+    q.mu.Unlock()
+    if msg != nil && remaining > 0 {
+        // 唤醒下一个等待者
+        q.signal()
+    }
+    return msg
+}
+
+// Pop 阻塞出队，直到有消息、ctx 结束或队列关闭且已取空
+func (q *PriorityQueue) Pop(ctx context.Context) (*Message, error) {
+    for {
+        if msg := q.TryPop(); msg != nil {
+            return msg, nil
+        }
+        select {
+        case <-q.notify:
+        case <-q.closed:
+            // 关闭后仍允许取完剩余消息
+            if msg := q.TryPop(); msg != nil {
+                return msg, nil
+            }
+            return nil, ErrQueueClosed
+        case <-ctx.Done():
+            return nil, ctx.Err()
+        }
+    }
+}
+
+// Close 关闭队列，之后 Push 失败，Pop 取完剩余消息后返回 ErrQueueClosed
+func (q *PriorityQueue) Close() {
+    q.closeOnce.Do(func() { close(q.closed) })
+}
+
+// Len 返回队列中的消息总数，可用于 CoreInfoContent.TaskQueueSize
+func (q *PriorityQueue) Len() int {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    return q.size
+}
+
+// DepthOf 返回指定优先级的消息数
+func (q *PriorityQueue) DepthOf(priority Priority) int {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    return len(q.queues[queuePriority(priority)])
+}
+
+// Depth 返回各优先级的消息数，可用于 CoreInfoContent.TaskQueueDepth
+func (q *PriorityQueue) Depth() map[Priority]int {
+    q.mu.Lock()
+    defer q.mu.Unlock()
+    depth := make(map[Priority]int, len(priorityLevels))
+    for _, p := range priorityLevels {
+        depth[p] = len(q.queues[p])
+    }
+    return depth
+}
+
+// popLocked 取出有效优先级最高的消息，需持有锁；各队列先进先出，只需比较队首
+func (q *PriorityQueue) popLocked() *Message {
+    if q.size == 0 {
+        return nil
+    }
+    now := q.now()
+    best, bestRank := -1, 0
+    var bestEnqueued time.Time
+    for level, p := range priorityLevels {
+        items := q.queues[p]
+        if len(items) == 0 {
+            continue
+        }
+        rank := level
+        if q.agingInterval > 0 {
+            rank -= int(now.Sub(items[0].enqueued) / q.agingInterval)
+            if rank < 0 {
+                rank = 0
+            }
+        }
+        // 有效优先级相同时比较队首的入队时间，仍相同时保留原始优先级更高的队列
+        enqueued := items[0].enqueued
+        if best < 0 || rank < bestRank || (rank == bestRank && enqueued.Before(bestEnqueued)) {
+            best, bestRank, bestEnqueued = level, rank, enqueued
+        }
+    }
+
+    p := priorityLevels[best]
+    item := q.queues[p][0]
+    q.queues[p][0] = queuedMessage{}
+    q.queues[p] = q.queues[p][1:]
+    q.size--
+    return item.msg
+}
+
+// signal 非阻塞地通知一个等待者
+func (q *PriorityQueue) signal() {
+    select {
+    case q.notify <- struct{}{}:
+    default:
+    }
+}
+
+// queuePriority 将未设置或未知的优先级视为 NORMAL
+func queuePriority(p Priority) Priority {
+    switch p {
+    case PriorityHigh, PriorityLow:
+        return p
+    default:
+        return PriorityNormal
+    }
+}
@@ -0,0 +1,69 @@
+package protocol
+
+import (
+	"testing"
+	"time"
+)
+
+func newTestPriorityMessage(t *testing.T, priority Priority) *Message {
+    t.Helper()
+    msg, err := NewMessageBuilder().
+        WithType(MsgTypeCoreInfoRequest).
+        WithSession("s").
+        WithUser("u").
+        WithTransport(TransportZMQ).
+        WithPriority(priority).
+        WithContent(&struct{}{}).
+        Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return msg
+}
+
+func TestPriorityQueueOrder(t *testing.T) {
+    q := NewPriorityQueue().WithAgingInterval(0)
+    for _, p := range []Priority{PriorityLow, PriorityNormal, PriorityHigh, ""} {
+        if err := q.Push(newTestPriorityMessage(t, p)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    var got []Priority
+    for msg := q.TryPop(); msg != nil; msg = q.TryPop() {
+        got = append(got, queuePriority(msg.Meta.Priority))
+    }
+    want := []Priority{PriorityHigh, PriorityNormal, PriorityNormal, PriorityLow}
+    if len(got) != len(want) {
+        t.Fatalf("got %v, want %v", got, want)
+    }
+    for i := range want {
+        if got[i] != want[i] {
+            t.Fatalf("got %v, want %v", got, want)
+        }
+    }
+}
+
+func TestPriorityQueueAgingPreventsStarvation(t *testing.T) {
+    now := time.Unix(0, 0)
+    q := NewPriorityQueue().WithAgingInterval(time.Second)
+    q.now = func() time.Time { return now }
+
+    low := newTestPriorityMessage(t, PriorityLow)
+    if err := q.Push(low); err != nil {
+        t.Fatal(err)
+    }
+    // 持续到达的 HIGH 消息不能无限期压住已老化到 HIGH 的 LOW 消息
+    for i := 0; i < 5; i++ {
+        now = now.Add(time.Second)
+        if err := q.Push(newTestPriorityMessage(t, PriorityHigh)); err != nil {
+            t.Fatal(err)
+        }
+        if q.TryPop() == low {
+            if i < 1 {
+                t.Fatalf("LOW message dequeued after %d intervals, before aging to HIGH", i+1)
+            }
+            return
+        }
+    }
+    t.Fatal("LOW message starved by HIGH traffic")
+}
@@ -0,0 +1,281 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"math"
+	"reflect"
+	"time"
+)
+
+// 仅依赖标准库的 protobuf 编解码，字段编号见 proto/message.proto
+
+// protobuf wire type
+const (
+    pbVarint  = 0
+    pbFixed64 = 1
+    pbBytes   = 2
+    pbFixed32 = 5
+)
+
+var errProtoTruncated = errors.New("protobuf: truncated input")
+
+// protoMessage 由支持 protobuf 编码的结构体实现
+type protoMessage interface {
+    marshalProto(w *protoWriter)
+    unmarshalProto(data []byte) error
+}
+
+// protoWriter 按 proto3 规则编码字段，零值字段不输出
+type protoWriter struct {
+    buf []byte
+    err error
+}
+
+func (w *protoWriter) tag(field, wireType int) {
+    w.buf = binary.AppendUvarint(w.buf, uint64(field)<<3|uint64(wireType))
+}
+
+func (w *protoWriter) String(field int, s string) {
+    if s == "" {
+        return
+    }
+    w.tag(field, pbBytes)
+    w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+    w.buf = append(w.buf, s...)
+}
+
+func (w *protoWriter) Strings(field int, list []string) {
+    for _, s := range list {
+        // repeated 字段中的空字符串也要保留
+        w.tag(field, pbBytes)
+        w.buf = binary.AppendUvarint(w.buf, uint64(len(s)))
+        w.buf = append(w.buf, s...)
+    }
+}
+
+func (w *protoWriter) Bytes(field int, b []byte) {
+    if len(b) == 0 {
+        return
+    }
+    w.tag(field, pbBytes)
+    w.buf = binary.AppendUvarint(w.buf, uint64(len(b)))
+    w.buf = append(w.buf, b...)
+}
+
+func (w *protoWriter) Int64(field int, v int64) {
+    if v == 0 {
+        return
+    }
+    w.tag(field, pbVarint)
+    w.buf = binary.AppendUvarint(w.buf, uint64(v))
+}
+
+func (w *protoWriter) Bool(field int, v bool) {
+    if !v {
+        return
+    }
+    w.tag(field, pbVarint)
+    w.buf = append(w.buf, 1)
+}
+
+// Double 编码 double（fixed64）
+func (w *protoWriter) Double(field int, v float64) {
+    if v == 0 {
+        return
+    }
+    w.tag(field, pbFixed64)
+    w.buf = binary.LittleEndian.AppendUint64(w.buf, math.Float64bits(v))
+}
+
+// Time 按 google.protobuf.Timestamp 编码
+func (w *protoWriter) Time(field int, t time.Time) {
+    if t.IsZero() {
+        return
+    }
+    var sub protoWriter
+    sub.Int64(1, t.Unix())
+    sub.Int64(2, int64(t.Nanosecond()))
+    w.tag(field, pbBytes)
+    w.buf = binary.AppendUvarint(w.buf, uint64(len(sub.buf)))
+    w.buf = append(w.buf, sub.buf...)
+}
+
+// Message 编码嵌套消息，m 为 nil 时不输出
+func (w *protoWriter) Message(field int, m protoMessage) {
+    if m == nil {
+        return
+    }
+    var sub protoWriter
+    m.marshalProto(&sub)
+    if sub.err != nil && w.err == nil {
+        w.err = sub.err
+    }
+    w.tag(field, pbBytes)
+    w.buf = binary.AppendUvarint(w.buf, uint64(len(sub.buf)))
+    w.buf = append(w.buf, sub.buf...)
+}
+
+// JSON 将任意值以 JSON 字节存入 bytes 字段，nil 不输出
+func (w *protoWriter) JSON(field int, v interface{}) {
+    if v == nil {
+        return
+    }
+    data, err := json.Marshal(v)
+    if err != nil {
+        if w.err == nil {
+            w.err = err
+        }
+        return
+    }
+    w.Bytes(field, data)
+}
+
+// protoField 解码出的单个字段
+type protoField struct {
+    num      int
+    wireType int
+    varint   uint64 // varint / fixed32 / fixed64 的值
+    bytes    []byte // length-delimited 的内容
+}
+
+func (f protoField) String() string  { return string(f.bytes) }
+func (f protoField) Int64() int64    { return int64(f.varint) }
+func (f protoField) Int() int        { return int(int64(f.varint)) }
+func (f protoField) Bool() bool      { return f.varint != 0 }
+func (f protoField) Double() float64 { return math.Float64frombits(f.varint) }
+
+// Time 解码 google.protobuf.Timestamp
+func (f protoField) Time() (time.Time, error) {
+    var sec, nsec int64
+    err := readProtoFields(f.bytes, func(sf protoField) error {
+        switch sf.num {
+        case 1:
+            sec = sf.Int64()
+        case 2:
+            nsec = sf.Int64()
+        }
+        return nil
+    })
+    if err != nil {
+        return time.Time{}, err
+    }
+    return time.Unix(sec, nsec), nil
+}
+
+// JSON 将 bytes 字段中的 JSON 解码到 v
+func (f protoField) JSON(v interface{}) error {
+    if len(f.bytes) == 0 {
+        return nil
+    }
+    return json.Unmarshal(f.bytes, v)
+}
+
+// readProtoFields 依次解码 data 中的字段，未知字段由回调忽略即可
+func readProtoFields(data []byte, fn func(f protoField) error) error {
+    for len(data) > 0 {
+        key, n := binary.Uvarint(data)
+        if n <= 0 {
+            return errProtoTruncated
+        }
+        data = data[n:]
+
+        f := protoField{num: int(key >> 3), wireType: int(key & 0x07)}
+        switch f.wireType {
+        case pbVarint:
+            v, n := binary.Uvarint(data)
+            if n <= 0 {
+                return errProtoTruncated
+            }
+            f.varint = v
+            data = data[n:]
+        case pbFixed64:
+            if len(data) < 8 {
+                return errProtoTruncated
+            }
+            f.varint = binary.LittleEndian.Uint64(data)
+            data = data[8:]
+        case pbFixed32:
+            if len(data) < 4 {
+                return errProtoTruncated
+            }
+            f.varint = uint64(binary.LittleEndian.Uint32(data))
+            data = data[4:]
+        case pbBytes:
+            l, n := binary.Uvarint(data)
+            if n <= 0 || l > uint64(len(data)-n) {
+                return errProtoTruncated
+            }
+            f.bytes = data[n : n+int(l)]
+            data = data[n+int(l):]
+        default:
+            return errors.New("protobuf: unsupported wire type")
+        }
+
+        if err := fn(f); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// marshalProto 编码一个支持 protobuf 的结构体
+func marshalProto(m protoMessage) ([]byte, error) {
+    var w protoWriter
+    m.marshalProto(&w)
+    if w.err != nil {
+        return nil, w.err
+    }
+    if w.buf == nil {
+        return []byte{}, nil
+    }
+    return w.buf, nil
+}
+
+///////////////////////////////////////////////////////////////////////////////////////
+
+// protobufCodec protobuf 编码，不支持 protobuf 的内容（如自定义消息类型）退回 JSON
+type protobufCodec struct{}
+
+func (protobufCodec) Name() string {
+    return string(EncodeProtobuf)
+}
+
+func (protobufCodec) Marshal(v interface{}) ([]byte, error) {
+    if isNilPointer(v) {
+        return []byte{}, nil
+    }
+    if m, ok := asProtoMessage(v); ok {
+        return marshalProto(m)
+    }
+    return json.Marshal(v)
+}
+
+func (protobufCodec) Unmarshal(data []byte, v interface{}) error {
+    if m, ok := v.(protoMessage); ok {
+        return m.unmarshalProto(data)
+    }
+    return json.Unmarshal(data, v)
+}
+
+// asProtoMessage 返回 v 的 protobuf 实现，v 为结构体值时取其副本的指针
+func asProtoMessage(v interface{}) (protoMessage, bool) {
+    if m, ok := v.(protoMessage); ok {
+        return m, true
+    }
+    rv := reflect.ValueOf(v)
+    if !rv.IsValid() || rv.Kind() == reflect.Ptr {
+        return nil, false
+    }
+    ptr := reflect.New(rv.Type())
+    ptr.Elem().Set(rv)
+    m, ok := ptr.Interface().(protoMessage)
+    return m, ok
+}
+
+// isNilPointer 判断接口中是否为 nil 指针
+func isNilPointer(v interface{}) bool {
+    rv := reflect.ValueOf(v)
+    return rv.Kind() == reflect.Ptr && rv.IsNil()
+}
@@ -0,0 +1,657 @@
+package protocol
+
+import (
+	"sort"
+	"time"
+)
+
+// 各消息结构体的 protobuf 编解码，字段编号与 proto/message.proto 保持一致
+
+// Header
+func (h *Header) marshalProto(w *protoWriter) {
+    w.String(1, h.MsgId)
+    w.String(2, h.SessionId)
+    w.String(3, h.UserId)
+    w.Time(4, h.Timestamp)
+    w.String(5, h.MsgType)
+    w.String(6, string(h.Compression))
+    w.String(7, string(h.Encoding))
+    w.String(8, string(h.Transport))
+    w.String(9, h.Version)
+    w.Bool(10, h.CompressAll)
+    w.String(11, h.Codec)
+}
+
+func (h *Header) unmarshalProto(data []byte) error {
+    *h = Header{}
+    return readProtoFields(data, func(f protoField) (err error) {
+        switch f.num {
+        case 1:
+            h.MsgId = f.String()
+        case 2:
+            h.SessionId = f.String()
+        case 3:
+            h.UserId = f.String()
+        case 4:
+            h.Timestamp, err = f.Time()
+        case 5:
+            h.MsgType = f.String()
+        case 6:
+            h.Compression = Compression(f.String())
+        case 7:
+            h.Encoding = Encoding(f.String())
+        case 8:
+            h.Transport = Transport(f.String())
+        case 9:
+            h.Version = f.String()
+        case 10:
+            h.CompressAll = f.Bool()
+        case 11:
+            h.Codec = f.String()
+        }
+        return err
+    })
+}
+
+// Metadata
+func (m *Metadata) marshalProto(w *protoWriter) {
+    w.String(1, string(m.Priority))
+    w.Strings(2, m.Tags)
+}
+
+func (m *Metadata) unmarshalProto(data []byte) error {
+    *m = Metadata{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            m.Priority = Priority(f.String())
+        case 2:
+            m.Tags = append(m.Tags, f.String())
+        }
+        return nil
+    })
+}
+
+// SecurityConfig
+func (s *SecurityConfig) marshalProto(w *protoWriter) {
+    w.String(1, s.Token)
+    w.String(2, s.Encryption)
+}
+
+func (s *SecurityConfig) unmarshalProto(data []byte) error {
+    *s = SecurityConfig{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            s.Token = f.String()
+        case 2:
+            s.Encryption = f.String()
+        }
+        return nil
+    })
+}
+
+// MessageTrace
+func (mt *MessageTrace) marshalProto(w *protoWriter) {
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    w.String(1, mt.TraceId)
+    w.Time(2, mt.StartTime)
+    for _, hop := range mt.Hops {
+        w.Message(3, hop)
+    }
+    w.Int64(4, int64(mt.TotalTime))
+    w.String(5, mt.ParentSpanId)
+    w.String(6, mt.TraceFlags)
+    w.String(7, mt.TraceState)
+}
+
+func (mt *MessageTrace) unmarshalProto(data []byte) error {
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    mt.TraceId, mt.StartTime, mt.Hops, mt.TotalTime = "", time.Time{}, make([]*MessageHop, 0), 0
+    mt.ParentSpanId, mt.TraceFlags, mt.TraceState = "", "", ""
+    return readProtoFields(data, func(f protoField) (err error) {
+        switch f.num {
+        case 1:
+            mt.TraceId = f.String()
+        case 2:
+            mt.StartTime, err = f.Time()
+        case 3:
+            hop := &MessageHop{}
+            if err = hop.unmarshalProto(f.bytes); err == nil {
+                hop.trace = mt
+                mt.Hops = append(mt.Hops, hop)
+            }
+        case 4:
+            mt.TotalTime = Duration(f.Int64())
+        case 5:
+            mt.ParentSpanId = f.String()
+        case 6:
+            mt.TraceFlags = f.String()
+        case 7:
+            mt.TraceState = f.String()
+        }
+        return err
+    })
+}
+
+// MessageHop
+func (h *MessageHop) marshalProto(w *protoWriter) {
+    w.String(1, h.ServiceId)
+    w.String(2, h.ServiceName)
+    w.String(3, h.HostName)
+    w.Time(4, h.EntryTime)
+    w.Time(5, h.ExitTime)
+    w.Int64(6, int64(h.Duration))
+    w.String(7, h.Status)
+    w.String(8, h.Error)
+    w.String(9, h.SpanId)
+    w.String(10, h.ParentSpanId)
+}
+
+func (h *MessageHop) unmarshalProto(data []byte) error {
+    *h = MessageHop{}
+    return readProtoFields(data, func(f protoField) (err error) {
+        switch f.num {
+        case 1:
+            h.ServiceId = f.String()
+        case 2:
+            h.ServiceName = f.String()
+        case 3:
+            h.HostName = f.String()
+        case 4:
+            h.EntryTime, err = f.Time()
+        case 5:
+            h.ExitTime, err = f.Time()
+        case 6:
+            h.Duration = Duration(f.Int64())
+        case 7:
+            h.Status = f.String()
+        case 8:
+            h.Error = f.String()
+        case 9:
+            h.SpanId = f.String()
+        case 10:
+            h.ParentSpanId = f.String()
+        }
+        return err
+    })
+}
+
+///////////////////////////////////////////////////////////////////////////////////////
+
+// ExecuteRequestContent
+func (c *ExecuteRequestContent) marshalProto(w *protoWriter) {
+    w.String(1, c.CommandId)
+    w.String(2, c.Service)
+    w.String(3, c.Method)
+    if c.Params != nil {
+        w.JSON(4, c.Params)
+    }
+    if c.Condition != nil {
+        w.JSON(5, c.Condition)
+    }
+    w.Strings(6, c.Dependency)
+    w.Int64(7, int64(c.Timeout))
+    if c.Retry != (RetryConfig{}) {
+        w.Message(8, &c.Retry)
+    }
+    w.Bool(9, c.StopOnError)
+    w.Strings(10, c.AllowedUsers)
+}
+
+func (c *ExecuteRequestContent) unmarshalProto(data []byte) error {
+    *c = ExecuteRequestContent{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            c.CommandId = f.String()
+        case 2:
+            c.Service = f.String()
+        case 3:
+            c.Method = f.String()
+        case 4:
+            return f.JSON(&c.Params)
+        case 5:
+            return f.JSON(&c.Condition)
+        case 6:
+            c.Dependency = append(c.Dependency, f.String())
+        case 7:
+            c.Timeout = f.Int()
+        case 8:
+            return c.Retry.unmarshalProto(f.bytes)
+        case 9:
+            c.StopOnError = f.Bool()
+        case 10:
+            c.AllowedUsers = append(c.AllowedUsers, f.String())
+        }
+        return nil
+    })
+}
+
+// RetryConfig
+func (r *RetryConfig) marshalProto(w *protoWriter) {
+    w.Int64(1, int64(r.MaxAttempts))
+    w.String(2, string(r.Strategy))
+}
+
+func (r *RetryConfig) unmarshalProto(data []byte) error {
+    *r = RetryConfig{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            r.MaxAttempts = f.Int()
+        case 2:
+            r.Strategy = RetryStrategy(f.String())
+        }
+        return nil
+    })
+}
+
+// ExecuteReplyContent
+func (c *ExecuteReplyContent) marshalProto(w *protoWriter) {
+    w.String(1, string(c.Status))
+}
+
+func (c *ExecuteReplyContent) unmarshalProto(data []byte) error {
+    *c = ExecuteReplyContent{}
+    return readProtoFields(data, func(f protoField) error {
+        if f.num == 1 {
+            c.Status = Status(f.String())
+        }
+        return nil
+    })
+}
+
+// CoreInfoContent
+func (c *CoreInfoContent) marshalProto(w *protoWriter) {
+    w.String(1, string(c.Status))
+    w.String(2, c.CoreStatus)
+    w.String(3, c.CoreVersion)
+    w.String(4, c.CPUUsage)
+    w.String(5, c.MemoryUsage)
+    w.String(6, c.DiskUsage)
+    w.String(7, c.NetworkIO)
+    w.Int64(8, int64(c.ActiveConnections))
+    w.Int64(9, int64(c.RunningTasks))
+    w.Int64(10, int64(c.TaskQueueSize))
+    for _, p := range sortedPriorities(c.TaskQueueDepth) {
+        var entry protoWriter
+        entry.String(1, string(p))
+        entry.Int64(2, int64(c.TaskQueueDepth[p]))
+        w.Bytes(11, entry.buf)
+    }
+}
+
+func (c *CoreInfoContent) unmarshalProto(data []byte) error {
+    *c = CoreInfoContent{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            c.Status = Status(f.String())
+        case 2:
+            c.CoreStatus = f.String()
+        case 3:
+            c.CoreVersion = f.String()
+        case 4:
+            c.CPUUsage = f.String()
+        case 5:
+            c.MemoryUsage = f.String()
+        case 6:
+            c.DiskUsage = f.String()
+        case 7:
+            c.NetworkIO = f.String()
+        case 8:
+            c.ActiveConnections = f.Int()
+        case 9:
+            c.RunningTasks = f.Int()
+        case 10:
+            c.TaskQueueSize = f.Int()
+        case 11:
+            var key Priority
+            var value int
+            err := readProtoFields(f.bytes, func(ef protoField) error {
+                switch ef.num {
+                case 1:
+                    key = Priority(ef.String())
+                case 2:
+                    value = ef.Int()
+                }
+                return nil
+            })
+            if err != nil {
+                return err
+            }
+            if c.TaskQueueDepth == nil {
+                c.TaskQueueDepth = make(map[Priority]int)
+            }
+            c.TaskQueueDepth[key] = value
+        }
+        return nil
+    })
+}
+
+// sortedPriorities 按字母顺序返回 map 的键，保证编码结果稳定
+func sortedPriorities(m map[Priority]int) []Priority {
+    keys := make([]Priority, 0, len(m))
+    for k := range m {
+        keys = append(keys, k)
+    }
+    sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+    return keys
+}
+
+// ExecuteResultContent
+func (c *ExecuteResultContent) marshalProto(w *protoWriter) {
+    w.String(1, string(c.Status))
+    w.JSON(2, c.Result)
+}
+
+func (c *ExecuteResultContent) unmarshalProto(data []byte) error {
+    *c = ExecuteResultContent{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            c.Status = Status(f.String())
+        case 2:
+            return f.JSON(&c.Result)
+        }
+        return nil
+    })
+}
+
+// StreamContent
+func (c *StreamContent) marshalProto(w *protoWriter) {
+    w.String(1, string(c.Type))
+    w.String(2, c.Text)
+}
+
+func (c *StreamContent) unmarshalProto(data []byte) error {
+    *c = StreamContent{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            c.Type = StreamType(f.String())
+        case 2:
+            c.Text = f.String()
+        }
+        return nil
+    })
+}
+
+// CommOpenContent
+func (c *CommOpenContent) marshalProto(w *protoWriter) {
+    w.String(1, c.CommId)
+    w.String(2, c.TargetName)
+    w.JSON(3, c.Data)
+}
+
+func (c *CommOpenContent) unmarshalProto(data []byte) error {
+    *c = CommOpenContent{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            c.CommId = f.String()
+        case 2:
+            c.TargetName = f.String()
+        case 3:
+            return f.JSON(&c.Data)
+        }
+        return nil
+    })
+}
+
+// CommMsgContent
+func (c *CommMsgContent) marshalProto(w *protoWriter) {
+    w.String(1, c.CommId)
+    w.JSON(2, c.Data)
+}
+
+func (c *CommMsgContent) unmarshalProto(data []byte) error {
+    *c = CommMsgContent{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            c.CommId = f.String()
+        case 2:
+            return f.JSON(&c.Data)
+        }
+        return nil
+    })
+}
+
+// CommInfoRequestContent
+func (c *CommInfoRequestContent) marshalProto(w *protoWriter) {
+    w.String(1, c.TargetName)
+}
+
+func (c *CommInfoRequestContent) unmarshalProto(data []byte) error {
+    *c = CommInfoRequestContent{}
+    return readProtoFields(data, func(f protoField) error {
+        if f.num == 1 {
+            c.TargetName = f.String()
+        }
+        return nil
+    })
+}
+
+// CommInfoReplyContent，comms 按 proto map 编码为 {1: comm_id, 2: CommInfo} 条目
+func (c *CommInfoReplyContent) marshalProto(w *protoWriter) {
+    w.String(1, string(c.Status))
+    ids := make([]string, 0, len(c.Comms))
+    for id := range c.Comms {
+        ids = append(ids, id)
+    }
+    sort.Strings(ids)
+    for _, id := range ids {
+        info := c.Comms[id]
+        var entry protoWriter
+        entry.String(1, id)
+        entry.Message(2, &info)
+        w.Bytes(2, entry.buf)
+    }
+}
+
+func (c *CommInfoReplyContent) unmarshalProto(data []byte) error {
+    *c = CommInfoReplyContent{Comms: make(map[string]CommInfo)}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            c.Status = Status(f.String())
+        case 2:
+            var id string
+            var info CommInfo
+            err := readProtoFields(f.bytes, func(ef protoField) error {
+                switch ef.num {
+                case 1:
+                    id = ef.String()
+                case 2:
+                    return info.unmarshalProto(ef.bytes)
+                }
+                return nil
+            })
+            if err != nil {
+                return err
+            }
+            c.Comms[id] = info
+        }
+        return nil
+    })
+}
+
+// CommInfo
+func (c *CommInfo) marshalProto(w *protoWriter) {
+    w.String(1, c.TargetName)
+    w.String(2, c.SessionId)
+}
+
+func (c *CommInfo) unmarshalProto(data []byte) error {
+    *c = CommInfo{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            c.TargetName = f.String()
+        case 2:
+            c.SessionId = f.String()
+        }
+        return nil
+    })
+}
+
+// ErrorContent
+func (c *ErrorContent) marshalProto(w *protoWriter) {
+    w.Int64(1, int64(c.Code))
+    w.String(2, c.Message)
+    w.JSON(3, c.Details)
+}
+
+func (c *ErrorContent) unmarshalProto(data []byte) error {
+    *c = ErrorContent{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            c.Code = f.Int()
+        case 2:
+            c.Message = f.String()
+        case 3:
+            return f.JSON(&c.Details)
+        }
+        return nil
+    })
+}
+
+// VersionRequestContent
+func (c *VersionRequestContent) marshalProto(w *protoWriter) {
+    w.Strings(1, c.Versions)
+}
+
+func (c *VersionRequestContent) unmarshalProto(data []byte) error {
+    *c = VersionRequestContent{}
+    return readProtoFields(data, func(f protoField) error {
+        if f.num == 1 {
+            c.Versions = append(c.Versions, f.String())
+        }
+        return nil
+    })
+}
+
+// VersionReplyContent
+func (c *VersionReplyContent) marshalProto(w *protoWriter) {
+    w.String(1, string(c.Status))
+    w.String(2, c.Version)
+    w.Strings(3, c.Versions)
+}
+
+func (c *VersionReplyContent) unmarshalProto(data []byte) error {
+    *c = VersionReplyContent{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            c.Status = Status(f.String())
+        case 2:
+            c.Version = f.String()
+        case 3:
+            c.Versions = append(c.Versions, f.String())
+        }
+        return nil
+    })
+}
+
+// TraceReportContent
+func (c *TraceReportContent) marshalProto(w *protoWriter) {
+    if c.Trace != nil {
+        w.Message(1, c.Trace)
+    }
+}
+
+func (c *TraceReportContent) unmarshalProto(data []byte) error {
+    *c = TraceReportContent{}
+    return readProtoFields(data, func(f protoField) error {
+        if f.num == 1 {
+            c.Trace = &MessageTrace{}
+            return c.Trace.unmarshalProto(f.bytes)
+        }
+        return nil
+    })
+}
+
+// TraceStatsRequestContent
+func (c *TraceStatsRequestContent) marshalProto(w *protoWriter) {
+    w.Strings(1, c.Services)
+}
+
+func (c *TraceStatsRequestContent) unmarshalProto(data []byte) error {
+    *c = TraceStatsRequestContent{}
+    return readProtoFields(data, func(f protoField) error {
+        if f.num == 1 {
+            c.Services = append(c.Services, f.String())
+        }
+        return nil
+    })
+}
+
+// TraceStatsReplyContent
+func (c *TraceStatsReplyContent) marshalProto(w *protoWriter) {
+    w.String(1, string(c.Status))
+    w.Int64(2, int64(c.Traces))
+    for i := range c.Services {
+        w.Message(3, &c.Services[i])
+    }
+}
+
+func (c *TraceStatsReplyContent) unmarshalProto(data []byte) error {
+    *c = TraceStatsReplyContent{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            c.Status = Status(f.String())
+        case 2:
+            c.Traces = f.Int()
+        case 3:
+            var stats ServiceStats
+            if err := stats.unmarshalProto(f.bytes); err != nil {
+                return err
+            }
+            c.Services = append(c.Services, stats)
+        }
+        return nil
+    })
+}
+
+// ServiceStats
+func (s *ServiceStats) marshalProto(w *protoWriter) {
+    w.String(1, s.ServiceName)
+    w.Int64(2, int64(s.Count))
+    w.Int64(3, int64(s.Errors))
+    w.Double(4, s.ErrorRate)
+    w.Int64(5, int64(s.P50))
+    w.Int64(6, int64(s.P95))
+    w.Int64(7, int64(s.P99))
+    w.Int64(8, int64(s.Max))
+}
+
+func (s *ServiceStats) unmarshalProto(data []byte) error {
+    *s = ServiceStats{}
+    return readProtoFields(data, func(f protoField) error {
+        switch f.num {
+        case 1:
+            s.ServiceName = f.String()
+        case 2:
+            s.Count = f.Int()
+        case 3:
+            s.Errors = f.Int()
+        case 4:
+            s.ErrorRate = f.Double()
+        case 5:
+            s.P50 = Duration(f.Int64())
+        case 6:
+            s.P95 = Duration(f.Int64())
+        case 7:
+            s.P99 = Duration(f.Int64())
+        case 8:
+            s.Max = Duration(f.Int64())
+        }
+        return nil
+    })
+}
@@ -0,0 +1,114 @@
+package protocol
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestProtobufHeaderEncoding(t *testing.T) {
+    // field 1 (msg_id) length-delimited，field 10 (compress_all) varint，零值字段不输出
+    data, err := protobufCodec{}.Marshal(&Header{MsgId: "a", CompressAll: true})
+    if err != nil {
+        t.Fatal(err)
+    }
+    if want := []byte{0x0a, 0x01, 'a', 0x50, 0x01}; !bytes.Equal(data, want) {
+        t.Fatalf("got % x, want % x", data, want)
+    }
+}
+
+func TestProtobufContentRoundTrip(t *testing.T) {
+    in := &ExecuteRequestContent{
+        CommandId:    "cmd-1",
+        Service:      "svc",
+        Method:       "run",
+        Params:       map[string]interface{}{"n": 3.0, "s": "x", "list": []interface{}{true, nil}},
+        Condition:    map[string]interface{}{"expr": `params.n > 1`},
+        Dependency:   []string{"a", ""},
+        Timeout:      1500,
+        Retry:        RetryConfig{MaxAttempts: 3, Strategy: RetryExponentialBackoff},
+        StopOnError:  true,
+        AllowedUsers: []string{"u1", "u2"},
+    }
+    data, err := protobufCodec{}.Marshal(in)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var out ExecuteRequestContent
+    if err := (protobufCodec{}).Unmarshal(data, &out); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(in, &out) {
+        t.Fatalf("round trip mismatch:\n%#v\n%#v", in, &out)
+    }
+}
+
+func TestProtobufWireRoundTrip(t *testing.T) {
+    msg, err := NewMessageBuilder().
+        WithType(MsgTypeExecuteRequest).
+        WithSession("s").
+        WithUser("u").
+        WithTransport(TransportZMQ).
+        WithEncoding(EncodeProtobuf).
+        WithPriority(PriorityHigh).
+        WithTags([]string{"gpu"}).
+        WithTraceHop("core-1", "core", "host").
+        WithContent(&ExecuteRequestContent{CommandId: "c", Service: "svc", Method: "run"}).
+        Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    wire, err := NewWireCodec().Encode(nil, msg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    _, got, err := NewWireCodec().Decode(wire)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got.Content, msg.Content) || !reflect.DeepEqual(got.Meta, msg.Meta) {
+        t.Fatalf("content or meta mismatch: %#v %#v", got.Content, got.Meta)
+    }
+    if got.Header.MsgId != msg.Header.MsgId || !got.Header.Timestamp.Equal(msg.Header.Timestamp) {
+        t.Fatalf("header mismatch: %#v", got.Header)
+    }
+    if got.Trace == nil || len(got.Trace.Hops) != 1 || got.Trace.Hops[0].ServiceId != msg.Trace.Hops[0].ServiceId {
+        t.Fatalf("trace mismatch: %v", got.Trace)
+    }
+}
+
+func TestProtobufSkipsUnknownFields(t *testing.T) {
+    data, _ := protobufCodec{}.Marshal(&ExecuteReplyContent{Status: StatusWaiting})
+    // field 15 varint、field 16 fixed64、field 17 bytes、field 18 fixed32
+    data = append(data, 0x78, 0x2a)
+    data = append(data, 0x81, 0x01, 1, 2, 3, 4, 5, 6, 7, 8)
+    data = append(data, 0x8a, 0x01, 0x02, 'h', 'i')
+    data = append(data, 0x95, 0x01, 1, 2, 3, 4)
+
+    var out ExecuteReplyContent
+    if err := (protobufCodec{}).Unmarshal(data, &out); err != nil {
+        t.Fatal(err)
+    }
+    if out.Status != StatusWaiting {
+        t.Fatalf("got %q", out.Status)
+    }
+}
+
+func TestProtobufCorruptInput(t *testing.T) {
+    cases := map[string][]byte{
+        "truncated tag":         {0x80},
+        "truncated varint":      {0x50, 0x80},
+        "length past end":       {0x0a, 0x05, 'a'},
+        "huge length":           {0x0a, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0x7f, 'a'},
+        "short fixed64":         {0x79, 1, 2},
+        "short fixed32":         {0x7d, 1},
+        "group wire type":       {0x0b},
+        "truncated timestamp":   {0x22, 0x02, 0x08, 0x80},
+    }
+    for name, data := range cases {
+        var h Header
+        if err := h.unmarshalProto(data); err == nil {
+            t.Errorf("%s: expected error", name)
+        }
+    }
+}
@@ -0,0 +1,154 @@
+package protocol
+
+import (
+	"sort"
+	"sync"
+)
+
+// Channel 消息所属的通信通道
+type Channel string
+
+// MessageKind 消息在交互中的角色
+type MessageKind string
+
+const (
+    ChannelRouterDealer Channel = "router_dealer" // ROUTER/DEALER 请求应答
+    ChannelPubSub       Channel = "pub_sub"       // PUB/SUB 广播
+    ChannelComm         Channel = "comm"          // Comm 双向通信
+
+    KindRequest MessageKind = "request" // 需要应答的请求
+    KindReply   MessageKind = "reply"   // 对请求的应答
+    KindEvent   MessageKind = "event"   // 无需应答的消息（广播、comm 等）
+)
+
+// ContentFactory 创建消息类型对应的 Content 结构体指针
+type ContentFactory func() interface{}
+
+// MessageTypeOptions 注册消息类型时的附加信息
+type MessageTypeOptions struct {
+    Channel   Channel     // 所属通道
+    Kind      MessageKind // 请求 / 应答 / 事件
+    ReplyType string      // Kind 为 KindRequest 时对应的应答类型
+}
+
+// MessageTypeInfo 已注册的消息类型信息
+type MessageTypeInfo struct {
+    Name    string
+    Factory ContentFactory
+    MessageTypeOptions
+}
+
+var (
+    messageTypesMu sync.RWMutex
+    messageTypes   = make(map[string]MessageTypeInfo)
+)
+
+func init() {
+    builtin := []struct {
+        name    string
+        factory ContentFactory
+        opts    MessageTypeOptions
+    }{
+        // ROUTER/DEALER 消息
+        {MsgTypeExecuteRequest, func() interface{} { return &ExecuteRequestContent{} },
+            MessageTypeOptions{ChannelRouterDealer, KindRequest, MsgTypeExecuteReply}},
+        {MsgTypeExecuteReply, func() interface{} { return &ExecuteReplyContent{} },
+            MessageTypeOptions{ChannelRouterDealer, KindReply, ""}},
+        {MsgTypeCoreInfoRequest, func() interface{} { return &struct{}{} }, // 空结构体，因为该请求没有content
+            MessageTypeOptions{ChannelRouterDealer, KindRequest, MsgTypeCoreInfoReply}},
+        {MsgTypeCoreInfoReply, func() interface{} { return &CoreInfoContent{} },
+            MessageTypeOptions{ChannelRouterDealer, KindReply, ""}},
+        {MsgTypeVersionRequest, func() interface{} { return &VersionRequestContent{} },
+            MessageTypeOptions{ChannelRouterDealer, KindRequest, MsgTypeVersionReply}},
+        {MsgTypeVersionReply, func() interface{} { return &VersionReplyContent{} },
+            MessageTypeOptions{ChannelRouterDealer, KindReply, ""}},
+        {MsgTypeError, func() interface{} { return &ErrorContent{} },
+            MessageTypeOptions{ChannelRouterDealer, KindReply, ""}},
+        {MsgTypeCommInfoRequest, func() interface{} { return &CommInfoRequestContent{} },
+            MessageTypeOptions{ChannelRouterDealer, KindRequest, MsgTypeCommInfoReply}},
+        {MsgTypeCommInfoReply, func() interface{} { return &CommInfoReplyContent{} },
+            MessageTypeOptions{ChannelRouterDealer, KindReply, ""}},
+        {MsgTypeTraceStatsRequest, func() interface{} { return &TraceStatsRequestContent{} },
+            MessageTypeOptions{ChannelRouterDealer, KindRequest, MsgTypeTraceStatsReply}},
+        {MsgTypeTraceStatsReply, func() interface{} { return &TraceStatsReplyContent{} },
+            MessageTypeOptions{ChannelRouterDealer, KindReply, ""}},
+
+        // PUB/SUB 消息
+        {MsgTypeExecuteResult, func() interface{} { return &ExecuteResultContent{} },
+            MessageTypeOptions{ChannelPubSub, KindEvent, ""}},
+        {MsgTypeStream, func() interface{} { return &StreamContent{} },
+            MessageTypeOptions{ChannelPubSub, KindEvent, ""}},
+        {MsgTypeTraceReport, func() interface{} { return &TraceReportContent{} },
+            MessageTypeOptions{ChannelPubSub, KindEvent, ""}},
+
+        // Comm 消息
+        {MsgTypeCommOpen, func() interface{} { return &CommOpenContent{} },
+            MessageTypeOptions{ChannelComm, KindEvent, ""}},
+        {MsgTypeCommMsg, func() interface{} { return &CommMsgContent{} },
+            MessageTypeOptions{ChannelComm, KindEvent, ""}},
+        {MsgTypeCommClose, func() interface{} { return &CommMsgContent{} }, // CommClose 使用相同的结构
+            MessageTypeOptions{ChannelComm, KindEvent, ""}},
+    }
+    for _, t := range builtin {
+        if err := RegisterMessageType(t.name, t.factory, t.opts); err != nil {
+            panic(err)
+        }
+    }
+}
+
+// RegisterMessageType 注册消息类型，注册后 ParseMessage、wire 解码和 ValidateMessage 均可识别该类型
+func RegisterMessageType(name string, factory ContentFactory, opts MessageTypeOptions) error {
+    if name == "" {
+        return ErrInvalidMessageType.WithDetails("message type name is required")
+    }
+    if factory == nil {
+        return ErrInvalidMessageType.WithDetails("content factory is required: " + name)
+    }
+    switch opts.Kind {
+    case KindRequest, KindReply, KindEvent:
+    default:
+        return ErrInvalidMessageType.WithDetails("invalid message kind: " + string(opts.Kind))
+    }
+    if opts.ReplyType != "" && opts.Kind != KindRequest {
+        return ErrInvalidMessageType.WithDetails("only requests can declare a reply type: " + name)
+    }
+
+    messageTypesMu.Lock()
+    defer messageTypesMu.Unlock()
+    if _, exists := messageTypes[name]; exists {
+        return ErrInvalidMessageType.WithDetails("message type already registered: " + name)
+    }
+    messageTypes[name] = MessageTypeInfo{
+        Name:               name,
+        Factory:            factory,
+        MessageTypeOptions: opts,
+    }
+    return nil
+}
+
+// UnregisterMessageType 移除已注册的消息类型
+func UnregisterMessageType(name string) {
+    messageTypesMu.Lock()
+    defer messageTypesMu.Unlock()
+    delete(messageTypes, name)
+}
+
+// LookupMessageType 查找消息类型信息
+func LookupMessageType(name string) (MessageTypeInfo, bool) {
+    messageTypesMu.RLock()
+    defer messageTypesMu.RUnlock()
+    info, ok := messageTypes[name]
+    return info, ok
+}
+
+// MessageTypes 返回所有已注册的消息类型名称（按字母排序）
+func MessageTypes() []string {
+    messageTypesMu.RLock()
+    defer messageTypesMu.RUnlock()
+    names := make([]string, 0, len(messageTypes))
+    for name := range messageTypes {
+        names = append(names, name)
+    }
+    sort.Strings(names)
+    return names
+}
@@ -0,0 +1,115 @@
+package protocol
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type testPingContent struct {
+    Seq int `json:"seq"`
+}
+
+func registerTestMessageType(t *testing.T, name string, opts MessageTypeOptions) {
+    t.Helper()
+    if err := RegisterMessageType(name, func() interface{} { return &testPingContent{} }, opts); err != nil {
+        t.Fatal(err)
+    }
+    t.Cleanup(func() { UnregisterMessageType(name) })
+}
+
+func TestRegisterMessageType(t *testing.T) {
+    opts := MessageTypeOptions{ChannelRouterDealer, KindRequest, "test_pong"}
+    registerTestMessageType(t, "test_ping", opts)
+
+    info, ok := LookupMessageType("test_ping")
+    if !ok || info.Name != "test_ping" || info.MessageTypeOptions != opts {
+        t.Fatalf("unexpected info: %+v", info)
+    }
+    found := false
+    for _, name := range MessageTypes() {
+        found = found || name == "test_ping"
+    }
+    if !found {
+        t.Fatal("registered type missing from MessageTypes")
+    }
+
+    // GetContentType 从注册表创建新的 content
+    a, b := GetContentType("test_ping"), GetContentType("test_ping")
+    if _, ok := a.(*testPingContent); !ok || a == b {
+        t.Fatalf("unexpected content: %T %p %p", a, a, b)
+    }
+    if _, ok := GetContentType(MsgTypeExecuteRequest).(*ExecuteRequestContent); !ok {
+        t.Fatal("builtin type not registered")
+    }
+    if GetContentType("no_such_type") != nil {
+        t.Fatal("unknown type returned content")
+    }
+}
+
+func TestRegisterMessageTypeErrors(t *testing.T) {
+    registerTestMessageType(t, "test_event", MessageTypeOptions{ChannelPubSub, KindEvent, ""})
+    factory := func() interface{} { return &testPingContent{} }
+    for name, tc := range map[string]struct {
+        name    string
+        factory ContentFactory
+        opts    MessageTypeOptions
+    }{
+        "empty name":        {"", factory, MessageTypeOptions{Kind: KindEvent}},
+        "nil factory":       {"test_x", nil, MessageTypeOptions{Kind: KindEvent}},
+        "invalid kind":      {"test_x", factory, MessageTypeOptions{Kind: "stream"}},
+        "reply on event":    {"test_x", factory, MessageTypeOptions{Kind: KindEvent, ReplyType: "test_y"}},
+        "duplicate":         {"test_event", factory, MessageTypeOptions{Kind: KindEvent}},
+        "duplicate builtin": {MsgTypeExecuteRequest, factory, MessageTypeOptions{Kind: KindRequest}},
+    } {
+        if err := RegisterMessageType(tc.name, tc.factory, tc.opts); !errors.Is(err, ErrInvalidMessageType) {
+            t.Errorf("%s: expected ErrInvalidMessageType, got %v", name, err)
+        }
+    }
+    if _, ok := LookupMessageType("test_x"); ok {
+        t.Fatal("rejected type was registered")
+    }
+
+    // 覆盖已有类型需先移除
+    UnregisterMessageType("test_event")
+    registerTestMessageType(t, "test_event", MessageTypeOptions{ChannelComm, KindEvent, ""})
+    if info, _ := LookupMessageType("test_event"); info.Channel != ChannelComm {
+        t.Fatalf("override not applied: %+v", info)
+    }
+}
+
+func TestRegisteredMessageTypeParse(t *testing.T) {
+    registerTestMessageType(t, "test_ping", MessageTypeOptions{ChannelRouterDealer, KindRequest, ""})
+    msg, err := NewMessageBuilder().
+        WithType("test_ping").
+        WithSession("s").
+        WithUser("u").
+        WithTransport(TransportZMQ).
+        WithContent(&testPingContent{Seq: 7}).
+        Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := ValidateMessage(msg); err != nil {
+        t.Fatalf("registered type rejected: %v", err)
+    }
+    data, err := SerializeMessage(msg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    got, err := ParseMessage(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got.Content, &testPingContent{Seq: 7}) {
+        t.Fatalf("got %#v", got.Content)
+    }
+
+    UnregisterMessageType("test_ping")
+    if _, err := ParseMessage(data); err == nil {
+        t.Fatal("parsed unregistered type")
+    }
+    if err := ValidateMessage(msg); !errors.Is(err, ErrInvalidMessageType) {
+        t.Fatalf("unregistered type accepted: %v", err)
+    }
+}
@@ -0,0 +1,128 @@
+package protocol
+
+import (
+	"container/heap"
+	"sync"
+	"time"
+)
+
+// 重放保护默认参数
+const (
+    DefaultReplayWindow     = 5 * time.Minute
+    DefaultReplayMaxEntries = 100000
+)
+
+// ReplayGuard 记录时间窗口内出现过的 msg_id，拒绝重复消息和时间戳超出窗口的消息
+//
+// 记录在时间戳超出窗口后移除；记录数达到上限时移除时间戳最早的记录，
+// 而不是拒绝新消息，避免对端用大量消息占满缓存导致拒绝服务
+type ReplayGuard struct {
+    mu         sync.Mutex
+    window     time.Duration        // 允许的时间偏差（过去和未来）
+    maxEntries int                  // 最多记录的 msg_id 数量
+    seen       map[string]time.Time // msg_id -> 消息时间戳
+    order      replayHeap           // 按时间戳排列的记录，用于过期和淘汰
+    now        func() time.Time
+}
+
+type replayEntry struct {
+    msgId     string
+    timestamp time.Time
+}
+
+// replayHeap 以时间戳为键的小顶堆
+type replayHeap []replayEntry
+
+func (h replayHeap) Len() int            { return len(h) }
+func (h replayHeap) Less(i, j int) bool  { return h[i].timestamp.Before(h[j].timestamp) }
+func (h replayHeap) Swap(i, j int)       { h[i], h[j] = h[j], h[i] }
+func (h *replayHeap) Push(x interface{}) { *h = append(*h, x.(replayEntry)) }
+func (h *replayHeap) Pop() interface{} {
+    old := *h
+    e := old[len(old)-1]
+    *h = old[:len(old)-1]
+    return e
+}
+
+// NewReplayGuard 创建重放保护器，window <= 0 时使用默认窗口
+func NewReplayGuard(window time.Duration) *ReplayGuard {
+    if window <= 0 {
+        window = DefaultReplayWindow
+    }
+    return &ReplayGuard{
+        window:     window,
+        maxEntries: DefaultReplayMaxEntries,
+        seen:       make(map[string]time.Time),
+        now:        time.Now,
+    }
+}
+
+// WithMaxEntries 设置最多记录的 msg_id 数量
+func (g *ReplayGuard) WithMaxEntries(n int) *ReplayGuard {
+    if n > 0 {
+        g.maxEntries = n
+    }
+    return g
+}
+
+// Check 检查消息是否为重放，可作为 MessageCheck 传给 ValidateMessage
+func (g *ReplayGuard) Check(msg *Message) error {
+    return g.CheckHeader(&msg.Header)
+}
+
+// CheckHeader 检查 msg_id 和 timestamp，全部通过后才记录该 msg_id
+func (g *ReplayGuard) CheckHeader(h *Header) error {
+    if h.MsgId == "" {
+        return ErrInvalidMessage.WithDetails("msg_id is required")
+    }
+
+    g.mu.Lock()
+    defer g.mu.Unlock()
+
+    now := g.now()
+    if h.Timestamp.Before(now.Add(-g.window)) {
+        return ErrReplayDetected.WithDetails("timestamp too old")
+    }
+    if h.Timestamp.After(now.Add(g.window)) {
+        return ErrReplayDetected.WithDetails("timestamp too far in the future")
+    }
+    if _, ok := g.seen[h.MsgId]; ok {
+        return ErrReplayDetected.WithDetails("duplicate msg_id: " + h.MsgId)
+    }
+
+    g.prune(now)
+    for len(g.seen) >= g.maxEntries {
+        g.evictOldest()
+    }
+    g.seen[h.MsgId] = h.Timestamp
+    heap.Push(&g.order, replayEntry{msgId: h.MsgId, timestamp: h.Timestamp})
+    return nil
+}
+
+// Len 返回当前记录的 msg_id 数量
+func (g *ReplayGuard) Len() int {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    return len(g.seen)
+}
+
+// Prune 清理已超出时间窗口的记录
+func (g *ReplayGuard) Prune() {
+    g.mu.Lock()
+    defer g.mu.Unlock()
+    g.prune(g.now())
+}
+
+// prune 清理时间戳早于窗口下限的记录，这些消息无论如何都会被时间戳检查拒绝
+func (g *ReplayGuard) prune(now time.Time) {
+    cutoff := now.Add(-g.window)
+    for len(g.order) > 0 && g.order[0].timestamp.Before(cutoff) {
+        g.evictOldest()
+    }
+}
+
+// evictOldest 移除时间戳最早的记录
+func (g *ReplayGuard) evictOldest() {
+    e := heap.Pop(&g.order).(replayEntry)
+    delete(g.seen, e.msgId)
+}
@@ -0,0 +1,90 @@
+package protocol
+
+import (
+	"errors"
+	"strconv"
+	"testing"
+	"time"
+)
+
+func newTestReplayGuard(window time.Duration) (*ReplayGuard, *time.Time) {
+    now := time.Unix(1700000000, 0)
+    g := NewReplayGuard(window)
+    g.now = func() time.Time { return now }
+    return g, &now
+}
+
+func TestReplayGuardDuplicate(t *testing.T) {
+    g, now := newTestReplayGuard(time.Minute)
+    h := &Header{MsgId: "m1", Timestamp: *now}
+    if err := g.CheckHeader(h); err != nil {
+        t.Fatal(err)
+    }
+    if err := g.CheckHeader(h); !errors.Is(err, ErrReplayDetected) {
+        t.Fatalf("duplicate accepted: %v", err)
+    }
+    if err := g.CheckHeader(&Header{Timestamp: *now}); !errors.Is(err, ErrInvalidMessage) {
+        t.Fatalf("empty msg_id accepted: %v", err)
+    }
+}
+
+func TestReplayGuardWindow(t *testing.T) {
+    g, now := newTestReplayGuard(time.Minute)
+    for name, ts := range map[string]time.Time{
+        "too old":    now.Add(-2 * time.Minute),
+        "too future": now.Add(2 * time.Minute),
+    } {
+        h := &Header{MsgId: name, Timestamp: ts}
+        if err := g.CheckHeader(h); !errors.Is(err, ErrReplayDetected) {
+            t.Fatalf("%s: accepted: %v", name, err)
+        }
+    }
+    // 被拒绝的消息不记录 msg_id
+    if g.Len() != 0 {
+        t.Fatalf("rejected messages recorded: %d", g.Len())
+    }
+    if err := g.CheckHeader(&Header{MsgId: "too old", Timestamp: *now}); err != nil {
+        t.Fatalf("msg_id of a rejected message poisoned the cache: %v", err)
+    }
+    if err := g.CheckHeader(&Header{MsgId: "skew", Timestamp: now.Add(30 * time.Second)}); err != nil {
+        t.Fatalf("timestamp within skew rejected: %v", err)
+    }
+}
+
+func TestReplayGuardExpiry(t *testing.T) {
+    g, now := newTestReplayGuard(time.Minute)
+    if err := g.CheckHeader(&Header{MsgId: "m1", Timestamp: *now}); err != nil {
+        t.Fatal(err)
+    }
+    *now = now.Add(2 * time.Minute)
+    // 新消息入缓存时清理过期记录
+    if err := g.CheckHeader(&Header{MsgId: "m2", Timestamp: *now}); err != nil {
+        t.Fatal(err)
+    }
+    if g.Len() != 1 {
+        t.Fatalf("expired entry kept: %d entries", g.Len())
+    }
+    *now = now.Add(2 * time.Minute)
+    g.Prune()
+    if g.Len() != 0 {
+        t.Fatalf("Prune kept %d entries", g.Len())
+    }
+}
+
+func TestReplayGuardCapacity(t *testing.T) {
+    g, now := newTestReplayGuard(time.Minute)
+    g.WithMaxEntries(3)
+    for i := 0; i < 10; i++ {
+        h := &Header{MsgId: "m" + strconv.Itoa(i), Timestamp: now.Add(time.Duration(i) * time.Second)}
+        if err := g.CheckHeader(h); err != nil {
+            t.Fatalf("message %d rejected at capacity: %v", i, err)
+        }
+    }
+    if g.Len() != 3 {
+        t.Fatalf("got %d entries, want 3", g.Len())
+    }
+    // 保留时间戳最新的记录
+    if err := g.CheckHeader(&Header{MsgId: "m9", Timestamp: now.Add(9 * time.Second)}); !errors.Is(err, ErrReplayDetected) {
+        t.Fatalf("recent duplicate accepted: %v", err)
+    }
+}
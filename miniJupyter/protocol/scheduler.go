@@ -0,0 +1,525 @@
+package protocol
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"time"
+)
+
+// 重试退避的默认参数，exponential_backoff 第 n 次重试前等待 base * 2^(n-1)，不超过上限
+const (
+    DefaultRetryBackoff    = 100 * time.Millisecond
+    DefaultMaxRetryBackoff = 30 * time.Second
+)
+
+// DefaultTaskRetention 结束的任务默认保留的时长
+const DefaultTaskRetention = 10 * time.Minute
+
+// TaskRunner 执行一条命令，ctx 在超时（timeout）或调度器关闭时取消，实现应当响应 ctx
+type TaskRunner func(ctx context.Context, req *ExecuteRequestContent) (interface{}, error)
+
+// TaskStateHandler 任务状态变化时调用：任务开始执行时为 starting，结束时为 success、error 或 skipped。
+// 可能在不同的 goroutine 中并发调用
+type TaskStateHandler func(state TaskState)
+
+// SessionVarsFunc 返回会话变量，供执行条件中的 session.<key> 引用
+type SessionVarsFunc func(sessionId string) map[string]interface{}
+
+// TaskState 任务的当前状态
+type TaskState struct {
+    CommandId string
+    SessionId string
+    Request   *ExecuteRequestContent
+    Status    Status      // waiting || starting || success || error || skipped
+    Result    interface{} // TaskRunner 的返回值
+    Err       error       // 失败原因，依赖失败时为 ErrDependencyFailed，超时为 ErrTimeout
+    Attempts  int         // 实际执行次数
+}
+
+// ResultContent 生成结束任务的 execute_result 内容，失败时 result 为 ErrorContent
+func (s TaskState) ResultContent() *ExecuteResultContent {
+    if s.Status == StatusError {
+        return &ExecuteResultContent{Status: StatusError, Result: NewErrorContent(s.Err)}
+    }
+    return &ExecuteResultContent{Status: s.Status, Result: s.Result}
+}
+
+// TaskScheduler core 的任务引擎，按 command_id / dependency 组成 DAG 调度 execute_request
+//
+// 依赖都已结束的任务立即执行（starting），否则进入 waiting，在依赖结束后执行；
+// 依赖可以引用尚未提交的命令，提交时拒绝形成环的依赖。
+// 任务失败且设置了 stop_on_error 时，直接或间接依赖它的任务以 ErrDependencyFailed 失败；
+// 未设置时失败也视为已结束，依赖它的任务照常执行。
+// 开始执行前对 condition 求值（见 Condition），不满足时任务以 skipped 结束。
+// 依赖被跳过时，condition 引用了该依赖的任务照常求值，其他依赖它的任务直接以 skipped 结束。
+// timeout 限制任务（含重试）的总时长，retry.max_attempts 为最多执行次数。
+//
+// 结束的任务在 retention 内保留，期间可通过 Get 查询，也可被之后提交的任务依赖、在条件中引用；
+// 超过 retention 且没有 waiting / starting 的任务依赖它时，在下次提交时被移除，
+// 之后其 command_id 可以重新使用，依赖它的新任务视为依赖尚未提交的命令。Forget 可立即移除
+type TaskScheduler struct {
+    mu         sync.Mutex
+    runner     TaskRunner
+    onState    TaskStateHandler
+    vars       SessionVarsFunc
+    backoff    time.Duration
+    maxBackoff time.Duration
+    retention  time.Duration
+    now        func() time.Time
+    tasks      map[string]*scheduledTask
+    dependents map[string][]string // command_id -> 等待它的任务
+    ctx        context.Context
+    cancel     context.CancelFunc
+    wg         sync.WaitGroup
+    closed     bool
+}
+
+type scheduledTask struct {
+    state TaskState
+    cond  *Condition
+    stop  bool // 失败时依赖它的任务随之失败
+
+    finishedAt time.Time
+}
+
+// schedulerActions 在锁内收集、解锁后执行的回调和任务
+type schedulerActions struct {
+    events []TaskState
+    starts []*scheduledTask
+}
+
+// NewTaskScheduler 创建任务调度器，runner 执行具体命令
+func NewTaskScheduler(runner TaskRunner) *TaskScheduler {
+    ctx, cancel := context.WithCancel(context.Background())
+    return &TaskScheduler{
+        runner:     runner,
+        backoff:    DefaultRetryBackoff,
+        maxBackoff: DefaultMaxRetryBackoff,
+        retention:  DefaultTaskRetention,
+        now:        time.Now,
+        tasks:      make(map[string]*scheduledTask),
+        dependents: make(map[string][]string),
+        ctx:        ctx,
+        cancel:     cancel,
+    }
+}
+
+// WithStateHandler 设置任务状态变化的回调，通常用于发布 execute_result
+func (s *TaskScheduler) WithStateHandler(handler TaskStateHandler) *TaskScheduler {
+    s.onState = handler
+    return s
+}
+
+// WithSessionVars 设置会话变量的来源
+func (s *TaskScheduler) WithSessionVars(vars SessionVarsFunc) *TaskScheduler {
+    s.vars = vars
+    return s
+}
+
+// WithRetryBackoff 设置 exponential_backoff 的初始等待和上限
+func (s *TaskScheduler) WithRetryBackoff(base, max time.Duration) *TaskScheduler {
+    s.backoff = base
+    s.maxBackoff = max
+    return s
+}
+
+// WithRetention 设置结束的任务保留的时长，<= 0 时一直保留直到 Forget
+func (s *TaskScheduler) WithRetention(retention time.Duration) *TaskScheduler {
+    s.retention = retention
+    return s
+}
+
+// Submit 提交不属于任何会话的任务，见 SubmitSession
+func (s *TaskScheduler) Submit(req *ExecuteRequestContent) (Status, error) {
+    return s.SubmitSession("", req)
+}
+
+// SubmitSession 提交会话中的任务，返回 execute_reply 的状态（starting || waiting）；
+// command_id 重复、依赖成环或 condition 不合法时返回 ErrInvalidParams，依赖已因 stop_on_error 失败时返回 ErrDependencyFailed
+func (s *TaskScheduler) SubmitSession(sessionId string, req *ExecuteRequestContent) (Status, error) {
+    if req == nil || req.CommandId == "" {
+        return StatusError, ErrInvalidParams.WithDetails("command_id is required")
+    }
+    id := req.CommandId
+    cond, err := CompileCondition(req.Condition)
+    if err != nil {
+        return StatusError, err
+    }
+    if cond != nil {
+        for _, dep := range cond.Deps() {
+            if !containsString(req.Dependency, dep) {
+                return StatusError, ErrInvalidParams.WithDetails("condition references " + dep + " which is not a dependency")
+            }
+        }
+    }
+
+    s.mu.Lock()
+    if s.closed {
+        s.mu.Unlock()
+        return StatusError, ErrQueueClosed.WithDetails("scheduler is closed")
+    }
+    s.evictLocked()
+    if _, exists := s.tasks[id]; exists {
+        s.mu.Unlock()
+        return StatusError, ErrInvalidParams.WithDetails("duplicate command_id: " + id)
+    }
+    if cycle := s.findCycleLocked(id, req.Dependency); cycle != nil {
+        s.mu.Unlock()
+        return StatusError, ErrInvalidParams.WithDetails("dependency cycle: " + strings.Join(cycle, " -> "))
+    }
+
+    t := &scheduledTask{
+        state: TaskState{CommandId: id, SessionId: sessionId, Request: req, Status: StatusWaiting},
+        cond:  cond,
+    }
+    s.tasks[id] = t
+    for _, dep := range req.Dependency {
+        // 已结束的依赖不会再推进本任务
+        if d, ok := s.tasks[dep]; !ok || !isTaskFinished(d.state.Status) {
+            s.dependents[dep] = append(s.dependents[dep], id)
+        }
+    }
+    var a schedulerActions
+    s.advanceLocked(t, &a)
+    status, err := t.state.Status, t.state.Err
+    s.mu.Unlock()
+
+    s.dispatch(&a)
+    if status == StatusError {
+        return StatusError, err
+    }
+    return status, nil
+}
+
+// HandleMessage 处理 execute_request，返回 execute_reply；提交失败时返回错误，由调用方回复 error
+func (s *TaskScheduler) HandleMessage(msg *Message) (*Message, error) {
+    if msg.Header.MsgType != MsgTypeExecuteRequest {
+        return nil, ErrInvalidMessageType.WithDetails(msg.Header.MsgType)
+    }
+    req, ok := msg.Content.(*ExecuteRequestContent)
+    if !ok {
+        return nil, ErrValidationFailed.WithDetails("unexpected content for execute_request")
+    }
+    status, err := s.SubmitSession(msg.Header.SessionId, req)
+    if err != nil {
+        return nil, err
+    }
+    return NewReplyBuilder(msg).
+        WithContent(&ExecuteReplyContent{Status: status}).
+        Build()
+}
+
+// Get 返回任务的当前状态
+func (s *TaskScheduler) Get(commandId string) (TaskState, bool) {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    t, ok := s.tasks[commandId]
+    if !ok {
+        return TaskState{}, false
+    }
+    return t.state, true
+}
+
+// Forget 立即移除已结束的任务，任务不存在、未结束或仍被 waiting / starting 的任务依赖时返回 false
+func (s *TaskScheduler) Forget(commandId string) bool {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    t, ok := s.tasks[commandId]
+    if !ok || !isTaskFinished(t.state.Status) || s.pinnedLocked()[commandId] {
+        return false
+    }
+    delete(s.tasks, commandId)
+    return true
+}
+
+// Running 返回正在执行的任务数，可用于 CoreInfoContent.RunningTasks
+func (s *TaskScheduler) Running() int {
+    return s.count(StatusStarting)
+}
+
+// Waiting 返回等待依赖的任务数，可用于 CoreInfoContent.TaskQueueSize
+func (s *TaskScheduler) Waiting() int {
+    return s.count(StatusWaiting)
+}
+
+// Close 停止接收和启动任务，取消正在执行的任务并等待其结束；仍在等待的任务
+// （包括依赖在 Close 时结束的任务）保持 waiting，之后不会再调用 runner
+func (s *TaskScheduler) Close() {
+    s.mu.Lock()
+    s.closed = true
+    s.mu.Unlock()
+    s.cancel()
+    s.wg.Wait()
+}
+
+func (s *TaskScheduler) count(status Status) int {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    n := 0
+    for _, t := range s.tasks {
+        if t.state.Status == status {
+            n++
+        }
+    }
+    return n
+}
+
+// evictLocked 移除超过 retention 且未被依赖的已结束任务，需持有锁
+func (s *TaskScheduler) evictLocked() {
+    if s.retention <= 0 {
+        return
+    }
+    deadline := s.now().Add(-s.retention)
+    var pinned map[string]bool
+    for id, t := range s.tasks {
+        if !isTaskFinished(t.state.Status) || t.finishedAt.After(deadline) {
+            continue
+        }
+        if pinned == nil {
+            pinned = s.pinnedLocked()
+        }
+        if !pinned[id] {
+            delete(s.tasks, id)
+        }
+    }
+}
+
+// pinnedLocked 返回 waiting / starting 任务的依赖，这些任务的结果在条件求值前必须保留，需持有锁
+func (s *TaskScheduler) pinnedLocked() map[string]bool {
+    pinned := make(map[string]bool)
+    for _, t := range s.tasks {
+        if isTaskFinished(t.state.Status) {
+            continue
+        }
+        for _, dep := range t.state.Request.Dependency {
+            pinned[dep] = true
+        }
+    }
+    return pinned
+}
+
+// findCycleLocked 沿已提交任务的依赖查找能否回到 id，返回环上的路径，需持有锁
+func (s *TaskScheduler) findCycleLocked(id string, deps []string) []string {
+    visited := make(map[string]bool)
+    var walk func(path []string, deps []string) []string
+    walk = func(path []string, deps []string) []string {
+        for _, dep := range deps {
+            if dep == id {
+                return append(path, dep)
+            }
+            if visited[dep] {
+                continue
+            }
+            visited[dep] = true
+            t, ok := s.tasks[dep]
+            if !ok {
+                continue
+            }
+            if cycle := walk(append(path, dep), t.state.Request.Dependency); cycle != nil {
+                return cycle
+            }
+        }
+        return nil
+    }
+    return walk([]string{id}, deps)
+}
+
+// advanceLocked 检查 waiting 任务的依赖：有依赖因 stop_on_error 失败则任务失败，
+// 有条件未引用的依赖被跳过则任务跳过，全部结束则开始执行，需持有锁
+func (s *TaskScheduler) advanceLocked(t *scheduledTask, a *schedulerActions) {
+    ready, skipped := true, false
+    for _, dep := range t.state.Request.Dependency {
+        d, ok := s.tasks[dep]
+        if !ok || !isTaskFinished(d.state.Status) {
+            ready = false
+            continue
+        }
+        if d.state.Status == StatusError && d.stop {
+            s.finishLocked(t, StatusError, nil, ErrDependencyFailed.WithDetails("dependency failed: "+dep), true, a)
+            return
+        }
+        // 条件引用了被跳过的依赖时交给条件判断
+        if d.state.Status == StatusSkipped && (t.cond == nil || !containsString(t.cond.Deps(), dep)) {
+            skipped = true
+        }
+    }
+    if !ready {
+        return
+    }
+    if skipped {
+        s.finishLocked(t, StatusSkipped, nil, nil, false, a)
+        return
+    }
+    // Close 之后不再启动任务，依赖已就绪的任务保持 waiting
+    if s.closed {
+        return
+    }
+    t.state.Status = StatusStarting
+    s.wg.Add(1)
+    a.starts = append(a.starts, t)
+}
+
+// finishLocked 记录任务结果并推进等待它的任务，需持有锁
+func (s *TaskScheduler) finishLocked(t *scheduledTask, status Status, result interface{}, err error, stop bool, a *schedulerActions) {
+    t.state.Status = status
+    t.state.Result = result
+    t.state.Err = err
+    t.stop = status == StatusError && stop
+    t.finishedAt = s.now()
+    a.events = append(a.events, t.state)
+
+    id := t.state.CommandId
+    waiting := s.dependents[id]
+    delete(s.dependents, id)
+    for _, wid := range waiting {
+        if w, ok := s.tasks[wid]; ok && w.state.Status == StatusWaiting {
+            s.advanceLocked(w, a)
+        }
+    }
+}
+
+// dispatch 在锁外依次调用回调并启动任务
+func (s *TaskScheduler) dispatch(a *schedulerActions) {
+    if s.onState != nil {
+        for _, state := range a.events {
+            s.onState(state)
+        }
+    }
+    for _, t := range a.starts {
+        go s.run(t)
+    }
+}
+
+func (s *TaskScheduler) run(t *scheduledTask) {
+    defer s.wg.Done()
+    // 在 dispatch 和 Close 之间就绪的任务还未开始执行，同样保持 waiting
+    s.mu.Lock()
+    if s.closed {
+        t.state.Status = StatusWaiting
+        s.mu.Unlock()
+        return
+    }
+    s.mu.Unlock()
+    req := t.state.Request
+    if t.cond != nil && !t.cond.Eval(s.conditionEnv(t)) {
+        var a schedulerActions
+        s.mu.Lock()
+        s.finishLocked(t, StatusSkipped, nil, nil, false, &a)
+        s.mu.Unlock()
+        s.dispatch(&a)
+        return
+    }
+    s.dispatch(&schedulerActions{events: []TaskState{s.stateOf(t)}})
+
+    ctx := s.ctx
+    if req.Timeout > 0 {
+        var cancel context.CancelFunc
+        ctx, cancel = context.WithTimeout(ctx, time.Duration(req.Timeout)*time.Millisecond)
+        defer cancel()
+    }
+    result, attempts, err := s.execute(ctx, req)
+
+    var a schedulerActions
+    status := StatusSuccess
+    if err != nil {
+        status = StatusError
+    }
+    s.mu.Lock()
+    t.state.Attempts = attempts
+    s.finishLocked(t, status, result, err, req.StopOnError, &a)
+    s.mu.Unlock()
+    s.dispatch(&a)
+}
+
+// conditionEnv 收集条件求值所需的依赖状态、params 和会话变量
+func (s *TaskScheduler) conditionEnv(t *scheduledTask) ConditionEnv {
+    env := ConditionEnv{
+        Deps:   make(map[string]TaskState),
+        Params: t.state.Request.Params,
+    }
+    s.mu.Lock()
+    for _, dep := range t.cond.Deps() {
+        if d, ok := s.tasks[dep]; ok {
+            env.Deps[dep] = d.state
+        }
+    }
+    s.mu.Unlock()
+    if s.vars != nil {
+        env.Session = s.vars(t.state.SessionId)
+    }
+    return env
+}
+
+func (s *TaskScheduler) stateOf(t *scheduledTask) TaskState {
+    s.mu.Lock()
+    defer s.mu.Unlock()
+    return t.state
+}
+
+// execute 按 retry 配置执行任务，返回结果、执行次数和错误
+func (s *TaskScheduler) execute(ctx context.Context, req *ExecuteRequestContent) (interface{}, int, error) {
+    maxAttempts := req.Retry.MaxAttempts
+    if maxAttempts < 1 {
+        maxAttempts = 1
+    }
+    for attempt := 1; ; attempt++ {
+        result, err := s.runner(ctx, req)
+        if err == nil {
+            return result, attempt, nil
+        }
+        if ctx.Err() != nil {
+            return nil, attempt, s.contextError(ctx, req)
+        }
+        if attempt >= maxAttempts {
+            if _, ok := AsProtocolError(err); !ok {
+                err = ErrExecutionFailed.WithCause(err)
+            }
+            return nil, attempt, err
+        }
+        if delay := s.retryDelay(req.Retry.Strategy, attempt); delay > 0 {
+            timer := time.NewTimer(delay)
+            select {
+            case <-timer.C:
+            case <-ctx.Done():
+                timer.Stop()
+                return nil, attempt, s.contextError(ctx, req)
+            }
+        }
+    }
+}
+
+// retryDelay 第 attempt 次执行失败后的等待时长，未知的策略立即重试
+func (s *TaskScheduler) retryDelay(strategy RetryStrategy, attempt int) time.Duration {
+    if strategy != RetryExponentialBackoff || s.backoff <= 0 {
+        return 0
+    }
+    delay := s.backoff
+    for i := 1; i < attempt; i++ {
+        delay *= 2
+        if s.maxBackoff > 0 && delay >= s.maxBackoff {
+            return s.maxBackoff
+        }
+    }
+    return delay
+}
+
+func (s *TaskScheduler) contextError(ctx context.Context, req *ExecuteRequestContent) error {
+    if ctx.Err() == context.DeadlineExceeded {
+        return ErrTimeout.WithDetails(req.CommandId + " exceeded " + (time.Duration(req.Timeout) * time.Millisecond).String())
+    }
+    return ErrExecutionFailed.WithCause(ctx.Err())
+}
+
+func isTaskFinished(status Status) bool {
+    return status == StatusSuccess || status == StatusError || status == StatusSkipped
+}
+
+func containsString(list []string, s string) bool {
+    for _, item := range list {
+        if item == s {
+            return true
+        }
+    }
+    return false
+}
@@ -0,0 +1,199 @@
+package protocol
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// newTestScheduler 创建立即返回的调度器，finished 在每个任务结束时收到其 command_id
+func newTestScheduler(t *testing.T) (*TaskScheduler, <-chan string) {
+    t.Helper()
+    finished := make(chan string, 16)
+    s := NewTaskScheduler(func(ctx context.Context, req *ExecuteRequestContent) (interface{}, error) {
+        return req.CommandId, nil
+    }).WithStateHandler(func(state TaskState) {
+        if isTaskFinished(state.Status) {
+            finished <- state.CommandId
+        }
+    })
+    t.Cleanup(s.Close)
+    return s, finished
+}
+
+func waitFinished(t *testing.T, finished <-chan string, id string) {
+    t.Helper()
+    select {
+    case got := <-finished:
+        if got != id {
+            t.Fatalf("finished %s, want %s", got, id)
+        }
+    case <-time.After(5 * time.Second):
+        t.Fatalf("timed out waiting for %s", id)
+    }
+}
+
+func TestTaskSchedulerRetention(t *testing.T) {
+    s, finished := newTestScheduler(t)
+    var clock atomic.Int64
+    s.now = func() time.Time { return time.Unix(clock.Load(), 0) }
+    s.WithRetention(time.Minute)
+
+    if _, err := s.Submit(&ExecuteRequestContent{CommandId: "a"}); err != nil {
+        t.Fatal(err)
+    }
+    waitFinished(t, finished, "a")
+
+    // retention 内结果保留，command_id 不能重复使用
+    if _, err := s.Submit(&ExecuteRequestContent{CommandId: "a"}); err == nil {
+        t.Fatal("duplicate command_id accepted")
+    }
+    // waiting 的任务依赖 a 时，a 超过 retention 也不会被移除
+    if status, err := s.Submit(&ExecuteRequestContent{CommandId: "b", Dependency: []string{"a", "x"}}); err != nil || status != StatusWaiting {
+        t.Fatalf("got %s, %v", status, err)
+    }
+    clock.Add(120)
+    if _, err := s.Submit(&ExecuteRequestContent{CommandId: "c"}); err != nil {
+        t.Fatal(err)
+    }
+    waitFinished(t, finished, "c")
+    if _, ok := s.Get("a"); !ok {
+        t.Fatal("dependency of a waiting task evicted")
+    }
+    if s.Forget("a") {
+        t.Fatal("Forget removed a dependency of a waiting task")
+    }
+
+    if _, err := s.Submit(&ExecuteRequestContent{CommandId: "x"}); err != nil {
+        t.Fatal(err)
+    }
+    waitFinished(t, finished, "x")
+    waitFinished(t, finished, "b")
+
+    // 没有任务再依赖 a 后，超过 retention 即被移除，command_id 可以重新使用
+    clock.Add(120)
+    if _, err := s.Submit(&ExecuteRequestContent{CommandId: "a"}); err != nil {
+        t.Fatalf("command_id not reusable after retention: %v", err)
+    }
+    waitFinished(t, finished, "a")
+    if _, ok := s.Get("c"); ok {
+        t.Fatal("expired task c not evicted")
+    }
+    if _, ok := s.Get("b"); ok {
+        t.Fatal("expired task b not evicted")
+    }
+}
+
+func TestTaskSchedulerForget(t *testing.T) {
+    s, finished := newTestScheduler(t)
+    s.WithRetention(0)
+
+    if s.Forget("a") {
+        t.Fatal("Forget of unknown task succeeded")
+    }
+    if _, err := s.Submit(&ExecuteRequestContent{CommandId: "a"}); err != nil {
+        t.Fatal(err)
+    }
+    waitFinished(t, finished, "a")
+    if !s.Forget("a") {
+        t.Fatal("Forget of finished task failed")
+    }
+    if _, ok := s.Get("a"); ok {
+        t.Fatal("forgotten task still present")
+    }
+    if _, err := s.Submit(&ExecuteRequestContent{CommandId: "a"}); err != nil {
+        t.Fatalf("command_id not reusable after Forget: %v", err)
+    }
+    waitFinished(t, finished, "a")
+}
+
+func TestTaskSchedulerSkippedDependency(t *testing.T) {
+    s, finished := newTestScheduler(t)
+    states := make(map[string]TaskState)
+    collect := func(id string) {
+        waitFinished(t, finished, id)
+        state, _ := s.Get(id)
+        states[id] = state
+    }
+
+    if _, err := s.Submit(&ExecuteRequestContent{CommandId: "a", Condition: map[string]interface{}{"expr": "false"}}); err != nil {
+        t.Fatal(err)
+    }
+    collect("a")
+    // 未引用 a 的任务直接跳过，引用 a 的任务对条件求值
+    if _, err := s.Submit(&ExecuteRequestContent{CommandId: "b", Dependency: []string{"a"}}); err != nil {
+        t.Fatal(err)
+    }
+    collect("b")
+    if _, err := s.Submit(&ExecuteRequestContent{
+        CommandId:  "c",
+        Dependency: []string{"a"},
+        Condition:  map[string]interface{}{"expr": `dep.a.status == "skipped"`},
+    }); err != nil {
+        t.Fatal(err)
+    }
+    collect("c")
+    if _, err := s.Submit(&ExecuteRequestContent{
+        CommandId:  "d",
+        Dependency: []string{"a"},
+        Condition:  map[string]interface{}{"dep.a.status": "success"},
+    }); err != nil {
+        t.Fatal(err)
+    }
+    collect("d")
+
+    for id, want := range map[string]Status{"a": StatusSkipped, "b": StatusSkipped, "c": StatusSuccess, "d": StatusSkipped} {
+        if got := states[id]; got.Status != want || (want == StatusSkipped && got.Attempts != 0) {
+            t.Errorf("%s: got %s after %d attempts, want %s", id, got.Status, got.Attempts, want)
+        }
+    }
+}
+
+func TestTaskSchedulerNoStartsAfterClose(t *testing.T) {
+    started := make(chan string, 4)
+    var calls sync.Map
+    s := NewTaskScheduler(func(ctx context.Context, req *ExecuteRequestContent) (interface{}, error) {
+        calls.Store(req.CommandId, true)
+        started <- req.CommandId
+        <-ctx.Done()
+        return nil, ctx.Err()
+    })
+
+    // b、c 依赖 a（不带 stop_on_error），a 被 Close 取消而结束后它们不能开始执行
+    for _, req := range []*ExecuteRequestContent{
+        {CommandId: "a"},
+        {CommandId: "b", Dependency: []string{"a"}},
+        {CommandId: "c", Dependency: []string{"a"}, Condition: map[string]interface{}{ConditionExprKey: `dep.a.status == "error"`}},
+    } {
+        if _, err := s.Submit(req); err != nil {
+            t.Fatal(err)
+        }
+    }
+    select {
+    case <-started:
+    case <-time.After(5 * time.Second):
+        t.Fatal("a did not start")
+    }
+
+    s.Close()
+    if state, _ := s.Get("a"); state.Status != StatusError {
+        t.Fatalf("a status %s, want error", state.Status)
+    }
+    for _, id := range []string{"b", "c"} {
+        if state, _ := s.Get(id); state.Status != StatusWaiting {
+            t.Fatalf("%s status %s, want waiting", id, state.Status)
+        }
+        if _, called := calls.Load(id); called {
+            t.Fatalf("runner called for %s after Close", id)
+        }
+    }
+    if s.Running() != 0 || s.Waiting() != 2 {
+        t.Fatalf("running %d, waiting %d", s.Running(), s.Waiting())
+    }
+    if _, err := s.Submit(&ExecuteRequestContent{CommandId: "d"}); !errors.Is(err, ErrQueueClosed) {
+        t.Fatalf("submit after Close: %v", err)
+    }
+}
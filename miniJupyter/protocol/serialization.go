@@ -5,62 +5,136 @@ import (
 	"fmt"
 )
 
-// GetContentType 根据消息类型返回对应的 Content 结构体
+// GetContentType 根据消息类型返回对应的 Content 结构体，未注册的类型返回 nil
 func GetContentType(msgType string) interface{} {
-	switch msgType {
-	// ROUTER/DEALER 消息
-	case MsgTypeExecuteRequest:
-		return &ExecuteRequestContent{}
-	case MsgTypeExecuteReply:
-		return &ExecuteReplyContent{}
-	case MsgTypeCoreInfoRequest:
-		return &struct{}{} // 空结构体，因为该请求没有content
-	case MsgTypeCoreInfoReply:
-		return &CoreInfoContent{}
+	info, ok := LookupMessageType(msgType)
+	if !ok {
+		return nil
+	}
+	return info.Factory()
+}
 
-	// PUB/SUB 消息
-	case MsgTypeExecuteResult:
-		return &ExecuteResultContent{}
-	case MsgTypeStream:
-		return &StreamContent{}
+// messageEnvelope 单个 JSON 消息的外层结构；encoding 为 json 时 content 为 JSON 对象，
+// 为 protobuf 或 custom 时 content 为编解码器输出的 base64 字符串
+type messageEnvelope struct {
+	Header       Header          `json:"header"`
+	ParentHeader Header          `json:"parent_header"`
+	Meta         Metadata        `json:"meta"`
+	Content      json.RawMessage `json:"content"`
+	Security     SecurityConfig  `json:"security"`
+	Trace        *MessageTrace   `json:"trace"`
+}
 
-	// Comm 消息
-	case MsgTypeCommOpen:
-		return &CommOpenContent{}
-	case MsgTypeCommMsg:
-		return &CommMsgContent{}
-	case MsgTypeCommClose:
-		return &CommMsgContent{} // CommClose 使用相同的结构
+// SerializeMessage 将消息序列化为单个 JSON，content 按 header.encoding 编码。
+// 单个 JSON 不支持内容加密，security.encryption 不为 None 的消息需使用 WireCodec
+func SerializeMessage(msg *Message) ([]byte, error) {
+	if err := checkPlainContent(&msg.Security, ErrSerializeFailed); err != nil {
+		return nil, err
+	}
+	codec, err := CodecForHeader(&msg.Header)
+	if err != nil {
+		return nil, err
+	}
 
-	default:
-		return nil
+	var content []byte
+	if _, ok := codec.(jsonCodec); ok {
+		content, err = json.Marshal(msg.Content)
+	} else {
+		var encoded []byte
+		if encoded, err = codec.Marshal(msg.Content); err == nil {
+			content, err = json.Marshal(encoded)
+		}
 	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal content: %w", err)
+	}
+
+	data, err := json.Marshal(messageEnvelope{
+		Header:       msg.Header,
+		ParentHeader: msg.ParentHeader,
+		Meta:         msg.Meta,
+		Content:      content,
+		Security:     msg.Security,
+		Trace:        msg.Trace,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal message: %w", err)
+	}
+	return data, nil
 }
 
 // ParseMessage 智能解析消息
 func ParseMessage(data []byte) (*Message, error) {
-	// 1. 先解析基础消息结构
-	var msg Message
-	if err := json.Unmarshal(data, &msg); err != nil {
+	// 1. 先解析基础消息结构，content 暂不解析
+	var env messageEnvelope
+	if err := json.Unmarshal(data, &env); err != nil {
 		return nil, fmt.Errorf("failed to parse message: %w", err)
 	}
-	
+
+	// 旧版本消息先升级到当前版本
+	if env.Header.Version != "" && env.Header.Version != ProtocolVersion {
+		var raw RawMessage
+		if err := json.Unmarshal(data, &raw); err != nil {
+			return nil, fmt.Errorf("failed to parse message: %w", err)
+		}
+		if err := UpgradeRaw(raw); err != nil {
+			return nil, err
+		}
+		upgraded, err := json.Marshal(raw)
+		if err != nil {
+			return nil, fmt.Errorf("failed to upgrade message: %w", err)
+		}
+		env = messageEnvelope{}
+		if err := json.Unmarshal(upgraded, &env); err != nil {
+			return nil, fmt.Errorf("failed to parse message: %w", err)
+		}
+	}
+
+	// 加密的 content 只能由 WireCodec 解密，不能当作明文解析
+	if err := checkPlainContent(&env.Security, ErrDeserializeFailed); err != nil {
+		return nil, err
+	}
+
 	// 2. 获取正确的 Content 类型
-	contentType := GetContentType(msg.Header.MsgType)
+	contentType := GetContentType(env.Header.MsgType)
 	if contentType == nil {
-		return nil, fmt.Errorf("unknown message type: %s", msg.Header.MsgType)
+		return nil, fmt.Errorf("unknown message type: %s", env.Header.MsgType)
 	}
-	
-	// 3. 重新解析 Content 到正确的类型
-	contentData, err := json.Marshal(msg.Content)
+
+	// 3. 按 header 选择编解码器解析 Content
+	codec, err := CodecForHeader(&env.Header)
 	if err != nil {
-		return nil, fmt.Errorf("failed to marshal content: %w", err)
+		return nil, err
+	}
+
+	if _, ok := codec.(jsonCodec); ok {
+		if len(env.Content) > 0 {
+			err = json.Unmarshal(env.Content, contentType)
+		}
+	} else {
+		var encoded []byte
+		if err = json.Unmarshal(env.Content, &encoded); err == nil {
+			err = codec.Unmarshal(encoded, contentType)
+		}
 	}
-	
-	if err := json.Unmarshal(contentData, contentType); err != nil {
+	if err != nil {
 		return nil, fmt.Errorf("failed to parse content: %w", err)
 	}
-	
-	msg.Content = contentType
-	return &msg, nil
-}
\ No newline at end of file
+
+	return &Message{
+		Header:       env.Header,
+		ParentHeader: env.ParentHeader,
+		Meta:         env.Meta,
+		Content:      contentType,
+		Security:     env.Security,
+		Trace:        env.Trace,
+	}, nil
+}
+
+// checkPlainContent 确认消息未要求内容加密，否则返回 base 类型的错误
+func checkPlainContent(security *SecurityConfig, base *ProtocolError) error {
+	if normalizeEncryption(security.Encryption) != EncryptionNone {
+		return base.WithDetails("content encryption " + security.Encryption + " requires WireCodec")
+	}
+	return nil
+}
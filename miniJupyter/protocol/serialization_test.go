@@ -0,0 +1,35 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestSerializeMessageRejectsEncryption(t *testing.T) {
+    msg := newTestExecuteRequest(t, EncryptionAES, CompressNone)
+    if _, err := SerializeMessage(msg); !errors.Is(err, ErrSerializeFailed) {
+        t.Fatalf("encrypted message serialized as plaintext: %v", err)
+    }
+    if _, err := MarshalForVersion(msg, "0.2"); !errors.Is(err, ErrSerializeFailed) {
+        t.Fatalf("encrypted message downgraded as plaintext: %v", err)
+    }
+
+    plain := newTestExecuteRequest(t, EncryptionNone, CompressNone)
+    data, err := SerializeMessage(plain)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, err := ParseMessage(data); err != nil {
+        t.Fatal(err)
+    }
+
+    // 声明加密但 content 为明文的消息不能被当作已解密内容接受
+    forged := strings.Replace(string(data), `"encryption":"None"`, `"encryption":"AES"`, 1)
+    if forged == string(data) {
+        t.Fatalf("security not found in %s", data)
+    }
+    if _, err := ParseMessage([]byte(forged)); !errors.Is(err, ErrDeserializeFailed) {
+        t.Fatalf("message claiming encryption parsed: %v", err)
+    }
+}
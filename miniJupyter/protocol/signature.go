@@ -0,0 +1,74 @@
+package protocol
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/hex"
+	"hash"
+)
+
+// 签名算法
+const (
+    SignatureHMACSHA256 = "hmac-sha256"
+    SignatureHMACSHA512 = "hmac-sha512"
+)
+
+// Signer 使用共享密钥对 wire 消息帧进行 HMAC 签名和校验
+type Signer struct {
+    scheme  string
+    key     []byte
+    newHash func() hash.Hash
+}
+
+// NewSigner 根据签名算法和共享密钥创建签名器
+func NewSigner(scheme string, key []byte) (*Signer, error) {
+    if len(key) == 0 {
+        return nil, NewProtocolError(ErrCodeInvalidSignature, "signature key is required", nil)
+    }
+
+    var newHash func() hash.Hash
+    switch scheme {
+    case SignatureHMACSHA256:
+        newHash = sha256.New
+    case SignatureHMACSHA512:
+        newHash = sha512.New
+    default:
+        return nil, NewProtocolError(ErrCodeInvalidSignature, "unsupported signature scheme", scheme)
+    }
+
+    return &Signer{
+        scheme:  scheme,
+        key:     append([]byte(nil), key...),
+        newHash: newHash,
+    }, nil
+}
+
+// Scheme 返回签名算法名称
+func (s *Signer) Scheme() string {
+    return s.scheme
+}
+
+// Sign 对 header, parent_header, meta, content, security, trace 六个帧依次签名，返回十六进制签名
+func (s *Signer) Sign(frames [][]byte) []byte {
+    mac := hmac.New(s.newHash, s.key)
+    for _, frame := range frames {
+        mac.Write(frame)
+    }
+    sum := mac.Sum(nil)
+
+    signature := make([]byte, hex.EncodedLen(len(sum)))
+    hex.Encode(signature, sum)
+    return signature
+}
+
+// Verify 校验签名，签名缺失或不匹配时返回 ErrInvalidSignature
+func (s *Signer) Verify(frames [][]byte, signature []byte) error {
+    if len(signature) == 0 {
+        return ErrInvalidSignature.WithDetails("signature is missing")
+    }
+    if !hmac.Equal(s.Sign(frames), signature) {
+        return ErrInvalidSignature.WithDetails("signature mismatch")
+    }
+    return nil
+}
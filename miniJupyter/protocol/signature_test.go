@@ -0,0 +1,42 @@
+package protocol
+
+import (
+	"testing"
+)
+
+func TestSignerSignVerify(t *testing.T) {
+    frames := [][]byte{[]byte("header"), []byte("{}"), []byte("meta"), []byte("content"), []byte("security"), []byte("null")}
+    for _, scheme := range []string{SignatureHMACSHA256, SignatureHMACSHA512} {
+        signer, err := NewSigner(scheme, []byte("secret"))
+        if err != nil {
+            t.Fatal(err)
+        }
+        signature := signer.Sign(frames)
+        if err := signer.Verify(frames, signature); err != nil {
+            t.Fatalf("%s: %v", scheme, err)
+        }
+
+        tampered := append([][]byte(nil), frames...)
+        tampered[3] = []byte("Content")
+        if err := signer.Verify(tampered, signature); GetErrorCode(err) != ErrCodeInvalidSignature {
+            t.Fatalf("%s: tampered frame accepted: %v", scheme, err)
+        }
+
+        other, _ := NewSigner(scheme, []byte("other"))
+        if err := other.Verify(frames, signature); GetErrorCode(err) != ErrCodeInvalidSignature {
+            t.Fatalf("%s: wrong key accepted: %v", scheme, err)
+        }
+        if err := signer.Verify(frames, nil); GetErrorCode(err) != ErrCodeInvalidSignature {
+            t.Fatalf("%s: missing signature accepted: %v", scheme, err)
+        }
+    }
+}
+
+func TestNewSignerErrors(t *testing.T) {
+    if _, err := NewSigner(SignatureHMACSHA256, nil); GetErrorCode(err) != ErrCodeInvalidSignature {
+        t.Fatalf("empty key accepted: %v", err)
+    }
+    if _, err := NewSigner("md5", []byte("k")); GetErrorCode(err) != ErrCodeInvalidSignature {
+        t.Fatalf("unsupported scheme accepted: %v", err)
+    }
+}
@@ -0,0 +1,195 @@
+package protocol
+
+import (
+	"encoding/binary"
+	"errors"
+)
+
+// snappy 块格式（https://github.com/google/snappy/blob/main/format_description.txt）的最小实现，
+// 仅依赖标准库，输出可被其他 snappy 实现解码
+
+const (
+    snappyTagLiteral = 0x00
+    snappyTagCopy1   = 0x01
+    snappyTagCopy2   = 0x02
+    snappyTagCopy4   = 0x03
+
+    snappyHashBits   = 14
+    snappyMinMatch   = 4
+    snappyMaxOffset  = 1 << 16
+)
+
+var errSnappyCorrupt = errors.New("snappy: corrupt input")
+
+// snappyEncode 压缩 src
+func snappyEncode(src []byte) []byte {
+    dst := make([]byte, 0, binary.MaxVarintLen64+len(src)+len(src)/6+32)
+    dst = binary.AppendUvarint(dst, uint64(len(src)))
+    if len(src) < snappyMinMatch {
+        return snappyEmitLiteral(dst, src)
+    }
+
+    var table [1 << snappyHashBits]int32
+    for i := range table {
+        table[i] = -1
+    }
+
+    lit := 0 // 尚未输出的字面量起点
+    s := 0
+    for s+snappyMinMatch <= len(src) {
+        cur := binary.LittleEndian.Uint32(src[s:])
+        h := snappyHash(cur)
+        candidate := int(table[h])
+        table[h] = int32(s)
+
+        if candidate < 0 || s-candidate >= snappyMaxOffset ||
+            binary.LittleEndian.Uint32(src[candidate:]) != cur {
+            s++
+            continue
+        }
+
+        // 找到匹配，先输出之前的字面量
+        dst = snappyEmitLiteral(dst, src[lit:s])
+
+        length := snappyMinMatch
+        for s+length < len(src) && src[candidate+length] == src[s+length] {
+            length++
+        }
+        dst = snappyEmitCopy(dst, s-candidate, length)
+
+        s += length
+        lit = s
+    }
+    return snappyEmitLiteral(dst, src[lit:])
+}
+
+// snappyDecode 解压 src，maxLen 限制解压后的长度
+func snappyDecode(src []byte, maxLen int) ([]byte, error) {
+    n, read := binary.Uvarint(src)
+    if read <= 0 || n > uint64(maxLen) {
+        return nil, errSnappyCorrupt
+    }
+    src = src[read:]
+    dst := make([]byte, 0, int(n))
+
+    for len(src) > 0 {
+        tag := src[0]
+        switch tag & 0x03 {
+        case snappyTagLiteral:
+            length := int(tag >> 2)
+            src = src[1:]
+            if length >= 60 {
+                extra := length - 59
+                if len(src) < extra {
+                    return nil, errSnappyCorrupt
+                }
+                length = 0
+                for i := extra - 1; i >= 0; i-- {
+                    length = length<<8 | int(src[i])
+                }
+                src = src[extra:]
+            }
+            length++
+            if length <= 0 || length > len(src) || len(dst)+length > int(n) {
+                return nil, errSnappyCorrupt
+            }
+            dst = append(dst, src[:length]...)
+            src = src[length:]
+            continue
+
+        case snappyTagCopy1:
+            if len(src) < 2 {
+                return nil, errSnappyCorrupt
+            }
+            length := 4 + int(tag>>2&0x07)
+            offset := int(tag&0xe0)<<3 | int(src[1])
+            src = src[2:]
+            var err error
+            if dst, err = snappyCopy(dst, offset, length, int(n)); err != nil {
+                return nil, err
+            }
+
+        case snappyTagCopy2:
+            if len(src) < 3 {
+                return nil, errSnappyCorrupt
+            }
+            length := 1 + int(tag>>2)
+            offset := int(binary.LittleEndian.Uint16(src[1:]))
+            src = src[3:]
+            var err error
+            if dst, err = snappyCopy(dst, offset, length, int(n)); err != nil {
+                return nil, err
+            }
+
+        case snappyTagCopy4:
+            if len(src) < 5 {
+                return nil, errSnappyCorrupt
+            }
+            length := 1 + int(tag>>2)
+            offset := int(binary.LittleEndian.Uint32(src[1:]))
+            src = src[5:]
+            var err error
+            if dst, err = snappyCopy(dst, offset, length, int(n)); err != nil {
+                return nil, err
+            }
+        }
+    }
+
+    if len(dst) != int(n) {
+        return nil, errSnappyCorrupt
+    }
+    return dst, nil
+}
+
+func snappyHash(u uint32) uint32 {
+    return (u * 0x1e35a7bd) >> (32 - snappyHashBits)
+}
+
+// snappyEmitLiteral 输出字面量元素
+func snappyEmitLiteral(dst, lit []byte) []byte {
+    if len(lit) == 0 {
+        return dst
+    }
+    n := len(lit) - 1
+    switch {
+    case n < 60:
+        dst = append(dst, byte(n)<<2|snappyTagLiteral)
+    case n < 1<<8:
+        dst = append(dst, 60<<2|snappyTagLiteral, byte(n))
+    case n < 1<<16:
+        dst = append(dst, 61<<2|snappyTagLiteral, byte(n), byte(n>>8))
+    case n < 1<<24:
+        dst = append(dst, 62<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16))
+    default:
+        dst = append(dst, 63<<2|snappyTagLiteral, byte(n), byte(n>>8), byte(n>>16), byte(n>>24))
+    }
+    return append(dst, lit...)
+}
+
+// snappyEmitCopy 输出复制元素，长匹配拆分为多个元素
+func snappyEmitCopy(dst []byte, offset, length int) []byte {
+    for length >= 68 {
+        dst = append(dst, 63<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+        length -= 64
+    }
+    if length > 64 {
+        dst = append(dst, 59<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+        length -= 60
+    }
+    if length < 12 && offset < 2048 {
+        return append(dst, byte(offset>>8)<<5|byte(length-4)<<2|snappyTagCopy1, byte(offset))
+    }
+    return append(dst, byte(length-1)<<2|snappyTagCopy2, byte(offset), byte(offset>>8))
+}
+
+// snappyCopy 从已解压数据中复制，允许重叠
+func snappyCopy(dst []byte, offset, length, limit int) ([]byte, error) {
+    if offset <= 0 || offset > len(dst) || len(dst)+length > limit {
+        return nil, errSnappyCorrupt
+    }
+    start := len(dst) - offset
+    for i := 0; i < length; i++ {
+        dst = append(dst, dst[start+i])
+    }
+    return dst, nil
+}
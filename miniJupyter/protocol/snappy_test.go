@@ -0,0 +1,119 @@
+package protocol
+
+import (
+	"bytes"
+	"errors"
+	"math/rand"
+	"strconv"
+	"testing"
+)
+
+func TestSnappyRoundTrip(t *testing.T) {
+    rng := rand.New(rand.NewSource(1))
+    random := make([]byte, 200000)
+    rng.Read(random)
+
+    inputs := map[string][]byte{
+        "empty":      {},
+        "short":      []byte("abc"),
+        "text":       bytes.Repeat([]byte("hello snappy "), 500),
+        "random":     random,
+        "long-run":   bytes.Repeat([]byte{'x'}, 100000),
+        "far-offset": append(append(append([]byte{}, random[:1000]...), random[:70000]...), random[:1000]...),
+    }
+    // 覆盖 1~4 字节的字面量长度编码
+    for _, n := range []int{59, 60, 61, 255, 256, 257, 65535, 65536, 65537} {
+        inputs["literal-"+strconv.Itoa(n)] = random[:n]
+    }
+
+    for name, src := range inputs {
+        encoded := snappyEncode(src)
+        decoded, err := snappyDecode(encoded, len(src))
+        if err != nil {
+            t.Fatalf("%s: decode: %v", name, err)
+        }
+        if !bytes.Equal(decoded, src) {
+            t.Fatalf("%s: round trip mismatch", name)
+        }
+    }
+}
+
+func TestSnappyDecodeReferenceStream(t *testing.T) {
+    // 由格式说明手工构造：长度 12，字面量 "abcd"，再以 offset 4 复制 8 字节（重叠复制）
+    stream := []byte{0x0c, 0x0c, 'a', 'b', 'c', 'd', 0x11, 0x04}
+    out, err := snappyDecode(stream, 64)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if string(out) != "abcdabcdabcd" {
+        t.Fatalf("got %q", out)
+    }
+
+    // 编码器不会输出 2 / 4 字节 offset 的短复制，但其他实现可能输出
+    for _, stream := range [][]byte{
+        {0x05, 0x00, 'a', 0x0e, 0x01, 0x00},
+        {0x05, 0x00, 'a', 0x0f, 0x01, 0x00, 0x00, 0x00},
+    } {
+        out, err := snappyDecode(stream, 64)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if string(out) != "aaaaa" {
+            t.Fatalf("got %q", out)
+        }
+    }
+}
+
+func TestSnappyDecodeCorrupt(t *testing.T) {
+    valid := snappyEncode(bytes.Repeat([]byte("abcdefgh"), 100))
+
+    cases := map[string][]byte{
+        "empty":              {},
+        "bad varint":         {0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff, 0xff},
+        "truncated":          valid[:len(valid)-3],
+        "literal past end":   {0x05, 0x10, 'a', 'b'},
+        "literal over size":  {0x01, 0x04, 'a', 'b'},
+        "long literal short": {0x40, 0xf0, 0x3f},
+        "offset zero":        {0x08, 0x00, 'a', 0x0d, 0x00},
+        "offset past start":  {0x08, 0x00, 'a', 0x0d, 0x05},
+        "copy over size":     {0x05, 0x00, 'a', 0x0d, 0x01},
+        "copy2 truncated":    {0x08, 0x00, 'a', 0x1e, 0x01},
+        "copy4 truncated":    {0x08, 0x00, 'a', 0x1f, 0x01, 0x00},
+        "short output":       {0x08, 0x00, 'a'},
+    }
+    for name, src := range cases {
+        if _, err := snappyDecode(src, 1<<20); !errors.Is(err, errSnappyCorrupt) {
+            t.Errorf("%s: expected corrupt input error, got %v", name, err)
+        }
+    }
+}
+
+func TestSnappyDecodeMaxLen(t *testing.T) {
+    encoded := snappyEncode(bytes.Repeat([]byte{'z'}, 4096))
+    if _, err := snappyDecode(encoded, 4095); !errors.Is(err, errSnappyCorrupt) {
+        t.Fatalf("expected size limit error, got %v", err)
+    }
+    if _, err := Decompress(CompressSnappy, encoded[:2]); !errors.Is(err, ErrDeserializeFailed) {
+        t.Fatalf("expected ErrDeserializeFailed, got %v", err)
+    }
+}
+
+func TestCompressRoundTrip(t *testing.T) {
+    data := bytes.Repeat([]byte(`{"key":"value"}`), 200)
+    for _, c := range []Compression{CompressNone, CompressGzip, CompressSnappy} {
+        packed, err := Compress(c, data)
+        if err != nil {
+            t.Fatalf("%s: %v", c, err)
+        }
+        out, err := Decompress(c, packed)
+        if err != nil {
+            t.Fatalf("%s: %v", c, err)
+        }
+        if !bytes.Equal(out, data) {
+            t.Fatalf("%s: round trip mismatch", c)
+        }
+    }
+    if _, err := Decompress(CompressGzip, []byte("not gzip")); !errors.Is(err, ErrDeserializeFailed) {
+        t.Fatalf("expected ErrDeserializeFailed, got %v", err)
+    }
+}
@@ -0,0 +1,324 @@
+package protocol
+
+import (
+	"encoding/json"
+	"sync"
+)
+
+// 状态同步消息的 method，作为 comm_msg 的 data 传输
+const (
+    SyncMethodPatch        = "patch"         // 增量更新：属主广播已接受的修改，副本提交修改请求
+    SyncMethodState        = "state"         // 全量状态
+    SyncMethodRequestState = "request_state" // 副本请求全量状态
+    SyncMethodConflict     = "conflict"      // 属主拒绝副本的修改，附带当前全量状态
+)
+
+// StateSyncMessage comm_msg 中 data 的结构
+//
+// 属主维护单调递增的 revision：
+//   - 属主修改模型后 revision + 1，发送 patch（revision 为新版本）
+//   - 副本提交 patch 时 base_revision 为其已知版本；与属主当前版本一致才被接受，
+//     接受后属主同样以 patch 回发新版本，副本收到后才应用（两端由此收敛）
+//   - base_revision 落后或补丁无法应用时属主回复 conflict，附带全量状态，副本以其覆盖本地状态
+//   - 副本收到的 revision 不连续（丢失消息）时发送 request_state，属主回复 state 重新同步
+type StateSyncMessage struct {
+    Method       string                 `json:"method"`
+    Revision     int64                  `json:"revision,omitempty"`
+    BaseRevision int64                  `json:"base_revision,omitempty"`
+    Patch        []PatchOp              `json:"patch,omitempty"`
+    State        map[string]interface{} `json:"state,omitempty"`
+    Reason       string                 `json:"reason,omitempty"` // conflict 的原因
+}
+
+// StateChangeHandler 模型状态变化时调用；full 为 true 表示全量同步（此时 ops 为 nil）
+type StateChangeHandler func(revision int64, ops []PatchOp, full bool)
+
+// StateConflictHandler 副本的修改被属主拒绝时调用，rejected 为被拒绝的操作，
+// 此时本地状态已被属主的全量状态覆盖（该状态不比本地新时保留本地状态）
+type StateConflictHandler func(rejected []PatchOp, reason string)
+
+// SyncedModel 通过 comm 同步的 JSON 对象模型，两端各持有一个：
+// 打开 comm 的 target 一端通常作为属主（kernel），另一端作为副本（前端）
+type SyncedModel struct {
+    mu         sync.Mutex
+    comm       *Comm
+    owner      bool
+    state      map[string]interface{}
+    revision   int64
+    synced     bool // 副本端是否已收到过全量状态
+    onChange   StateChangeHandler
+    onConflict StateConflictHandler
+
+    // 属主端待发送的消息，在锁内按 revision 顺序入队，由 flush 在锁外依次发出
+    outbox   []StateSyncMessage
+    flushing bool
+}
+
+// NewSyncedModelOwner 创建属主端模型，接管 comm 的 OnMsg
+func NewSyncedModelOwner(comm *Comm, initial map[string]interface{}) (*SyncedModel, error) {
+    state, err := cloneState(initial)
+    if err != nil {
+        return nil, err
+    }
+    m := &SyncedModel{comm: comm, owner: true, state: state}
+    comm.OnMsg(m.handle)
+    return m, nil
+}
+
+// NewSyncedModelReplica 创建副本端模型，接管 comm 的 OnMsg 并立即请求全量状态
+func NewSyncedModelReplica(comm *Comm) (*SyncedModel, error) {
+    m := &SyncedModel{comm: comm, state: make(map[string]interface{})}
+    comm.OnMsg(m.handle)
+    if err := m.Resync(); err != nil {
+        return nil, err
+    }
+    return m, nil
+}
+
+// OnChange 设置状态变化的回调
+func (m *SyncedModel) OnChange(handler StateChangeHandler) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.onChange = handler
+}
+
+// OnConflict 设置修改被拒绝的回调（仅副本端）
+func (m *SyncedModel) OnConflict(handler StateConflictHandler) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    m.onConflict = handler
+}
+
+// State 返回当前状态的深拷贝
+func (m *SyncedModel) State() map[string]interface{} {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    state, _ := cloneState(m.state)
+    return state
+}
+
+// Get 读取 JSON Pointer 指向的值（深拷贝）
+func (m *SyncedModel) Get(path string) (interface{}, bool) {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    v, err := pointerGet(m.state, path)
+    if err != nil {
+        return nil, false
+    }
+    v, _ = cloneJSON(v)
+    return v, true
+}
+
+// Revision 返回当前版本
+func (m *SyncedModel) Revision() int64 {
+    m.mu.Lock()
+    defer m.mu.Unlock()
+    return m.revision
+}
+
+// Set 设置顶层或嵌套字段，等同于 add 操作
+func (m *SyncedModel) Set(path string, value interface{}) error {
+    return m.Update(PatchOp{Op: PatchAdd, Path: path, Value: value})
+}
+
+// Update 修改模型：属主端立即应用并广播；副本端提交给属主，确认后才应用到本地
+func (m *SyncedModel) Update(ops ...PatchOp) error {
+    if len(ops) == 0 {
+        return nil
+    }
+    if !m.owner {
+        return m.send(StateSyncMessage{Method: SyncMethodPatch, BaseRevision: m.Revision(), Patch: ops})
+    }
+
+    m.mu.Lock()
+    revision, err := m.applyLocked(ops)
+    if err != nil {
+        m.mu.Unlock()
+        return err
+    }
+    m.outbox = append(m.outbox, StateSyncMessage{Method: SyncMethodPatch, Revision: revision, Patch: ops})
+    handler := m.onChange
+    m.mu.Unlock()
+
+    err = m.flush()
+    if handler != nil {
+        handler(revision, ops, false)
+    }
+    return err
+}
+
+// Resync 副本端请求全量状态，属主端向对端推送全量状态
+func (m *SyncedModel) Resync() error {
+    if !m.owner {
+        return m.send(StateSyncMessage{Method: SyncMethodRequestState})
+    }
+    m.mu.Lock()
+    m.outbox = append(m.outbox, m.stateMessageLocked(SyncMethodState, ""))
+    m.mu.Unlock()
+    return m.flush()
+}
+
+// applyLocked 应用补丁并递增版本，需持有锁
+func (m *SyncedModel) applyLocked(ops []PatchOp) (int64, error) {
+    doc, err := ApplyPatch(m.state, ops)
+    if err != nil {
+        return 0, err
+    }
+    state, ok := doc.(map[string]interface{})
+    if !ok {
+        return 0, ErrValidationFailed.WithDetails("model state must be a JSON object")
+    }
+    m.state = state
+    m.revision++
+    return m.revision, nil
+}
+
+// handle 处理 comm_msg
+func (m *SyncedModel) handle(comm *Comm, msg *Message) {
+    content, ok := msg.Content.(*CommMsgContent)
+    if !ok {
+        return
+    }
+    var sm StateSyncMessage
+    data, err := json.Marshal(content.Data)
+    if err != nil || json.Unmarshal(data, &sm) != nil {
+        return
+    }
+    if m.owner {
+        m.handleAsOwner(sm)
+    } else {
+        m.handleAsReplica(sm)
+    }
+}
+
+func (m *SyncedModel) handleAsOwner(sm StateSyncMessage) {
+    var revision int64
+    var handler StateChangeHandler
+    m.mu.Lock()
+    switch sm.Method {
+    case SyncMethodRequestState:
+        m.outbox = append(m.outbox, m.stateMessageLocked(SyncMethodState, ""))
+    case SyncMethodPatch:
+        if sm.BaseRevision != m.revision {
+            m.outbox = append(m.outbox, m.stateMessageLocked(SyncMethodConflict, "stale base_revision", sm.Patch...))
+            break
+        }
+        rev, err := m.applyLocked(sm.Patch)
+        if err != nil {
+            m.outbox = append(m.outbox, m.stateMessageLocked(SyncMethodConflict, err.Error(), sm.Patch...))
+            break
+        }
+        m.outbox = append(m.outbox, StateSyncMessage{Method: SyncMethodPatch, Revision: rev, BaseRevision: sm.BaseRevision, Patch: sm.Patch})
+        revision, handler = rev, m.onChange
+    }
+    m.mu.Unlock()
+
+    m.flush()
+    if handler != nil {
+        handler(revision, sm.Patch, false)
+    }
+}
+
+func (m *SyncedModel) handleAsReplica(sm StateSyncMessage) {
+    switch sm.Method {
+    case SyncMethodState, SyncMethodConflict:
+        state, err := cloneState(sm.State)
+        if err != nil {
+            return
+        }
+        m.mu.Lock()
+        // 不比本地新的全量状态是过期或重复的消息，不能让本地状态回退
+        apply := !m.synced || sm.Revision > m.revision
+        if apply {
+            m.state = state
+            m.revision = sm.Revision
+            m.synced = true
+        }
+        onChange, onConflict := m.onChange, m.onConflict
+        m.mu.Unlock()
+        if apply && onChange != nil {
+            onChange(sm.Revision, nil, true)
+        }
+        if sm.Method == SyncMethodConflict && onConflict != nil {
+            onConflict(sm.Patch, sm.Reason)
+        }
+    case SyncMethodPatch:
+        m.mu.Lock()
+        if !m.synced || sm.Revision <= m.revision {
+            // 尚未收到全量状态，或重复、过期的消息
+            m.mu.Unlock()
+            return
+        }
+        if sm.Revision != m.revision+1 {
+            m.mu.Unlock()
+            m.Resync()
+            return
+        }
+        doc, err := ApplyPatch(m.state, sm.Patch)
+        state, ok := doc.(map[string]interface{})
+        if err != nil || !ok {
+            m.mu.Unlock()
+            m.Resync()
+            return
+        }
+        m.state = state
+        m.revision = sm.Revision
+        handler := m.onChange
+        m.mu.Unlock()
+        if handler != nil {
+            handler(sm.Revision, sm.Patch, false)
+        }
+    }
+}
+
+// stateMessageLocked 生成带全量状态的消息，conflict 时附带被拒绝的操作，需持有锁
+func (m *SyncedModel) stateMessageLocked(method, reason string, rejected ...PatchOp) StateSyncMessage {
+    state, _ := cloneState(m.state)
+    return StateSyncMessage{
+        Method:   method,
+        Revision: m.revision,
+        State:    state,
+        Patch:    rejected,
+        Reason:   reason,
+    }
+}
+
+// flush 在锁外依次发出 outbox 中的消息。同一时间只有一个 goroutine 发送，保证按入队顺序发出；
+// 已有 goroutine 在发送时直接返回，新入队的消息由它发出（send 回调中再次修改模型也不会死锁）
+func (m *SyncedModel) flush() error {
+    m.mu.Lock()
+    if m.flushing {
+        m.mu.Unlock()
+        return nil
+    }
+    m.flushing = true
+    var firstErr error
+    for len(m.outbox) > 0 {
+        sm := m.outbox[0]
+        m.outbox = m.outbox[1:]
+        m.mu.Unlock()
+        if err := m.send(sm); err != nil && firstErr == nil {
+            firstErr = err
+        }
+        m.mu.Lock()
+    }
+    m.flushing = false
+    m.mu.Unlock()
+    return firstErr
+}
+
+func (m *SyncedModel) send(sm StateSyncMessage) error {
+    return m.comm.Send(sm)
+}
+
+// cloneState 深拷贝状态对象，nil 视为空对象
+func cloneState(state map[string]interface{}) (map[string]interface{}, error) {
+    if state == nil {
+        return make(map[string]interface{}), nil
+    }
+    v, err := cloneJSON(state)
+    if err != nil {
+        return nil, ErrValidationFailed.WithCause(err)
+    }
+    return v.(map[string]interface{}), nil
+}
@@ -0,0 +1,261 @@
+package protocol
+
+import (
+	"fmt"
+	"reflect"
+	"sync"
+	"testing"
+	"time"
+)
+
+// syncTestLink 通过两个 CommManager 连接属主和副本，消息在 pump 时才投递，便于控制顺序
+type syncTestLink struct {
+    frontOut, kernelOut *commRecorder
+    front, kernel       *CommManager
+    owner, replica      *SyncedModel
+}
+
+func newSyncTestLink(t *testing.T, initial map[string]interface{}) *syncTestLink {
+    t.Helper()
+    l := &syncTestLink{frontOut: &commRecorder{}, kernelOut: &commRecorder{}}
+    l.front, l.kernel = NewCommManager(l.frontOut.send), NewCommManager(l.kernelOut.send)
+    l.kernel.RegisterTarget("model", func(comm *Comm, _ *Message) error {
+        var err error
+        l.owner, err = NewSyncedModelOwner(comm, initial)
+        return err
+    })
+
+    comm, err := l.front.Open("s1", "alice", "model", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if l.replica, err = NewSyncedModelReplica(comm); err != nil {
+        t.Fatal(err)
+    }
+    l.pump(t)
+    return l
+}
+
+// pump 双向投递消息直到没有待发送的消息
+func (l *syncTestLink) pump(t *testing.T) {
+    t.Helper()
+    for {
+        toKernel, toFront := l.frontOut.take(), l.kernelOut.take()
+        if len(toKernel) == 0 && len(toFront) == 0 {
+            return
+        }
+        for _, msg := range toKernel {
+            if err := l.kernel.HandleMessage(msg); err != nil {
+                t.Fatal(err)
+            }
+        }
+        for _, msg := range toFront {
+            if err := l.front.HandleMessage(msg); err != nil {
+                t.Fatal(err)
+            }
+        }
+    }
+}
+
+// assertConverged 两端状态和版本一致
+func (l *syncTestLink) assertConverged(t *testing.T, revision int64, state string) {
+    t.Helper()
+    want := mustParseJSON(t, state)
+    for name, m := range map[string]*SyncedModel{"owner": l.owner, "replica": l.replica} {
+        if got := m.State(); !reflect.DeepEqual(got, want) {
+            t.Fatalf("%s state %v, want %v", name, got, want)
+        }
+        if got := m.Revision(); got != revision {
+            t.Fatalf("%s revision %d, want %d", name, got, revision)
+        }
+    }
+}
+
+func TestSyncedModelInitialSync(t *testing.T) {
+    l := newSyncTestLink(t, map[string]interface{}{"title": "plot", "points": []int{1, 2}})
+    l.assertConverged(t, 0, `{"title": "plot", "points": [1, 2]}`)
+
+    if v, ok := l.replica.Get("/points/1"); !ok || v != float64(2) {
+        t.Fatalf("Get(/points/1) = %v, %v", v, ok)
+    }
+    if _, ok := l.replica.Get("/missing"); ok {
+        t.Fatal("Get of a missing path succeeded")
+    }
+}
+
+func TestSyncedModelUpdates(t *testing.T) {
+    l := newSyncTestLink(t, map[string]interface{}{"count": 0})
+    var changes []string
+    l.replica.OnChange(func(revision int64, ops []PatchOp, full bool) {
+        changes = append(changes, fmt.Sprintf("%d:%d:%v", revision, len(ops), full))
+    })
+
+    // 属主的修改立即生效并广播
+    if err := l.owner.Set("/count", 1); err != nil {
+        t.Fatal(err)
+    }
+    if l.owner.Revision() != 1 || l.replica.Revision() != 0 {
+        t.Fatal("owner update not applied locally first")
+    }
+    l.pump(t)
+    l.assertConverged(t, 1, `{"count": 1}`)
+
+    // 副本的修改在属主确认后才应用到本地
+    if err := l.replica.Update(PatchOp{Op: PatchAdd, Path: "/name", Value: "x"}, PatchOp{Op: PatchRemove, Path: "/count"}); err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := l.replica.Get("/name"); ok {
+        t.Fatal("replica applied its update before the owner accepted it")
+    }
+    l.pump(t)
+    l.assertConverged(t, 2, `{"name": "x"}`)
+
+    if fmt.Sprint(changes) != "[1:1:false 2:2:false]" {
+        t.Fatalf("replica changes %v", changes)
+    }
+    if err := l.owner.Update(PatchOp{Op: PatchRemove, Path: "/missing"}); err == nil || l.owner.Revision() != 2 {
+        t.Fatalf("invalid owner update: %v, revision %d", err, l.owner.Revision())
+    }
+}
+
+func TestSyncedModelConflicts(t *testing.T) {
+    l := newSyncTestLink(t, map[string]interface{}{"count": 0})
+    var rejected []string
+    l.replica.OnConflict(func(ops []PatchOp, reason string) {
+        rejected = append(rejected, ops[0].Path+": "+reason)
+    })
+
+    // 两次修改都基于版本 0，第二次被拒绝
+    l.replica.Set("/a", 1)
+    l.replica.Set("/b", 2)
+    l.pump(t)
+    l.assertConverged(t, 1, `{"count": 0, "a": 1}`)
+
+    // 无法应用的补丁被拒绝，副本状态不变
+    l.replica.Update(PatchOp{Op: PatchReplace, Path: "/missing", Value: 1})
+    l.pump(t)
+    l.assertConverged(t, 1, `{"count": 0, "a": 1}`)
+
+    if len(rejected) != 2 || rejected[0] != "/b: stale base_revision" || rejected[1][:len("/missing: ")] != "/missing: " {
+        t.Fatalf("rejected %q", rejected)
+    }
+}
+
+func TestSyncedModelReplicaIgnoresStaleState(t *testing.T) {
+    l := newSyncTestLink(t, map[string]interface{}{"count": 0})
+    l.owner.Set("/count", 1)
+    l.owner.Set("/count", 2)
+    l.pump(t)
+
+    var full int
+    l.replica.OnChange(func(int64, []PatchOp, bool) { full++ })
+
+    // 延迟到达的旧全量状态和 conflict 不能让副本回退
+    for _, method := range []string{SyncMethodState, SyncMethodConflict} {
+        for _, revision := range []int64{1, 2} {
+            l.replica.handleAsReplica(StateSyncMessage{
+                Method:   method,
+                Revision: revision,
+                State:    map[string]interface{}{"count": 0},
+            })
+        }
+    }
+    l.assertConverged(t, 2, `{"count": 2}`)
+    if full != 0 {
+        t.Fatalf("OnChange called %d times for stale state", full)
+    }
+
+    l.replica.handleAsReplica(StateSyncMessage{Method: SyncMethodState, Revision: 3, State: map[string]interface{}{"count": 3}})
+    if got := l.replica.State(); got["count"] != float64(3) || l.replica.Revision() != 3 || full != 1 {
+        t.Fatalf("newer state not applied: %v, revision %d", got, l.replica.Revision())
+    }
+}
+
+func TestSyncedModelResyncAfterGap(t *testing.T) {
+    l := newSyncTestLink(t, map[string]interface{}{"count": 0})
+    l.owner.Set("/count", 1)
+    l.owner.Set("/count", 2)
+
+    // 丢失 revision 1 的 patch，副本收到 revision 2 后请求全量状态
+    sent := l.kernelOut.take()
+    if len(sent) != 2 {
+        t.Fatalf("owner sent %d messages", len(sent))
+    }
+    if err := l.front.HandleMessage(sent[1]); err != nil {
+        t.Fatal(err)
+    }
+    if l.replica.Revision() != 0 {
+        t.Fatal("replica applied a patch after a gap")
+    }
+    l.pump(t)
+    l.assertConverged(t, 2, `{"count": 2}`)
+}
+
+func TestSyncedModelSynchronousTransport(t *testing.T) {
+    // send 中直接调用对端的 HandleMessage：属主不能在发送时持有锁，否则回环的消息会死锁
+    var front, kernel *CommManager
+    front = NewCommManager(func(msg *Message) error { return kernel.HandleMessage(msg) })
+    kernel = NewCommManager(func(msg *Message) error { return front.HandleMessage(msg) })
+    var owner *SyncedModel
+    kernel.RegisterTarget("model", func(comm *Comm, _ *Message) error {
+        var err error
+        owner, err = NewSyncedModelOwner(comm, map[string]interface{}{"items": []interface{}{}})
+        return err
+    })
+
+    comm, err := front.Open("s1", "alice", "model", nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    replica, err := NewSyncedModelReplica(comm)
+    if err != nil {
+        t.Fatal(err)
+    }
+    // 副本在回调中修改模型，修改请求在属主发送 patch 的过程中到达属主
+    replica.OnChange(func(revision int64, ops []PatchOp, full bool) {
+        if !full && ops[0].Path == "/ping" {
+            replica.Set("/pong", revision)
+        }
+    })
+
+    done := make(chan struct{})
+    go func() {
+        defer close(done)
+        if err := owner.Set("/ping", true); err != nil {
+            t.Error(err)
+        }
+        if v, ok := replica.Get("/pong"); !ok || v != float64(1) {
+            t.Errorf("pong = %v, %v", v, ok)
+        }
+
+        var wg sync.WaitGroup
+        for i := 0; i < 4; i++ {
+            wg.Add(2)
+            go func(i int) {
+                defer wg.Done()
+                for j := 0; j < 25; j++ {
+                    owner.Set("/items/-", fmt.Sprintf("owner-%d-%d", i, j))
+                }
+            }(i)
+            go func(i int) {
+                defer wg.Done()
+                for j := 0; j < 25; j++ {
+                    replica.Set("/items/-", fmt.Sprintf("replica-%d-%d", i, j))
+                }
+            }(i)
+        }
+        wg.Wait()
+    }()
+    select {
+    case <-done:
+    case <-time.After(10 * time.Second):
+        t.Fatal("state sync deadlocked on a synchronous transport")
+    }
+
+    if owner.Revision() < 102 || replica.Revision() != owner.Revision() {
+        t.Fatalf("owner revision %d, replica revision %d", owner.Revision(), replica.Revision())
+    }
+    if !reflect.DeepEqual(owner.State(), replica.State()) {
+        t.Fatal("owner and replica diverged")
+    }
+}
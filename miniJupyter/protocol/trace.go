@@ -1,16 +1,33 @@
 package protocol
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"encoding/json"
+	"fmt"
+	"strings"
+	"sync"
 	"time"
 )
 
 // MessageTrace 定义消息追踪结构
+//
+// 同一条追踪可被多个 goroutine 同时使用：AddHop、MessageHop.Complete 等方法通过追踪内部的锁串行化，
+// AddHop 返回的 *MessageHop 在后续添加节点后依然有效
+//
+// Hops 按添加顺序保存，节点之间通过 SpanId / ParentSpanId 组成一棵树，
+// 一个请求被并行分发到多个服务时，各服务的节点共享同一个父节点
 type MessageTrace struct {
-    TraceId    string       `json:"trace_id"`     // 追踪ID
-    StartTime  time.Time    `json:"start_time"`   // 消息创建时间
-    Hops       []MessageHop `json:"hops"`         // 消息经过的服务节点
-    TotalTime  Duration     `json:"total_time"`   // 总处理时间
+    mu         sync.Mutex
+    TraceId    string        `json:"trace_id"`     // 追踪ID
+    StartTime  time.Time     `json:"start_time"`   // 消息创建时间
+    Hops       []*MessageHop `json:"hops"`         // 消息经过的服务节点
+    TotalTime  Duration      `json:"total_time"`   // 总处理时间
+
+    // W3C Trace Context，从 traceparent 延续追踪时设置
+    ParentSpanId string `json:"parent_span_id,omitempty"` // 上游（如 HTTP 网关）的节点ID，根节点以其为父节点
+    TraceFlags   string `json:"trace_flags,omitempty"`    // 2 位十六进制标志，为空视为 "01"（已采样）
+    TraceState   string `json:"trace_state,omitempty"`    // tracestate 原文，原样向下游传递
 }
 
 // MessageHop 定义消息经过的每个服务节点信息
@@ -23,6 +40,10 @@ type MessageHop struct {
     Duration    Duration  `json:"duration"`      // 处理耗时
     Status      string    `json:"status"`       // 处理状态
     Error       string    `json:"error,omitempty"` // 错误信息（如果有）
+    SpanId       string   `json:"span_id"`                  // 节点ID，16 位十六进制
+    ParentSpanId string   `json:"parent_span_id,omitempty"` // 父节点ID，为空表示根节点
+
+    trace *MessageTrace // 所属追踪，Complete 时借用其锁
 }
 
 // Duration 自定义时间类型，支持更友好的JSON序列化
@@ -52,24 +73,117 @@ func NewMessageTrace() *MessageTrace {
     return &MessageTrace{
         TraceId:   GenerateUUID(),
         StartTime: time.Now(),
-        Hops:      make([]MessageHop, 0),
+        Hops:      make([]*MessageHop, 0),
+    }
+}
+
+// MarshalJSON 在锁内序列化，避免与并发的 AddHop / Complete 交错
+func (mt *MessageTrace) MarshalJSON() ([]byte, error) {
+    type plain MessageTrace
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    return json.Marshal((*plain)(mt))
+}
+
+// UnmarshalJSON 反序列化后将各节点关联到本追踪
+func (mt *MessageTrace) UnmarshalJSON(b []byte) error {
+    type plain MessageTrace
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    if err := json.Unmarshal(b, (*plain)(mt)); err != nil {
+        return err
+    }
+    if mt.Hops == nil {
+        mt.Hops = make([]*MessageHop, 0)
+    }
+    for _, hop := range mt.Hops {
+        hop.trace = mt
     }
+    return nil
+}
+
+// Clone 深拷贝追踪信息，用于在新消息中延续同一条追踪
+func (mt *MessageTrace) Clone() *MessageTrace {
+    if mt == nil {
+        return nil
+    }
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    clone := &MessageTrace{
+        TraceId:   mt.TraceId,
+        StartTime: mt.StartTime,
+        Hops:      make([]*MessageHop, 0, len(mt.Hops)),
+        TotalTime: mt.TotalTime,
+
+        ParentSpanId: mt.ParentSpanId,
+        TraceFlags:   mt.TraceFlags,
+        TraceState:   mt.TraceState,
+    }
+    for _, hop := range mt.Hops {
+        h := *hop
+        h.trace = clone
+        clone.Hops = append(clone.Hops, &h)
+    }
+    return clone
 }
 
-// AddHop 添加一个服务节点
+// AddHop 添加一个根节点，返回的节点在追踪后续变化时保持有效
 func (mt *MessageTrace) AddHop(serviceId, serviceName, hostName string) *MessageHop {
-    hop := MessageHop{
+    return mt.StartChildHop(nil, serviceId, serviceName, hostName)
+}
+
+// LastHop 返回最后添加的节点，没有节点时返回 nil
+func (mt *MessageTrace) LastHop() *MessageHop {
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    if len(mt.Hops) == 0 {
+        return nil
+    }
+    return mt.Hops[len(mt.Hops)-1]
+}
+
+// StartChildHop 在 parent 下添加一个子节点，parent 为 nil 时添加根节点
+func (mt *MessageTrace) StartChildHop(parent *MessageHop, serviceId, serviceName, hostName string) *MessageHop {
+    hop := &MessageHop{
         ServiceId:   serviceId,
         ServiceName: serviceName,
         HostName:    hostName,
         EntryTime:   time.Now(),
+        SpanId:      GenerateSpanId(),
+        trace:       mt,
+    }
+    mt.mu.Lock()
+    if parent != nil {
+        hop.ParentSpanId = parent.SpanId
+    } else {
+        hop.ParentSpanId = mt.ParentSpanId
     }
     mt.Hops = append(mt.Hops, hop)
-    return &mt.Hops[len(mt.Hops)-1]
+    mt.mu.Unlock()
+    return hop
+}
+
+// StartChild 在当前节点下添加子节点，节点不属于任何追踪时返回 nil
+func (h *MessageHop) StartChild(serviceId, serviceName, hostName string) *MessageHop {
+    if h.trace == nil {
+        return nil
+    }
+    return h.trace.StartChildHop(h, serviceId, serviceName, hostName)
+}
+
+// GenerateSpanId 生成 8 字节随机节点ID（16 位十六进制），可直接用作 W3C traceparent 的 parent-id
+func GenerateSpanId() string {
+    bytes := make([]byte, 8)
+    rand.Read(bytes)
+    return hex.EncodeToString(bytes)
 }
 
 // CompleteHop 完成当前服务节点的处理
 func (h *MessageHop) Complete(status string, err error) {
+    if h.trace != nil {
+        h.trace.mu.Lock()
+        defer h.trace.mu.Unlock()
+    }
     h.ExitTime = time.Now()
     h.Duration = Duration(h.ExitTime.Sub(h.EntryTime))
     h.Status = status
@@ -78,30 +192,203 @@ func (h *MessageHop) Complete(status string, err error) {
     }
 }
 
-// CalculateTotalTime 计算消息总处理时间
+// IsComplete 节点是否已调用 Complete
+func (h *MessageHop) IsComplete() bool {
+    if h.trace != nil {
+        h.trace.mu.Lock()
+        defer h.trace.mu.Unlock()
+    }
+    return !h.ExitTime.IsZero()
+}
+
+// CalculateTotalTime 计算消息总处理时间：从最早进入的节点到最晚离开的节点，
+// 未完成的节点只计入其进入时间
 func (mt *MessageTrace) CalculateTotalTime() {
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
     if len(mt.Hops) == 0 {
         mt.TotalTime = 0
         return
     }
-    
-    firstHop := mt.Hops[0]
-    lastHop := mt.Hops[len(mt.Hops)-1]
-    mt.TotalTime = Duration(lastHop.ExitTime.Sub(firstHop.EntryTime))
+
+    start, end := mt.Hops[0].EntryTime, mt.Hops[0].EntryTime
+    for _, hop := range mt.Hops {
+        if hop.EntryTime.Before(start) {
+            start = hop.EntryTime
+        }
+        last := hop.EntryTime
+        if hop.ExitTime.After(last) {
+            last = hop.ExitTime
+        }
+        if last.After(end) {
+            end = last
+        }
+    }
+    mt.TotalTime = Duration(end.Sub(start))
 }
 
-// GetHopByService 获取指定服务的处理信息
+// GetHopByService 获取指定服务最近一次的处理信息
 func (mt *MessageTrace) GetHopByService(serviceName string) *MessageHop {
-    for i := range mt.Hops {
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    for i := len(mt.Hops) - 1; i >= 0; i-- {
         if mt.Hops[i].ServiceName == serviceName {
-            return &mt.Hops[i]
+            return mt.Hops[i]
         }
     }
     return nil
 }
 
-// String 实现消息追踪的字符串表示
+// GetHopsByService 按添加顺序获取指定服务的所有处理信息
+func (mt *MessageTrace) GetHopsByService(serviceName string) []*MessageHop {
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    var hops []*MessageHop
+    for _, hop := range mt.Hops {
+        if hop.ServiceName == serviceName {
+            hops = append(hops, hop)
+        }
+    }
+    return hops
+}
+
+// Roots 返回根节点；父节点不在本追踪中的节点也视为根节点
+func (mt *MessageTrace) Roots() []*MessageHop {
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    return mt.children("")
+}
+
+// Children 返回指定节点的直接子节点
+func (mt *MessageTrace) Children(hop *MessageHop) []*MessageHop {
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    return mt.children(hop.SpanId)
+}
+
+// children 需持有锁，parentSpanId 为空时返回根节点
+func (mt *MessageTrace) children(parentSpanId string) []*MessageHop {
+    var known map[string]bool
+    if parentSpanId == "" {
+        known = make(map[string]bool, len(mt.Hops))
+        for _, hop := range mt.Hops {
+            known[hop.SpanId] = true
+        }
+    }
+    var hops []*MessageHop
+    for _, hop := range mt.Hops {
+        if parentSpanId == "" {
+            if hop.ParentSpanId == "" || !known[hop.ParentSpanId] {
+                hops = append(hops, hop)
+            }
+        } else if hop.ParentSpanId == parentSpanId {
+            hops = append(hops, hop)
+        }
+    }
+    return hops
+}
+
+// CriticalPath 返回决定总耗时的节点链（按时间先后）
+//
+// 在同一父节点下，从最晚结束的子节点开始，逐个向前寻找在其开始前已结束的兄弟节点；
+// 每个选中的节点之后紧跟其子节点中的关键路径。并行分支中只有最慢的一支会出现在结果中
+func (mt *MessageTrace) CriticalPath() []*MessageHop {
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    return mt.criticalPath(mt.children(""), make(map[string]bool))
+}
+
+// criticalPath 需持有锁。expanded 记录已展开过子节点的 span_id，
+// 重复或自引用的 span_id 只展开一次，避免无限递归
+func (mt *MessageTrace) criticalPath(siblings []*MessageHop, expanded map[string]bool) []*MessageHop {
+    var segments [][]*MessageHop
+    var limit time.Time
+    bounded := false
+    for len(siblings) > 0 {
+        var last *MessageHop
+        for _, hop := range siblings {
+            end := hop.endTime()
+            if bounded && end.After(limit) {
+                continue
+            }
+            if last == nil || end.After(last.endTime()) {
+                last = hop
+            }
+        }
+        if last == nil {
+            break
+        }
+        segment := []*MessageHop{last}
+        if last.SpanId != "" && !expanded[last.SpanId] {
+            expanded[last.SpanId] = true
+            segment = append(segment, mt.criticalPath(mt.children(last.SpanId), expanded)...)
+        }
+        segments = append(segments, segment)
+        limit, bounded = last.EntryTime, true
+        // 防止零耗时节点被重复选中
+        siblings = removeHop(siblings, last)
+    }
+
+    var path []*MessageHop
+    for i := len(segments) - 1; i >= 0; i-- {
+        path = append(path, segments[i]...)
+    }
+    return path
+}
+
+// endTime 节点结束时间，未完成的节点取进入时间
+func (h *MessageHop) endTime() time.Time {
+    if h.ExitTime.IsZero() {
+        return h.EntryTime
+    }
+    return h.ExitTime
+}
+
+func removeHop(hops []*MessageHop, target *MessageHop) []*MessageHop {
+    out := make([]*MessageHop, 0, len(hops))
+    for _, hop := range hops {
+        if hop != target {
+            out = append(out, hop)
+        }
+    }
+    return out
+}
+
+// String 以树形展示追踪信息，例如：
+//
+//  trace 3f2a... (total 12ms)
+//  └─ core [core-1@host-a] ok 12ms
+//     ├─ svc-a [a-1@host-b] ok 4ms
+//     └─ svc-b [b-1@host-c] running
 func (mt *MessageTrace) String() string {
-    data, _ := json.MarshalIndent(mt, "", "  ")
-    return string(data)
-}
\ No newline at end of file
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    var sb strings.Builder
+    fmt.Fprintf(&sb, "trace %s (total %s)\n", mt.TraceId, time.Duration(mt.TotalTime))
+    mt.writeTree(&sb, mt.children(""), "", make(map[string]bool))
+    return sb.String()
+}
+
+// writeTree 需持有锁，expanded 的作用同 criticalPath
+func (mt *MessageTrace) writeTree(sb *strings.Builder, hops []*MessageHop, indent string, expanded map[string]bool) {
+    for i, hop := range hops {
+        branch, next := "├─ ", "│  "
+        if i == len(hops)-1 {
+            branch, next = "└─ ", "   "
+        }
+        fmt.Fprintf(sb, "%s%s%s [%s@%s]", indent, branch, hop.ServiceName, hop.ServiceId, hop.HostName)
+        if hop.ExitTime.IsZero() {
+            sb.WriteString(" running")
+        } else {
+            fmt.Fprintf(sb, " %s %s", hop.Status, time.Duration(hop.Duration))
+        }
+        if hop.Error != "" {
+            fmt.Fprintf(sb, " error=%q", hop.Error)
+        }
+        sb.WriteString("\n")
+        if hop.SpanId != "" && !expanded[hop.SpanId] {
+            expanded[hop.SpanId] = true
+            mt.writeTree(sb, mt.children(hop.SpanId), indent+next, expanded)
+        }
+    }
+}
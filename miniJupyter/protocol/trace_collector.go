@@ -0,0 +1,233 @@
+package protocol
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// TraceTopic 节点发布 trace_report 使用的 PUB/SUB 主题（system.* 仅 admin 可订阅）
+const TraceTopic = "system.trace"
+
+// DefaultTraceSamples 每个服务保留的最近节点耗时样本数
+const DefaultTraceSamples = 1024
+
+// TraceCollector 汇总各节点发布的已完成追踪，按 ServiceName 统计节点耗时分位数和错误率
+//
+// Count / Errors 为累计值；分位数基于每个服务最近 maxSamples 个节点。
+// 同一节点可能出现在多份上报中（应答会延续请求的追踪），按 span_id 去重，追踪数按 trace_id 去重
+type TraceCollector struct {
+    mu         sync.Mutex
+    maxSamples int
+    traces     int
+    services   map[string]*serviceSamples
+    seenSpans  recentSet // 已统计的 span_id
+    seenTraces recentSet // 已统计的 trace_id，最多保留 maxSamples 个
+}
+
+// recentSet 最近出现过的 ID，超出上限时淘汰最早加入的
+type recentSet struct {
+    ids   map[string]struct{}
+    order []string
+}
+
+// add 加入 id，已存在时返回 false
+func (s *recentSet) add(id string, limit int) bool {
+    if _, ok := s.ids[id]; ok {
+        return false
+    }
+    if s.ids == nil {
+        s.ids = make(map[string]struct{})
+    }
+    s.ids[id] = struct{}{}
+    s.order = append(s.order, id)
+    for len(s.order) > limit {
+        delete(s.ids, s.order[0])
+        s.order = s.order[1:]
+    }
+    return true
+}
+
+// serviceSamples 单个服务的统计数据，durations 为环形缓冲区
+type serviceSamples struct {
+    count     int
+    errors    int
+    durations []time.Duration
+    next      int
+}
+
+// NewTraceCollector 创建追踪收集器
+func NewTraceCollector() *TraceCollector {
+    return &TraceCollector{
+        maxSamples: DefaultTraceSamples,
+        services:   make(map[string]*serviceSamples),
+    }
+}
+
+// WithMaxSamples 设置每个服务保留的样本数
+func (c *TraceCollector) WithMaxSamples(n int) *TraceCollector {
+    if n > 0 {
+        c.maxSamples = n
+    }
+    return c
+}
+
+// Collect 统计追踪中已完成的节点，未完成的节点被忽略
+func (c *TraceCollector) Collect(trace *MessageTrace) {
+    if trace == nil {
+        return
+    }
+    trace.mu.Lock()
+    traceId := trace.TraceId
+    hops := make([]MessageHop, 0, len(trace.Hops))
+    for _, hop := range trace.Hops {
+        if !hop.ExitTime.IsZero() {
+            hops = append(hops, *hop)
+        }
+    }
+    trace.mu.Unlock()
+
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    if traceId == "" || c.seenTraces.add(traceId, c.maxSamples) {
+        c.traces++
+    }
+    for i := range hops {
+        hop := &hops[i]
+        if hop.SpanId != "" && !c.seenSpans.add(hop.SpanId, c.spanLimit()) {
+            continue
+        }
+        s, ok := c.services[hop.ServiceName]
+        if !ok {
+            s = &serviceSamples{}
+            c.services[hop.ServiceName] = s
+        }
+        s.count++
+        if hop.Error != "" {
+            s.errors++
+        }
+        if len(s.durations) < c.maxSamples {
+            s.durations = append(s.durations, time.Duration(hop.Duration))
+        } else {
+            s.durations[s.next] = time.Duration(hop.Duration)
+            s.next = (s.next + 1) % len(s.durations)
+        }
+    }
+}
+
+// spanLimit 记录的 span_id 上限，为 maxSamples 倍服务数（至少 maxSamples），需持有锁
+func (c *TraceCollector) spanLimit() int {
+    if limit := c.maxSamples * len(c.services); limit > c.maxSamples {
+        return limit
+    }
+    return c.maxSamples
+}
+
+// Stats 返回指定服务的统计（按服务名称排序），不指定时返回全部服务；未出现过的服务被忽略
+func (c *TraceCollector) Stats(services ...string) []ServiceStats {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+
+    names := append([]string(nil), services...)
+    if len(names) == 0 {
+        names = make([]string, 0, len(c.services))
+        for name := range c.services {
+            names = append(names, name)
+        }
+    }
+    sort.Strings(names)
+
+    stats := make([]ServiceStats, 0, len(names))
+    for _, name := range names {
+        s, ok := c.services[name]
+        if !ok {
+            continue
+        }
+        sorted := append([]time.Duration(nil), s.durations...)
+        sort.Slice(sorted, func(i, j int) bool { return sorted[i] < sorted[j] })
+        st := ServiceStats{
+            ServiceName: name,
+            Count:       s.count,
+            Errors:      s.errors,
+            P50:         Duration(percentile(sorted, 50)),
+            P95:         Duration(percentile(sorted, 95)),
+            P99:         Duration(percentile(sorted, 99)),
+        }
+        if len(sorted) > 0 {
+            st.Max = Duration(sorted[len(sorted)-1])
+        }
+        if s.count > 0 {
+            st.ErrorRate = float64(s.errors) / float64(s.count)
+        }
+        stats = append(stats, st)
+    }
+    return stats
+}
+
+// TraceCount 返回已收集的不同追踪数，同一追踪的多份上报只计一次
+func (c *TraceCollector) TraceCount() int {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    return c.traces
+}
+
+// Reset 清空所有统计
+func (c *TraceCollector) Reset() {
+    c.mu.Lock()
+    defer c.mu.Unlock()
+    c.traces = 0
+    c.services = make(map[string]*serviceSamples)
+    c.seenSpans = recentSet{}
+    c.seenTraces = recentSet{}
+}
+
+// HandleMessage 处理 trace_report 和 trace_stats_request：
+// trace_report 被统计后返回 nil，trace_stats_request 返回 trace_stats_reply，其他类型返回错误
+func (c *TraceCollector) HandleMessage(msg *Message) (*Message, error) {
+    switch msg.Header.MsgType {
+    case MsgTypeTraceReport:
+        report, ok := msg.Content.(*TraceReportContent)
+        if !ok {
+            return nil, ErrValidationFailed.WithDetails("unexpected content for trace_report")
+        }
+        c.Collect(report.Trace)
+        return nil, nil
+    case MsgTypeTraceStatsRequest:
+        var services []string
+        if req, ok := msg.Content.(*TraceStatsRequestContent); ok {
+            services = req.Services
+        }
+        return NewReplyBuilder(msg).
+            WithContent(&TraceStatsReplyContent{
+                Status:   StatusOK,
+                Traces:   c.TraceCount(),
+                Services: c.Stats(services...),
+            }).
+            Build()
+    default:
+        return nil, ErrInvalidMessageType.WithDetails(msg.Header.MsgType)
+    }
+}
+
+// NewTraceReport 创建发布到 TraceTopic 的 trace_report 消息，追踪本身放在 content 中
+func NewTraceReport(sessionId, userId string, trace *MessageTrace) (*Message, error) {
+    return NewMessageBuilder().
+        WithType(MsgTypeTraceReport).
+        WithSession(sessionId).
+        WithUser(userId).
+        WithTransport(TransportZMQ).
+        WithContent(&TraceReportContent{Trace: trace}).
+        Build()
+}
+
+// percentile 最近秩法计算分位数，sorted 需已升序排列
+func percentile(sorted []time.Duration, p int) time.Duration {
+    if len(sorted) == 0 {
+        return 0
+    }
+    rank := (p*len(sorted) + 99) / 100
+    if rank < 1 {
+        rank = 1
+    }
+    return sorted[rank-1]
+}
@@ -0,0 +1,193 @@
+package protocol
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// newTestCollectorTrace 构造已完成的追踪，durations 为 db 节点的耗时（毫秒），负数表示失败
+func newTestCollectorTrace(traceId string, durations ...int) *MessageTrace {
+    start := time.Unix(1700000000, 0)
+    trace := &MessageTrace{TraceId: traceId, StartTime: start}
+    for i, ms := range durations {
+        hop := &MessageHop{
+            ServiceName: "db",
+            SpanId:      fmt.Sprintf("%s-%d", traceId, i),
+            EntryTime:   start,
+            Status:      string(StatusOK),
+            trace:       trace,
+        }
+        if ms < 0 {
+            ms = -ms
+            hop.Status, hop.Error = string(StatusError), "failed"
+        }
+        hop.Duration = Duration(time.Duration(ms) * time.Millisecond)
+        hop.ExitTime = start.Add(time.Duration(hop.Duration))
+        trace.Hops = append(trace.Hops, hop)
+    }
+    return trace
+}
+
+func TestTraceCollectorStats(t *testing.T) {
+    c := NewTraceCollector()
+    durations := make([]int, 0, 100)
+    for ms := 1; ms <= 100; ms++ {
+        if ms%10 == 0 {
+            durations = append(durations, -ms)
+        } else {
+            durations = append(durations, ms)
+        }
+    }
+    c.Collect(newTestCollectorTrace("t1", durations...))
+
+    // 未完成的节点不计入
+    unfinished := NewMessageTrace()
+    unfinished.AddHop("cache-1", "cache", "localhost")
+    c.Collect(unfinished)
+    c.Collect(nil)
+
+    stats := c.Stats()
+    if len(stats) != 1 {
+        t.Fatalf("got %d services, want 1: %+v", len(stats), stats)
+    }
+    want := ServiceStats{
+        ServiceName: "db",
+        Count:       100,
+        Errors:      10,
+        ErrorRate:   0.1,
+        P50:         Duration(50 * time.Millisecond),
+        P95:         Duration(95 * time.Millisecond),
+        P99:         Duration(99 * time.Millisecond),
+        Max:         Duration(100 * time.Millisecond),
+    }
+    if stats[0] != want {
+        t.Fatalf("got %+v, want %+v", stats[0], want)
+    }
+    if got := c.TraceCount(); got != 2 {
+        t.Fatalf("TraceCount() = %d, want 2", got)
+    }
+}
+
+func TestTraceCollectorDeduplicates(t *testing.T) {
+    c := NewTraceCollector()
+
+    // 应答延续请求的追踪：同一追踪的两份上报只计一次，重复的节点也只统计一次
+    request := newTestCollectorTrace("t1", 10)
+    reply := request.Clone()
+    reply.Hops = append(reply.Hops, newTestCollectorTrace("t1-reply", 20).Hops...)
+    c.Collect(request)
+    c.Collect(reply)
+    c.Collect(newTestCollectorTrace("t2", 30))
+
+    if got := c.TraceCount(); got != 2 {
+        t.Fatalf("TraceCount() = %d, want 2", got)
+    }
+    if stats := c.Stats("db"); len(stats) != 1 || stats[0].Count != 3 {
+        t.Fatalf("stats %+v, want 3 db hops", stats)
+    }
+
+    c.Reset()
+    if c.TraceCount() != 0 || len(c.Stats()) != 0 {
+        t.Fatal("Reset did not clear the collector")
+    }
+    c.Collect(request)
+    if c.TraceCount() != 1 || c.Stats()[0].Count != 1 {
+        t.Fatal("trace seen before Reset was not counted again")
+    }
+}
+
+func TestTraceCollectorMaxSamples(t *testing.T) {
+    c := NewTraceCollector().WithMaxSamples(2)
+    c.Collect(newTestCollectorTrace("t1", 100, 1, 2))
+
+    stats := c.Stats()[0]
+    // Count 为累计值，分位数只基于最近 2 个样本
+    if stats.Count != 3 || stats.Max != Duration(2*time.Millisecond) || stats.P50 != Duration(time.Millisecond) {
+        t.Fatalf("unexpected stats %+v", stats)
+    }
+
+    // 超出上限后最早的 trace_id 被淘汰，再次上报时重新计数
+    c.Collect(newTestCollectorTrace("t2"))
+    c.Collect(newTestCollectorTrace("t3"))
+    c.Collect(newTestCollectorTrace("t1"))
+    if got := c.TraceCount(); got != 4 {
+        t.Fatalf("TraceCount() = %d, want 4", got)
+    }
+}
+
+func TestTraceCollectorStatsFilter(t *testing.T) {
+    c := NewTraceCollector()
+    trace := newTestCollectorTrace("t1", 10)
+    for _, name := range []string{"core", "cache"} {
+        hop := trace.AddHop(name+"-1", name, "localhost")
+        hop.Complete(string(StatusOK), nil)
+    }
+    c.Collect(trace)
+
+    names := func(stats []ServiceStats) string {
+        var out []string
+        for _, s := range stats {
+            out = append(out, s.ServiceName)
+        }
+        return fmt.Sprint(out)
+    }
+    if got := names(c.Stats()); got != "[cache core db]" {
+        t.Fatalf("Stats() = %s", got)
+    }
+    if got := names(c.Stats("db", "missing", "core")); got != "[core db]" {
+        t.Fatalf("Stats(db, missing, core) = %s", got)
+    }
+}
+
+func TestTraceCollectorHandleMessage(t *testing.T) {
+    c := NewTraceCollector()
+
+    // trace_report 经过序列化后交给收集器
+    report, err := NewTraceReport("s1", "admin", newTestCollectorTrace("t1", 10, -20))
+    if err != nil {
+        t.Fatal(err)
+    }
+    data, err := SerializeMessage(report)
+    if err != nil {
+        t.Fatal(err)
+    }
+    parsed, err := ParseMessage(data)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if reply, err := c.HandleMessage(parsed); err != nil || reply != nil {
+        t.Fatalf("trace_report: %v, %v", reply, err)
+    }
+
+    req, err := NewMessageBuilder().
+        WithType(MsgTypeTraceStatsRequest).
+        WithSession("s1").
+        WithUser("admin").
+        WithTransport(TransportZMQ).
+        WithContent(&TraceStatsRequestContent{Services: []string{"db"}}).
+        Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    reply, err := c.HandleMessage(req)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if reply.Header.MsgType != MsgTypeTraceStatsReply || reply.ParentHeader.MsgId != req.Header.MsgId {
+        t.Fatalf("reply header %+v", reply.Header)
+    }
+    stats, ok := reply.Content.(*TraceStatsReplyContent)
+    if !ok || stats.Status != StatusOK || stats.Traces != 1 || len(stats.Services) != 1 || stats.Services[0].Errors != 1 {
+        t.Fatalf("reply content %+v", reply.Content)
+    }
+
+    report.Content = &ExecuteReplyContent{}
+    if _, err := c.HandleMessage(report); !errors.Is(err, ErrValidationFailed) {
+        t.Fatalf("trace_report with wrong content: %v", err)
+    }
+    if _, err := c.HandleMessage(newTestExecuteRequest(t, EncryptionNone, CompressNone)); !errors.Is(err, ErrInvalidMessageType) {
+        t.Fatalf("execute_request: %v", err)
+    }
+}
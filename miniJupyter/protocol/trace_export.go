@@ -0,0 +1,202 @@
+package protocol
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// 离线查看追踪：导出为 Chrome trace-event（chrome://tracing、Perfetto）或 Jaeger UI 可导入的 JSON。
+// 两种格式都以 EntryTime / ExitTime 作为节点的起止时间，未完成的节点耗时为 0
+
+// chromeTraceFile Chrome trace-event JSON Object Format
+type chromeTraceFile struct {
+    TraceEvents     []chromeTraceEvent `json:"traceEvents"`
+    DisplayTimeUnit string             `json:"displayTimeUnit"`
+}
+
+// chromeTraceEvent 时间单位为微秒
+type chromeTraceEvent struct {
+    Name string                 `json:"name"`
+    Cat  string                 `json:"cat,omitempty"`
+    Ph   string                 `json:"ph"`
+    Ts   int64                  `json:"ts"`
+    Dur  int64                  `json:"dur,omitempty"`
+    Pid  int                    `json:"pid"`
+    Tid  int                    `json:"tid"`
+    Args map[string]interface{} `json:"args,omitempty"`
+}
+
+// WriteChromeTrace 将追踪写为 Chrome trace-event JSON：每个 HostName 是一个进程，
+// 其中每个 ServiceName 是一个线程，每个节点是一个完整事件（ph = "X"）
+func WriteChromeTrace(w io.Writer, traces ...*MessageTrace) error {
+    file := chromeTraceFile{TraceEvents: make([]chromeTraceEvent, 0), DisplayTimeUnit: "ms"}
+    pids := make(map[string]int)
+    tids := make(map[[2]string]int)
+
+    for _, mt := range traces {
+        if mt == nil {
+            continue
+        }
+        mt.mu.Lock()
+        for _, hop := range mt.Hops {
+            pid, ok := pids[hop.HostName]
+            if !ok {
+                pid = len(pids) + 1
+                pids[hop.HostName] = pid
+                file.TraceEvents = append(file.TraceEvents, chromeTraceEvent{
+                    Name: "process_name", Ph: "M", Pid: pid,
+                    Args: map[string]interface{}{"name": hop.HostName},
+                })
+            }
+            key := [2]string{hop.HostName, hop.ServiceName}
+            tid, ok := tids[key]
+            if !ok {
+                tid = len(tids) + 1
+                tids[key] = tid
+                file.TraceEvents = append(file.TraceEvents, chromeTraceEvent{
+                    Name: "thread_name", Ph: "M", Pid: pid, Tid: tid,
+                    Args: map[string]interface{}{"name": hop.ServiceName},
+                })
+            }
+
+            args := map[string]interface{}{
+                "trace_id":   mt.TraceId,
+                "span_id":    hop.SpanId,
+                "service_id": hop.ServiceId,
+                "status":     hop.Status,
+            }
+            if hop.ParentSpanId != "" {
+                args["parent_span_id"] = hop.ParentSpanId
+            }
+            if hop.Error != "" {
+                args["error"] = hop.Error
+            }
+            file.TraceEvents = append(file.TraceEvents, chromeTraceEvent{
+                Name: hop.ServiceName,
+                Cat:  mt.TraceId,
+                Ph:   "X",
+                Ts:   hop.EntryTime.UnixMicro(),
+                Dur:  hop.endTime().Sub(hop.EntryTime).Microseconds(),
+                Pid:  pid,
+                Tid:  tid,
+                Args: args,
+            })
+        }
+        mt.mu.Unlock()
+    }
+    return writeTraceJSON(w, file)
+}
+
+// jaegerTraceFile Jaeger UI「JSON File」导入格式（与 /api/traces 的响应一致）
+type jaegerTraceFile struct {
+    Data []jaegerTrace `json:"data"`
+}
+
+type jaegerTrace struct {
+    TraceID   string                   `json:"traceID"`
+    Spans     []jaegerSpan             `json:"spans"`
+    Processes map[string]jaegerProcess `json:"processes"`
+}
+
+// jaegerSpan 时间单位为微秒
+type jaegerSpan struct {
+    TraceID       string            `json:"traceID"`
+    SpanID        string            `json:"spanID"`
+    OperationName string            `json:"operationName"`
+    References    []jaegerReference `json:"references"`
+    StartTime     int64             `json:"startTime"`
+    Duration      int64             `json:"duration"`
+    Tags          []jaegerTag       `json:"tags"`
+    Logs          []interface{}     `json:"logs"`
+    ProcessID     string            `json:"processID"`
+}
+
+type jaegerReference struct {
+    RefType string `json:"refType"`
+    TraceID string `json:"traceID"`
+    SpanID  string `json:"spanID"`
+}
+
+type jaegerProcess struct {
+    ServiceName string      `json:"serviceName"`
+    Tags        []jaegerTag `json:"tags"`
+}
+
+type jaegerTag struct {
+    Key   string      `json:"key"`
+    Type  string      `json:"type"`
+    Value interface{} `json:"value"`
+}
+
+// WriteJaegerTrace 将追踪写为 Jaeger JSON：每个 ServiceName + HostName 是一个进程，
+// 节点之间以 CHILD_OF 引用组成 span 树
+func WriteJaegerTrace(w io.Writer, traces ...*MessageTrace) error {
+    file := jaegerTraceFile{Data: make([]jaegerTrace, 0, len(traces))}
+    for _, mt := range traces {
+        if mt == nil {
+            continue
+        }
+        mt.mu.Lock()
+        jt := jaegerTrace{
+            TraceID:   mt.TraceId,
+            Spans:     make([]jaegerSpan, 0, len(mt.Hops)),
+            Processes: make(map[string]jaegerProcess),
+        }
+        processIds := make(map[[2]string]string)
+        for _, hop := range mt.Hops {
+            key := [2]string{hop.ServiceName, hop.HostName}
+            pid, ok := processIds[key]
+            if !ok {
+                pid = fmt.Sprintf("p%d", len(processIds)+1)
+                processIds[key] = pid
+                jt.Processes[pid] = jaegerProcess{
+                    ServiceName: hop.ServiceName,
+                    Tags:        []jaegerTag{{Key: "hostname", Type: "string", Value: hop.HostName}},
+                }
+            }
+
+            span := jaegerSpan{
+                TraceID:       mt.TraceId,
+                SpanID:        hop.SpanId,
+                OperationName: hop.ServiceName,
+                References:    make([]jaegerReference, 0, 1),
+                StartTime:     hop.EntryTime.UnixMicro(),
+                Duration:      hop.endTime().Sub(hop.EntryTime).Microseconds(),
+                Tags: []jaegerTag{
+                    {Key: "service_id", Type: "string", Value: hop.ServiceId},
+                    {Key: "status", Type: "string", Value: hop.Status},
+                },
+                Logs:      make([]interface{}, 0),
+                ProcessID: pid,
+            }
+            if hop.ParentSpanId != "" {
+                span.References = append(span.References, jaegerReference{
+                    RefType: "CHILD_OF", TraceID: mt.TraceId, SpanID: hop.ParentSpanId,
+                })
+            }
+            if hop.Error != "" {
+                span.Tags = append(span.Tags,
+                    jaegerTag{Key: "error", Type: "bool", Value: true},
+                    jaegerTag{Key: "error.message", Type: "string", Value: hop.Error})
+            }
+            jt.Spans = append(jt.Spans, span)
+        }
+        mt.mu.Unlock()
+
+        sort.SliceStable(jt.Spans, func(i, j int) bool { return jt.Spans[i].StartTime < jt.Spans[j].StartTime })
+        file.Data = append(file.Data, jt)
+    }
+    return writeTraceJSON(w, file)
+}
+
+// writeTraceJSON 以缩进 JSON 写出，错误统一为序列化失败
+func writeTraceJSON(w io.Writer, v interface{}) error {
+    enc := json.NewEncoder(w)
+    enc.SetIndent("", "  ")
+    if err := enc.Encode(v); err != nil {
+        return ErrSerializeFailed.WithCause(err)
+    }
+    return nil
+}
@@ -0,0 +1,130 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+	"time"
+)
+
+// newTestExportTrace core(host-a) 下有 cache(host-a, 未完成) 和 db(host-b, 失败) 两个子节点，
+// 起始时间带纳秒部分，用于检查微秒截断
+func newTestExportTrace() *MessageTrace {
+    start := time.Unix(1700000000, 123456789)
+    return &MessageTrace{
+        TraceId:   testTraceId,
+        StartTime: start,
+        Hops: []*MessageHop{
+            {
+                ServiceId: "core-1", ServiceName: "core", HostName: "host-a", SpanId: "1111111111111111",
+                EntryTime: start, ExitTime: start.Add(1500 * time.Microsecond), Status: "ok",
+            },
+            {
+                ServiceId: "cache-1", ServiceName: "cache", HostName: "host-a", SpanId: "2222222222222222",
+                ParentSpanId: "1111111111111111", EntryTime: start.Add(500 * time.Microsecond),
+            },
+            {
+                ServiceId: "db-1", ServiceName: "db", HostName: "host-b", SpanId: "3333333333333333",
+                ParentSpanId: "1111111111111111", EntryTime: start.Add(250 * time.Microsecond),
+                ExitTime: start.Add(1250*time.Microsecond + 999), Status: "error", Error: "timeout",
+            },
+        },
+    }
+}
+
+// assertJSONEqual 忽略空白比较 JSON
+func assertJSONEqual(t *testing.T, got []byte, want string) {
+    t.Helper()
+    var g, w bytes.Buffer
+    if err := json.Compact(&g, got); err != nil {
+        t.Fatalf("invalid output: %v\n%s", err, got)
+    }
+    if err := json.Compact(&w, []byte(want)); err != nil {
+        t.Fatal(err)
+    }
+    if g.String() != w.String() {
+        t.Fatalf("got:\n%s\nwant:\n%s", g.String(), w.String())
+    }
+}
+
+const chromeTraceGolden = `{
+  "traceEvents": [
+    {"name": "process_name", "ph": "M", "ts": 0, "pid": 1, "tid": 0, "args": {"name": "host-a"}},
+    {"name": "thread_name", "ph": "M", "ts": 0, "pid": 1, "tid": 1, "args": {"name": "core"}},
+    {"name": "core", "cat": "4bf92f3577b34da6a3ce929d0e0e4736", "ph": "X", "ts": 1700000000123456, "dur": 1500, "pid": 1, "tid": 1,
+     "args": {"service_id": "core-1", "span_id": "1111111111111111", "status": "ok", "trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"}},
+    {"name": "thread_name", "ph": "M", "ts": 0, "pid": 1, "tid": 2, "args": {"name": "cache"}},
+    {"name": "cache", "cat": "4bf92f3577b34da6a3ce929d0e0e4736", "ph": "X", "ts": 1700000000123956, "pid": 1, "tid": 2,
+     "args": {"parent_span_id": "1111111111111111", "service_id": "cache-1", "span_id": "2222222222222222", "status": "", "trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"}},
+    {"name": "process_name", "ph": "M", "ts": 0, "pid": 2, "tid": 0, "args": {"name": "host-b"}},
+    {"name": "thread_name", "ph": "M", "ts": 0, "pid": 2, "tid": 3, "args": {"name": "db"}},
+    {"name": "db", "cat": "4bf92f3577b34da6a3ce929d0e0e4736", "ph": "X", "ts": 1700000000123706, "dur": 1000, "pid": 2, "tid": 3,
+     "args": {"error": "timeout", "parent_span_id": "1111111111111111", "service_id": "db-1", "span_id": "3333333333333333", "status": "error", "trace_id": "4bf92f3577b34da6a3ce929d0e0e4736"}}
+  ],
+  "displayTimeUnit": "ms"
+}`
+
+func TestWriteChromeTrace(t *testing.T) {
+    var buf bytes.Buffer
+    if err := WriteChromeTrace(&buf, newTestExportTrace(), nil); err != nil {
+        t.Fatal(err)
+    }
+    assertJSONEqual(t, buf.Bytes(), chromeTraceGolden)
+
+    buf.Reset()
+    if err := WriteChromeTrace(&buf); err != nil {
+        t.Fatal(err)
+    }
+    assertJSONEqual(t, buf.Bytes(), `{"traceEvents": [], "displayTimeUnit": "ms"}`)
+}
+
+// Jaeger 的 span 按开始时间排序：core、db、cache
+const jaegerTraceGolden = `{
+  "data": [{
+    "traceID": "4bf92f3577b34da6a3ce929d0e0e4736",
+    "spans": [
+      {
+        "traceID": "4bf92f3577b34da6a3ce929d0e0e4736", "spanID": "1111111111111111", "operationName": "core",
+        "references": [], "startTime": 1700000000123456, "duration": 1500,
+        "tags": [{"key": "service_id", "type": "string", "value": "core-1"}, {"key": "status", "type": "string", "value": "ok"}],
+        "logs": [], "processID": "p1"
+      },
+      {
+        "traceID": "4bf92f3577b34da6a3ce929d0e0e4736", "spanID": "3333333333333333", "operationName": "db",
+        "references": [{"refType": "CHILD_OF", "traceID": "4bf92f3577b34da6a3ce929d0e0e4736", "spanID": "1111111111111111"}],
+        "startTime": 1700000000123706, "duration": 1000,
+        "tags": [
+          {"key": "service_id", "type": "string", "value": "db-1"}, {"key": "status", "type": "string", "value": "error"},
+          {"key": "error", "type": "bool", "value": true}, {"key": "error.message", "type": "string", "value": "timeout"}
+        ],
+        "logs": [], "processID": "p3"
+      },
+      {
+        "traceID": "4bf92f3577b34da6a3ce929d0e0e4736", "spanID": "2222222222222222", "operationName": "cache",
+        "references": [{"refType": "CHILD_OF", "traceID": "4bf92f3577b34da6a3ce929d0e0e4736", "spanID": "1111111111111111"}],
+        "startTime": 1700000000123956, "duration": 0,
+        "tags": [{"key": "service_id", "type": "string", "value": "cache-1"}, {"key": "status", "type": "string", "value": ""}],
+        "logs": [], "processID": "p2"
+      }
+    ],
+    "processes": {
+      "p1": {"serviceName": "core", "tags": [{"key": "hostname", "type": "string", "value": "host-a"}]},
+      "p2": {"serviceName": "cache", "tags": [{"key": "hostname", "type": "string", "value": "host-a"}]},
+      "p3": {"serviceName": "db", "tags": [{"key": "hostname", "type": "string", "value": "host-b"}]}
+    }
+  }]
+}`
+
+func TestWriteJaegerTrace(t *testing.T) {
+    var buf bytes.Buffer
+    if err := WriteJaegerTrace(&buf, newTestExportTrace(), nil); err != nil {
+        t.Fatal(err)
+    }
+    assertJSONEqual(t, buf.Bytes(), jaegerTraceGolden)
+
+    buf.Reset()
+    if err := WriteJaegerTrace(&buf); err != nil {
+        t.Fatal(err)
+    }
+    assertJSONEqual(t, buf.Bytes(), `{"data": []}`)
+}
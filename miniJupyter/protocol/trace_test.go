@@ -0,0 +1,88 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestTraceDuplicateAndSelfParentSpans(t *testing.T) {
+    // 重复的 span_id 以及以自身为父节点的 span 不能导致无限递归
+    data := []byte(`{
+        "trace_id": "t1",
+        "start_time": "2024-01-01T00:00:00Z",
+        "hops": [
+            {"service_name": "core", "span_id": "a", "entry_time": "2024-01-01T00:00:00Z", "exit_time": "2024-01-01T00:00:02Z"},
+            {"service_name": "dup", "span_id": "a", "parent_span_id": "a", "entry_time": "2024-01-01T00:00:00Z", "exit_time": "2024-01-01T00:00:01Z"},
+            {"service_name": "self", "span_id": "b", "parent_span_id": "b", "entry_time": "2024-01-01T00:00:00Z"}
+        ]
+    }`)
+    var trace MessageTrace
+    if err := json.Unmarshal(data, &trace); err != nil {
+        t.Fatal(err)
+    }
+
+    tree := trace.String()
+    if !strings.Contains(tree, "core") || !strings.Contains(tree, "dup") {
+        t.Fatalf("unexpected tree:\n%s", tree)
+    }
+    path := trace.CriticalPath()
+    if len(path) == 0 || len(path) > len(trace.Hops) {
+        t.Fatalf("unexpected critical path: %v", path)
+    }
+}
+
+func TestTraceConcurrentUse(t *testing.T) {
+    // 使用 go test -race 运行：并发的 AddHop / Complete / Clone 不能产生数据竞争
+    const workers = 16
+    trace := NewMessageTrace()
+    var wg sync.WaitGroup
+    for i := 0; i < workers; i++ {
+        wg.Add(2)
+        go func(i int) {
+            defer wg.Done()
+            hop := trace.AddHop(fmt.Sprintf("core-%d", i), "core", "localhost")
+            child := hop.StartChild(fmt.Sprintf("db-%d", i), "db", "localhost")
+            child.Complete(string(StatusOK), nil)
+            hop.Complete(string(StatusError), errors.New("boom"))
+        }(i)
+        go func() {
+            defer wg.Done()
+            clone := trace.Clone()
+            if hop := clone.LastHop(); hop != nil {
+                hop.Complete(string(StatusOK), nil) // 只修改副本
+                hop.StartChild("clone", "clone", "localhost")
+            }
+            if hop := trace.LastHop(); hop != nil {
+                hop.IsComplete()
+            }
+            if _, err := json.Marshal(trace); err != nil {
+                t.Error(err)
+            }
+            trace.CalculateTotalTime()
+        }()
+    }
+    wg.Wait()
+
+    if len(trace.Hops) != 2*workers {
+        t.Fatalf("got %d hops, want %d", len(trace.Hops), 2*workers)
+    }
+    spans := make(map[string]bool)
+    for _, hop := range trace.Hops {
+        if !hop.IsComplete() || hop.ServiceName == "clone" {
+            t.Fatalf("unexpected hop %+v", hop)
+        }
+        spans[hop.SpanId] = true
+    }
+    for _, hop := range trace.Hops {
+        if hop.ServiceName == "db" && !spans[hop.ParentSpanId] {
+            t.Fatalf("child %s has unknown parent %s", hop.SpanId, hop.ParentSpanId)
+        }
+    }
+    if len(trace.Roots()) != workers {
+        t.Fatalf("got %d roots, want %d", len(trace.Roots()), workers)
+    }
+}
@@ -21,6 +21,7 @@ const (
     CompressNone   Compression = "none"
     CompressGzip   Compression = "gzip"
     CompressSnappy Compression = "snappy"
+    CompressAuto   Compression = "auto" // 由编码器按大小阈值决定，wire 上会替换为实际压缩方式
 
     // Encoding
     EncodeJSON     Encoding = "json"
@@ -42,6 +43,7 @@ const (
     StatusStarting Status = "starting"
     StatusWaiting  Status = "waiting"
     StatusSuccess  Status = "success"
+    StatusSkipped  Status = "skipped" // 执行条件不满足或依赖被跳过
 
     // StreamType
     StreamStdout StreamType = "stdout"
@@ -60,15 +62,19 @@ const (
     MsgTypeCommOpen       = "comm_open"
     MsgTypeCommMsg        = "comm_msg"
     MsgTypeCommClose      = "comm_close"
+    MsgTypeCommInfoRequest = "comm_info_request"
+    MsgTypeCommInfoReply   = "comm_info_reply"
+    MsgTypeVersionRequest = "version_request"
+    MsgTypeVersionReply   = "version_reply"
+    MsgTypeError          = "error"
+
+    MsgTypeTraceReport       = "trace_report"
+    MsgTypeTraceStatsRequest = "trace_stats_request"
+    MsgTypeTraceStatsReply   = "trace_stats_reply"
 )
 
-// 添加消息类型检查
+// 添加消息类型检查，已通过 RegisterMessageType 注册的类型均有效
 func IsValidMessageType(msgType string) bool {
-    switch msgType {
-    case MsgTypeExecuteRequest, MsgTypeExecuteReply, MsgTypeExecuteResult,
-         MsgTypeCoreInfoRequest, MsgTypeCoreInfoReply, MsgTypeStream,
-         MsgTypeCommOpen, MsgTypeCommMsg, MsgTypeCommClose:
-        return true
-    }
-    return false
+    _, ok := LookupMessageType(msgType)
+    return ok
 }
\ No newline at end of file
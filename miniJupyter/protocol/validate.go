@@ -10,39 +10,56 @@ type Validator interface {
     Validate() error
 }
 
-// ValidateMessage 验证整个消息结构
-func ValidateMessage(msg *Message) error {
+// MessageCheck 额外的消息检查，可与 ValidateMessage 组合使用（如重放保护）
+type MessageCheck func(msg *Message) error
+
+// ValidateMessage 验证整个消息结构，结构验证通过后依次执行 checks
+func ValidateMessage(msg *Message, checks ...MessageCheck) error {
     // 验证Header
     if err := validateHeader(&msg.Header); err != nil {
         return fmt.Errorf("invalid header: %w", err)
     }
 
+    // 验证Security
+    if !IsValidEncryption(msg.Security.Encryption) {
+        return fmt.Errorf("invalid security: %w", ErrValidationFailed.WithDetails("unsupported encryption: "+msg.Security.Encryption))
+    }
+
     // 验证Content
     if validator, ok := msg.Content.(Validator); ok {
         if err := validator.Validate(); err != nil {
+            if !IsProtocolError(err) {
+                err = ErrValidationFailed.WithCause(err)
+            }
             return fmt.Errorf("invalid content: %w", err)
         }
     }
 
+    for _, check := range checks {
+        if err := check(msg); err != nil {
+            return err
+        }
+    }
+
     return nil
 }
 
 // validateHeader 验证消息头
 func validateHeader(h *Header) error {
     if h.MsgId == "" {
-        return errors.New("msg_id is required")
+        return ErrInvalidFormat.WithDetails("msg_id is required")
     }
     if h.SessionId == "" {
-        return errors.New("session_id is required")
+        return ErrInvalidFormat.WithDetails("session_id is required")
     }
     if h.UserId == "" {
-        return errors.New("user_id is required")
+        return ErrInvalidFormat.WithDetails("user_id is required")
     }
     if !IsValidMessageType(h.MsgType) {
-        return fmt.Errorf("invalid message type: %s", h.MsgType)
+        return ErrInvalidMessageType.WithDetails(h.MsgType)
     }
     if h.Version != ProtocolVersion {
-        return fmt.Errorf("unsupported version: %s", h.Version)
+        return ErrInvalidVersion.WithDetails(h.Version)
     }
     return nil
 }
@@ -97,7 +114,7 @@ func (c *CoreInfoContent) Validate() error {
 // ExecuteResultContent 验证
 func (c *ExecuteResultContent) Validate() error {
     switch c.Status {
-    case StatusSuccess, StatusError:
+    case StatusSuccess, StatusError, StatusSkipped:
         return nil
     default:
         return fmt.Errorf("invalid status: %s", c.Status)
@@ -131,4 +148,69 @@ func (c *CommMsgContent) Validate() error {
         return errors.New("comm_id is required")
     }
     return nil
+}
+
+// VersionRequestContent 验证
+func (c *VersionRequestContent) Validate() error {
+    if len(c.Versions) == 0 {
+        return errors.New("versions is required")
+    }
+    return nil
+}
+
+// VersionReplyContent 验证
+func (c *VersionReplyContent) Validate() error {
+    switch c.Status {
+    case StatusOK:
+        if c.Version == "" {
+            return errors.New("version is required")
+        }
+        return nil
+    case StatusError:
+        return nil
+    default:
+        return fmt.Errorf("invalid status: %s", c.Status)
+    }
+}
+
+// CommInfoReplyContent 验证
+func (c *CommInfoReplyContent) Validate() error {
+    switch c.Status {
+    case StatusOK, StatusError:
+        return nil
+    default:
+        return fmt.Errorf("invalid status: %s", c.Status)
+    }
+}
+
+// TraceReportContent 验证
+func (c *TraceReportContent) Validate() error {
+    if c.Trace == nil {
+        return errors.New("trace is required")
+    }
+    if c.Trace.TraceId == "" {
+        return errors.New("trace_id is required")
+    }
+    return nil
+}
+
+// TraceStatsReplyContent 验证
+func (c *TraceStatsReplyContent) Validate() error {
+    switch c.Status {
+    case StatusOK, StatusError:
+        return nil
+    default:
+        return fmt.Errorf("invalid status: %s", c.Status)
+    }
+}
+
+// ErrorContent 验证
+func (c *ErrorContent) Validate() error {
+    if c.Code == 0 {
+        return errors.New("code is required")
+    }
+    if c.Message == "" {
+        return errors.New("message is required")
+    }
+    return nil
 }
\ No newline at end of file
@@ -0,0 +1,402 @@
+package protocol
+
+import (
+	"encoding/json"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+// 历史协议版本
+const (
+    Version01 = "0.1"
+    Version02 = "0.2"
+    Version03 = "0.3"
+    Version04 = "0.4"
+)
+
+// RawMessage 与版本无关的通用消息表示，键为 header, parent_header, meta, content, security, trace，
+// 值为对应部分解析后的 JSON 对象，版本转换器在此结构上工作
+type RawMessage map[string]interface{}
+
+// Part 返回指定部分的 JSON 对象，不存在时创建
+func (r RawMessage) Part(name string) map[string]interface{} {
+    if part, ok := r[name].(map[string]interface{}); ok {
+        return part
+    }
+    part := make(map[string]interface{})
+    r[name] = part
+    return part
+}
+
+// MsgType 返回 header.msg_type
+func (r RawMessage) MsgType() string {
+    msgType, _ := r.Part("header")["msg_type"].(string)
+    return msgType
+}
+
+// Version 返回 header.version
+func (r RawMessage) Version() string {
+    version, _ := r.Part("header")["version"].(string)
+    return version
+}
+
+// VersionConverter 相邻两个版本之间的转换器
+type VersionConverter struct {
+    From      string                  // 旧版本
+    To        string                  // 新版本
+    Upgrade   func(raw RawMessage) error // From -> To
+    Downgrade func(raw RawMessage) error // To -> From
+}
+
+var (
+    versionsMu        sync.RWMutex
+    versionConverters = make(map[string]VersionConverter) // From -> converter
+)
+
+// versionFrames 各版本 wire 协议中分隔符、签名之后的消息帧
+var versionFrames = map[string][]string{
+    Version01: {"header", "parent_header", "meta", "content"}, // 0.1 之后可能跟随原始数据帧
+    Version02: {"header", "parent_header", "meta", "content", "security"},
+    Version03: {"header", "parent_header", "meta", "content", "security"},
+    Version04: {"header", "parent_header", "meta", "content", "security", "trace"},
+}
+
+func init() {
+    for _, c := range []VersionConverter{
+        {Version01, Version02, upgrade01To02, downgrade02To01},
+        {Version02, Version03, upgrade02To03, downgrade03To02},
+        {Version03, Version04, upgrade03To04, downgrade04To03},
+    } {
+        if err := RegisterVersionConverter(c); err != nil {
+            panic(err)
+        }
+    }
+}
+
+// RegisterVersionConverter 注册相邻版本之间的转换器，每个旧版本只能有一个转换器
+func RegisterVersionConverter(c VersionConverter) error {
+    if c.From == "" || c.To == "" || c.Upgrade == nil || c.Downgrade == nil {
+        return ErrInvalidVersion.WithDetails("converter requires from, to, upgrade and downgrade")
+    }
+    if compareVersions(c.From, c.To) >= 0 {
+        return ErrInvalidVersion.WithDetails("converter must go from an older to a newer version")
+    }
+
+    versionsMu.Lock()
+    defer versionsMu.Unlock()
+    if _, exists := versionConverters[c.From]; exists {
+        return ErrInvalidVersion.WithDetails("converter already registered for " + c.From)
+    }
+    versionConverters[c.From] = c
+    return nil
+}
+
+// SupportedVersions 返回可以转换到当前版本的所有版本，从旧到新排序
+func SupportedVersions() []string {
+    versionsMu.RLock()
+    defer versionsMu.RUnlock()
+
+    versions := []string{ProtocolVersion}
+    for {
+        found := false
+        for from, c := range versionConverters {
+            if c.To == versions[0] {
+                versions = append([]string{from}, versions...)
+                found = true
+                break
+            }
+        }
+        if !found {
+            return versions
+        }
+    }
+}
+
+// IsSupportedVersion 检查版本是否可以转换到当前版本
+func IsSupportedVersion(version string) bool {
+    for _, v := range SupportedVersions() {
+        if v == version {
+            return true
+        }
+    }
+    return false
+}
+
+// UpgradeRaw 将旧版本消息逐级升级到当前版本
+func UpgradeRaw(raw RawMessage) error {
+    version := raw.Version()
+    if !IsSupportedVersion(version) {
+        return ErrInvalidVersion.WithDetails("unsupported version: " + version)
+    }
+
+    for version != ProtocolVersion {
+        versionsMu.RLock()
+        c := versionConverters[version]
+        versionsMu.RUnlock()
+
+        if err := c.Upgrade(raw); err != nil {
+            return err
+        }
+        version = c.To
+        raw.Part("header")["version"] = version
+    }
+    return nil
+}
+
+// DowngradeRaw 将当前版本消息逐级降级到目标版本
+func DowngradeRaw(raw RawMessage, target string) error {
+    if !IsSupportedVersion(target) {
+        return ErrInvalidVersion.WithDetails("unsupported version: " + target)
+    }
+
+    // 先找到从目标版本到当前版本的升级路径，再反向执行
+    var path []VersionConverter
+    versionsMu.RLock()
+    for v := target; v != ProtocolVersion; {
+        c := versionConverters[v]
+        path = append(path, c)
+        v = c.To
+    }
+    versionsMu.RUnlock()
+
+    for i := len(path) - 1; i >= 0; i-- {
+        if err := path[i].Downgrade(raw); err != nil {
+            return err
+        }
+        raw.Part("header")["version"] = path[i].From
+    }
+    return nil
+}
+
+// NegotiateVersion 返回双方都支持的最高版本
+func NegotiateVersion(local, remote []string) (string, error) {
+    common := make([]string, 0)
+    for _, l := range local {
+        for _, r := range remote {
+            if l == r {
+                common = append(common, l)
+            }
+        }
+    }
+    if len(common) == 0 {
+        return "", ErrInvalidVersion.WithDetails("no common protocol version")
+    }
+    sort.Slice(common, func(i, j int) bool {
+        return compareVersions(common[i], common[j]) > 0
+    })
+    return common[0], nil
+}
+
+// Negotiate 根据本地支持的版本应答版本协商请求
+func (c *VersionRequestContent) Negotiate() *VersionReplyContent {
+    local := SupportedVersions()
+    version, err := NegotiateVersion(local, c.Versions)
+    if err != nil {
+        return &VersionReplyContent{Status: StatusError, Versions: local}
+    }
+    return &VersionReplyContent{Status: StatusOK, Version: version, Versions: local}
+}
+
+// MarshalForVersion 将消息降级到目标版本并序列化为单个 JSON，用于与旧版本节点通信，
+// 与 SerializeMessage 相同不支持内容加密
+func MarshalForVersion(msg *Message, version string) ([]byte, error) {
+    if err := checkPlainContent(&msg.Security, ErrSerializeFailed); err != nil {
+        return nil, err
+    }
+    raw, err := messageToRaw(msg)
+    if err != nil {
+        return nil, err
+    }
+    if err := DowngradeRaw(raw, version); err != nil {
+        return nil, err
+    }
+    data, err := json.Marshal(raw)
+    if err != nil {
+        return nil, ErrSerializeFailed.WithDetails(err.Error())
+    }
+    return data, nil
+}
+
+// messageToRaw 将消息转换为当前版本的通用表示，content 以 JSON 形式保存
+func messageToRaw(msg *Message) (RawMessage, error) {
+    data, err := json.Marshal(msg)
+    if err != nil {
+        return nil, ErrSerializeFailed.WithDetails(err.Error())
+    }
+    var raw RawMessage
+    if err := json.Unmarshal(data, &raw); err != nil {
+        return nil, ErrSerializeFailed.WithDetails(err.Error())
+    }
+
+    // 旧版本只支持 JSON 编码
+    header := raw.Part("header")
+    header["encoding"] = string(EncodeJSON)
+    delete(header, "codec")
+    if header["version"] == nil || header["version"] == "" {
+        header["version"] = ProtocolVersion
+    }
+    return raw, nil
+}
+
+// compareVersions 比较 "major.minor" 形式的版本号
+func compareVersions(a, b string) int {
+    pa, pb := strings.Split(a, "."), strings.Split(b, ".")
+    for i := 0; i < len(pa) || i < len(pb); i++ {
+        var na, nb int
+        if i < len(pa) {
+            na, _ = strconv.Atoi(pa[i])
+        }
+        if i < len(pb) {
+            nb, _ = strconv.Atoi(pb[i])
+        }
+        if na != nb {
+            if na < nb {
+                return -1
+            }
+            return 1
+        }
+    }
+    return 0
+}
+
+///////////////////////////////////////////////////////////////////////////////////////
+
+// 0.1 -> 0.2：user_id、node_id 从 meta 移到 header，encoding 字段改为 compression，stream 的 name 改为 type
+func upgrade01To02(raw RawMessage) error {
+    switch raw.MsgType() {
+    case MsgTypeStream, MsgTypeCommOpen, MsgTypeCommMsg, MsgTypeCommClose:
+    default:
+        // 0.1 的其他消息沿用 Jupyter 的内容结构，无法转换
+        return ErrInvalidVersion.WithDetails("message type cannot be upgraded from 0.1: " + raw.MsgType())
+    }
+
+    header, meta := raw.Part("header"), raw.Part("meta")
+    header["session_id"] = meta["node_id"]
+    header["user_id"] = meta["user_id"]
+    header["compression"] = string(CompressNone)
+    if c, ok := header["encoding"].(string); ok && IsValidCompression(Compression(c)) && c != "" {
+        header["compression"] = c
+    }
+    header["encoding"] = string(EncodeJSON)
+    header["transport"] = string(TransportZMQ)
+
+    if parentId, ok := meta["parent_msg_id"].(string); ok && parentId != "" {
+        parent := raw.Part("parent_header")
+        if _, exists := parent["msg_id"]; !exists {
+            parent["msg_id"] = parentId
+        }
+    }
+
+    priority, _ := meta["priority"].(string)
+    if priority == "MEDIUM" {
+        priority = string(PriorityNormal)
+    }
+    raw["meta"] = map[string]interface{}{"priority": priority, "tags": []interface{}{}}
+    raw["security"] = map[string]interface{}{}
+
+    if raw.MsgType() == MsgTypeStream {
+        content := raw.Part("content")
+        content["type"] = content["name"]
+        delete(content, "name")
+    }
+    return nil
+}
+
+// 0.2 -> 0.1
+func downgrade02To01(raw RawMessage) error {
+    switch raw.MsgType() {
+    case MsgTypeStream, MsgTypeCommOpen, MsgTypeCommMsg, MsgTypeCommClose:
+    default:
+        return ErrInvalidVersion.WithDetails("message type cannot be downgraded to 0.1: " + raw.MsgType())
+    }
+
+    header, meta, parent := raw.Part("header"), raw.Part("meta"), raw.Part("parent_header")
+    priority, _ := meta["priority"].(string)
+    if priority == string(PriorityNormal) {
+        priority = "MEDIUM"
+    }
+    newMeta := map[string]interface{}{
+        "node_id":  header["session_id"],
+        "user_id":  header["user_id"],
+        "priority": priority,
+    }
+    if parentId, ok := parent["msg_id"].(string); ok && parentId != "" {
+        newMeta["parent_msg_id"] = parentId
+    }
+    raw["meta"] = newMeta
+
+    // 0.1 的 compression 字段表示消息方向，encoding 字段表示压缩方式
+    header["encoding"] = header["compression"]
+    header["compression"] = "REQUEST"
+    if info, ok := LookupMessageType(raw.MsgType()); ok && info.Kind == KindReply {
+        header["compression"] = "RESPONSE"
+    }
+    delete(header, "session_id")
+    delete(header, "user_id")
+    delete(header, "transport")
+    delete(header, "compress_all")
+    delete(raw, "security")
+
+    if raw.MsgType() == MsgTypeStream {
+        content := raw.Part("content")
+        content["name"] = content["type"]
+        delete(content, "type")
+    }
+    return nil
+}
+
+// 0.2 -> 0.3：execute_request 由 commands 列表变为单条命令
+func upgrade02To03(raw RawMessage) error {
+    if raw.MsgType() != MsgTypeExecuteRequest {
+        return nil
+    }
+    content := raw.Part("content")
+    commands, _ := content["commands"].([]interface{})
+    if len(commands) != 1 {
+        return ErrInvalidVersion.WithDetails("0.2 execute_request must contain exactly one command to be upgraded")
+    }
+    command, ok := commands[0].(map[string]interface{})
+    if !ok {
+        return ErrInvalidFormat.WithDetails("invalid 0.2 command")
+    }
+    if users, ok := content["allowed_users"]; ok && command["allowed_users"] == nil {
+        command["allowed_users"] = users
+    }
+    raw["content"] = command
+    return nil
+}
+
+// 0.3 -> 0.2
+func downgrade03To02(raw RawMessage) error {
+    switch raw.MsgType() {
+    case MsgTypeExecuteRequest:
+        command := raw.Part("content")
+        raw["content"] = map[string]interface{}{
+            "commands":      []interface{}{command},
+            "allowed_users": command["allowed_users"],
+        }
+    case MsgTypeExecuteReply:
+        // 0.2 没有 waiting 状态
+        content := raw.Part("content")
+        if content["status"] == string(StatusWaiting) {
+            content["status"] = string(StatusStarting)
+        }
+    }
+    return nil
+}
+
+// 0.3 -> 0.4：增加 trace
+func upgrade03To04(raw RawMessage) error {
+    if _, ok := raw["trace"]; !ok {
+        raw["trace"] = nil
+    }
+    return nil
+}
+
+// 0.4 -> 0.3
+func downgrade04To03(raw RawMessage) error {
+    delete(raw, "trace")
+    return nil
+}
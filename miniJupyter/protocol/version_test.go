@@ -0,0 +1,285 @@
+package protocol
+
+import (
+	"encoding/json"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func newTestVersionMessage(t *testing.T, msgType string, content interface{}) *Message {
+    t.Helper()
+    msg, err := NewMessageBuilder().
+        WithType(msgType).
+        WithSession("s1").
+        WithUser("alice").
+        WithTransport(TransportZMQ).
+        WithContent(content).
+        Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return msg
+}
+
+func TestUpgradeRaw01Stream(t *testing.T) {
+    raw := RawMessage{
+        "header": map[string]interface{}{
+            "msg_id": "m1", "msg_type": MsgTypeStream, "version": Version01,
+            "encoding": string(CompressGzip), "compression": "REQUEST",
+        },
+        "parent_header": map[string]interface{}{},
+        "meta": map[string]interface{}{
+            "node_id": "s1", "user_id": "alice", "priority": "MEDIUM", "parent_msg_id": "p1",
+        },
+        "content": map[string]interface{}{"name": "stdout", "text": "hi"},
+    }
+    if err := UpgradeRaw(raw); err != nil {
+        t.Fatal(err)
+    }
+
+    header := raw.Part("header")
+    if raw.Version() != ProtocolVersion || header["session_id"] != "s1" || header["user_id"] != "alice" {
+        t.Fatalf("header not upgraded: %v", header)
+    }
+    if header["compression"] != string(CompressGzip) || header["encoding"] != string(EncodeJSON) {
+        t.Fatalf("compression/encoding not upgraded: %v", header)
+    }
+    if raw.Part("parent_header")["msg_id"] != "p1" {
+        t.Fatalf("parent_msg_id not moved: %v", raw["parent_header"])
+    }
+    if raw.Part("meta")["priority"] != string(PriorityNormal) {
+        t.Fatalf("priority not upgraded: %v", raw["meta"])
+    }
+    if content := raw.Part("content"); content["type"] != "stdout" || content["name"] != nil {
+        t.Fatalf("stream content not upgraded: %v", content)
+    }
+    if _, ok := raw["trace"]; !ok {
+        t.Fatal("trace part missing after upgrade")
+    }
+}
+
+func TestUpgradeRawErrors(t *testing.T) {
+    unknown := RawMessage{"header": map[string]interface{}{"msg_type": MsgTypeStream, "version": "0.0"}}
+    if err := UpgradeRaw(unknown); !errors.Is(err, ErrInvalidVersion) {
+        t.Fatalf("unknown version: %v", err)
+    }
+
+    // 0.1 只有 stream 和 comm 消息可以升级
+    execute := RawMessage{"header": map[string]interface{}{"msg_type": MsgTypeExecuteRequest, "version": Version01}}
+    if err := UpgradeRaw(execute); !errors.Is(err, ErrInvalidVersion) {
+        t.Fatalf("0.1 execute_request: %v", err)
+    }
+
+    // 0.2 的 execute_request 只有一条命令时才能升级
+    multi := RawMessage{
+        "header":  map[string]interface{}{"msg_type": MsgTypeExecuteRequest, "version": Version02},
+        "content": map[string]interface{}{"commands": []interface{}{map[string]interface{}{}, map[string]interface{}{}}},
+    }
+    if err := UpgradeRaw(multi); !errors.Is(err, ErrInvalidVersion) {
+        t.Fatalf("0.2 execute_request with two commands: %v", err)
+    }
+
+    if err := DowngradeRaw(RawMessage{}, "0.0"); !errors.Is(err, ErrInvalidVersion) {
+        t.Fatalf("downgrade to unknown version: %v", err)
+    }
+}
+
+func TestMarshalForVersionRoundTrip(t *testing.T) {
+    stream := newTestVersionMessage(t, MsgTypeStream, &StreamContent{Type: StreamStdout, Text: "hi"})
+    execute := newTestVersionMessage(t, MsgTypeExecuteRequest, &ExecuteRequestContent{
+        CommandId: "c1", Service: "db", Method: "login",
+    })
+
+    tests := []struct {
+        version string
+        msg     *Message
+    }{
+        {Version01, stream},
+        {Version02, stream},
+        {Version02, execute},
+        {Version03, execute},
+        {Version04, execute},
+    }
+    for _, tt := range tests {
+        data, err := MarshalForVersion(tt.msg, tt.version)
+        if err != nil {
+            t.Fatalf("%s %s: %v", tt.version, tt.msg.Header.MsgType, err)
+        }
+        var raw RawMessage
+        if err := json.Unmarshal(data, &raw); err != nil {
+            t.Fatal(err)
+        }
+        if raw.Version() != tt.version {
+            t.Fatalf("%s: marshalled as %s", tt.version, raw.Version())
+        }
+
+        got, err := ParseMessage(data)
+        if err != nil {
+            t.Fatalf("%s %s: %v", tt.version, tt.msg.Header.MsgType, err)
+        }
+        if got.Header.Version != ProtocolVersion || got.Header.SessionId != "s1" || got.Header.UserId != "alice" {
+            t.Fatalf("%s: header %+v", tt.version, got.Header)
+        }
+        if !reflect.DeepEqual(got.Content, tt.msg.Content) {
+            t.Fatalf("%s %s: content %#v", tt.version, tt.msg.Header.MsgType, got.Content)
+        }
+        if err := ValidateMessage(got); err != nil {
+            t.Fatalf("%s: upgraded message invalid: %v", tt.version, err)
+        }
+    }
+
+    if _, err := MarshalForVersion(execute, Version01); !errors.Is(err, ErrInvalidVersion) {
+        t.Fatalf("execute_request to 0.1: %v", err)
+    }
+}
+
+func TestDowngrade02Layout(t *testing.T) {
+    raw, err := messageToRaw(newTestVersionMessage(t, MsgTypeExecuteRequest, &ExecuteRequestContent{
+        CommandId: "c1", Service: "db", Method: "login", AllowedUsers: []string{"bob"},
+    }))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := DowngradeRaw(raw, Version02); err != nil {
+        t.Fatal(err)
+    }
+    if _, ok := raw["trace"]; ok {
+        t.Fatal("trace kept in 0.2 message")
+    }
+    content := raw.Part("content")
+    commands, _ := content["commands"].([]interface{})
+    if len(commands) != 1 || commands[0].(map[string]interface{})["command_id"] != "c1" {
+        t.Fatalf("0.2 commands: %v", content)
+    }
+    if !reflect.DeepEqual(content["allowed_users"], []interface{}{"bob"}) {
+        t.Fatalf("0.2 allowed_users: %v", content["allowed_users"])
+    }
+
+    // 0.2 没有 waiting 状态
+    reply, err := messageToRaw(newTestVersionMessage(t, MsgTypeExecuteReply, &ExecuteReplyContent{Status: StatusWaiting}))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if err := DowngradeRaw(reply, Version02); err != nil {
+        t.Fatal(err)
+    }
+    if status := reply.Part("content")["status"]; status != string(StatusStarting) {
+        t.Fatalf("0.2 execute_reply status %v", status)
+    }
+}
+
+func TestWireLegacyFrames(t *testing.T) {
+    tests := []struct {
+        version string
+        msg     *Message
+    }{
+        {Version01, newTestVersionMessage(t, MsgTypeCommMsg, &CommMsgContent{CommId: "c1", Data: "x"})},
+        {Version02, newTestExecuteRequest(t, EncryptionNone, CompressGzip)},
+        {Version03, newTestExecuteRequest(t, EncryptionNone, CompressSnappy)},
+    }
+    for _, tt := range tests {
+        wire, err := NewWireCodec().WithPeerVersion(tt.version).Encode([][]byte{[]byte("peer")}, tt.msg)
+        if err != nil {
+            t.Fatalf("%s: %v", tt.version, err)
+        }
+        // wire: [identity, <IDS|MSG>, signature, 各版本的消息帧...]
+        if want := 3 + len(versionFrames[tt.version]); len(wire) != want {
+            t.Fatalf("%s: %d frames, want %d", tt.version, len(wire), want)
+        }
+        var header map[string]interface{}
+        if err := json.Unmarshal(wire[3], &header); err != nil {
+            t.Fatal(err)
+        }
+        if header["version"] != tt.version {
+            t.Fatalf("%s: header frame version %v", tt.version, header["version"])
+        }
+
+        ids, got, err := NewWireCodec().Decode(wire)
+        if err != nil {
+            t.Fatalf("%s: %v", tt.version, err)
+        }
+        if len(ids) != 1 || got.Header.Version != ProtocolVersion {
+            t.Fatalf("%s: ids %q version %s", tt.version, ids, got.Header.Version)
+        }
+        if !reflect.DeepEqual(got.Content, tt.msg.Content) {
+            t.Fatalf("%s: content %#v", tt.version, got.Content)
+        }
+    }
+}
+
+func TestWireLegacyFrameCount(t *testing.T) {
+    msg := newTestVersionMessage(t, MsgTypeStream, &StreamContent{Type: StreamStdout, Text: "hi"})
+
+    // 0.1 允许在消息帧之后携带原始数据帧
+    wire, err := NewWireCodec().WithPeerVersion(Version01).Encode(nil, msg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, got, err := NewWireCodec().Decode(append(wire, []byte("buffer"))); err != nil || got.Header.MsgType != MsgTypeStream {
+        t.Fatalf("0.1 with buffers: %v", err)
+    }
+    if _, _, err := NewWireCodec().Decode(wire[:len(wire)-1]); !errors.Is(err, ErrInvalidFormat) {
+        t.Fatalf("0.1 missing content frame: %v", err)
+    }
+
+    wire, err = NewWireCodec().WithPeerVersion(Version02).Encode(nil, msg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, _, err := NewWireCodec().Decode(append(wire, []byte("extra"))); !errors.Is(err, ErrInvalidFormat) {
+        t.Fatalf("0.2 with extra frame: %v", err)
+    }
+
+    // 旧版本不支持内容加密
+    encrypted := newTestExecuteRequest(t, EncryptionAES, CompressNone)
+    if _, err := newTestWireCodec(t).WithPeerVersion(Version03).Encode(nil, encrypted); !errors.Is(err, ErrInvalidVersion) {
+        t.Fatalf("encrypted legacy encode: %v", err)
+    }
+}
+
+func TestNegotiateVersion(t *testing.T) {
+    tests := []struct {
+        local, remote []string
+        want          string
+    }{
+        {[]string{Version02, Version03, Version04}, []string{Version02, Version03}, Version03},
+        {[]string{Version01, Version02}, []string{Version02, Version01}, Version02},
+        {[]string{"0.9", "0.10"}, []string{"0.10", "0.9"}, "0.10"},
+        {[]string{Version04}, []string{Version04, "1.0"}, Version04},
+    }
+    for _, tt := range tests {
+        got, err := NegotiateVersion(tt.local, tt.remote)
+        if err != nil || got != tt.want {
+            t.Fatalf("NegotiateVersion(%v, %v) = %q, %v, want %q", tt.local, tt.remote, got, err, tt.want)
+        }
+    }
+    if _, err := NegotiateVersion([]string{Version04}, []string{Version02, Version03}); !errors.Is(err, ErrInvalidVersion) {
+        t.Fatalf("no common version: %v", err)
+    }
+}
+
+func TestVersionRequestNegotiate(t *testing.T) {
+    if got := SupportedVersions(); !reflect.DeepEqual(got, []string{Version01, Version02, Version03, Version04}) {
+        t.Fatalf("SupportedVersions() = %v", got)
+    }
+
+    reply := (&VersionRequestContent{Versions: []string{Version02, Version03, "9.9"}}).Negotiate()
+    if reply.Status != StatusOK || reply.Version != Version03 {
+        t.Fatalf("negotiate: %+v", reply)
+    }
+    reply = (&VersionRequestContent{Versions: []string{"9.9"}}).Negotiate()
+    if reply.Status != StatusError || reply.Version != "" || len(reply.Versions) == 0 {
+        t.Fatalf("negotiate without common version: %+v", reply)
+    }
+}
+
+func TestValidateRequiresCurrentVersion(t *testing.T) {
+    for _, version := range []string{Version01, Version02, Version03, "", "9.9"} {
+        msg := newTestVersionMessage(t, MsgTypeStream, &StreamContent{Type: StreamStdout, Text: "hi"})
+        msg.Header.Version = version
+        if err := ValidateMessage(msg); !errors.Is(err, ErrInvalidVersion) {
+            t.Fatalf("version %q: %v", version, err)
+        }
+    }
+}
@@ -0,0 +1,145 @@
+package protocol
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// W3C Trace Context 相关常量
+const (
+    TraceparentHeader = "traceparent"
+    TracestateHeader  = "tracestate"
+
+    traceparentVersion = "00"
+    traceFlagSampled   = 0x01
+    maxTracestateItems = 32
+)
+
+// ParseTraceparent 根据 W3C traceparent / tracestate 创建延续该追踪的 MessageTrace，
+// 之后添加的根节点以上游的 parent-id 为父节点；tracestate 可以为空
+func ParseTraceparent(traceparent, tracestate string) (*MessageTrace, error) {
+    parts := strings.Split(strings.TrimSpace(traceparent), "-")
+    if len(parts) < 4 {
+        return nil, ErrInvalidFormat.WithDetails("malformed traceparent: " + traceparent)
+    }
+    version, traceId, parentId, flags := parts[0], parts[1], parts[2], parts[3]
+    // 未来版本可以在末尾追加字段，00 版本必须恰好 4 段
+    if !isLowerHex(version, 2) || version == "ff" || (version == traceparentVersion && len(parts) != 4) {
+        return nil, ErrInvalidFormat.WithDetails("unsupported traceparent version: " + version)
+    }
+    if !isLowerHex(traceId, 32) || strings.Trim(traceId, "0") == "" {
+        return nil, ErrInvalidFormat.WithDetails("invalid trace-id: " + traceId)
+    }
+    if !isLowerHex(parentId, 16) || strings.Trim(parentId, "0") == "" {
+        return nil, ErrInvalidFormat.WithDetails("invalid parent-id: " + parentId)
+    }
+    if !isLowerHex(flags, 2) {
+        return nil, ErrInvalidFormat.WithDetails("invalid trace-flags: " + flags)
+    }
+    state, err := normalizeTracestate(tracestate)
+    if err != nil {
+        return nil, err
+    }
+
+    return &MessageTrace{
+        TraceId:      traceId,
+        StartTime:    time.Now(),
+        Hops:         make([]*MessageHop, 0),
+        ParentSpanId: parentId,
+        TraceFlags:   flags,
+        TraceState:   state,
+    }, nil
+}
+
+// Traceparent 生成向下游传递的 W3C traceparent，parent-id 取 hop 的 span_id；
+// hop 为 nil 时取最近添加的节点，追踪中没有节点时沿用上游的 parent-id
+func (mt *MessageTrace) Traceparent(hop *MessageHop) (string, error) {
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+
+    if !isLowerHex(mt.TraceId, 32) || strings.Trim(mt.TraceId, "0") == "" {
+        return "", ErrInvalidFormat.WithDetails("trace_id is not W3C compatible: " + mt.TraceId)
+    }
+    spanId := mt.ParentSpanId
+    if hop != nil {
+        spanId = hop.SpanId
+    } else if len(mt.Hops) > 0 {
+        spanId = mt.Hops[len(mt.Hops)-1].SpanId
+    }
+    if !isLowerHex(spanId, 16) || strings.Trim(spanId, "0") == "" {
+        return "", ErrInvalidFormat.WithDetails("no W3C compatible span_id to use as parent-id")
+    }
+    return fmt.Sprintf("%s-%s-%s-%s", traceparentVersion, mt.TraceId, spanId, mt.traceFlags()), nil
+}
+
+// Tracestate 返回向下游传递的 W3C tracestate
+func (mt *MessageTrace) Tracestate() string {
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    return mt.TraceState
+}
+
+// Sampled 追踪是否被采样，未设置 trace_flags 时视为已采样
+func (mt *MessageTrace) Sampled() bool {
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    flags, _ := strconv.ParseUint(mt.traceFlags(), 16, 8)
+    return flags&traceFlagSampled != 0
+}
+
+// SetSampled 设置 trace_flags 中的采样位，其余标志位保持不变
+func (mt *MessageTrace) SetSampled(sampled bool) {
+    mt.mu.Lock()
+    defer mt.mu.Unlock()
+    flags, _ := strconv.ParseUint(mt.traceFlags(), 16, 8)
+    if sampled {
+        flags |= traceFlagSampled
+    } else {
+        flags &^= traceFlagSampled
+    }
+    mt.TraceFlags = fmt.Sprintf("%02x", flags)
+}
+
+// traceFlags 需持有锁
+func (mt *MessageTrace) traceFlags() string {
+    if !isLowerHex(mt.TraceFlags, 2) {
+        return "01"
+    }
+    return mt.TraceFlags
+}
+
+// normalizeTracestate 去除空白和空成员，校验成员格式与数量
+func normalizeTracestate(tracestate string) (string, error) {
+    var members []string
+    for _, member := range strings.Split(tracestate, ",") {
+        member = strings.TrimSpace(member)
+        if member == "" {
+            continue
+        }
+        eq := strings.IndexByte(member, '=')
+        if eq <= 0 || eq == len(member)-1 {
+            return "", ErrInvalidFormat.WithDetails("invalid tracestate member: " + member)
+        }
+        members = append(members, member)
+    }
+    if len(members) > maxTracestateItems {
+        return "", ErrInvalidFormat.WithDetails("tracestate has too many members")
+    }
+    return strings.Join(members, ","), nil
+}
+
+// isLowerHex 检查 s 是否为指定长度的小写十六进制串
+func isLowerHex(s string, n int) bool {
+    if len(s) != n {
+        return false
+    }
+    for i := 0; i < len(s); i++ {
+        c := s[i]
+        if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+            return false
+        }
+    }
+    return true
+}
@@ -0,0 +1,132 @@
+package protocol
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+const (
+    testTraceId  = "4bf92f3577b34da6a3ce929d0e0e4736"
+    testParentId = "00f067aa0ba902b7"
+)
+
+func TestParseTraceparent(t *testing.T) {
+    trace, err := ParseTraceparent("00-"+testTraceId+"-"+testParentId+"-01", " congo=t61rcWkgMzE ,, rojo=00f067aa0ba902b7 ")
+    if err != nil {
+        t.Fatal(err)
+    }
+    if trace.TraceId != testTraceId || trace.ParentSpanId != testParentId || trace.TraceFlags != "01" {
+        t.Fatalf("unexpected trace %+v", trace)
+    }
+    if got := trace.Tracestate(); got != "congo=t61rcWkgMzE,rojo=00f067aa0ba902b7" {
+        t.Fatalf("tracestate %q", got)
+    }
+    if !trace.Sampled() {
+        t.Fatal("sampled flag lost")
+    }
+
+    // 没有节点时沿用上游的 parent-id，之后以最近添加的节点为 parent-id
+    if got, err := trace.Traceparent(nil); err != nil || got != "00-"+testTraceId+"-"+testParentId+"-01" {
+        t.Fatalf("Traceparent() = %q, %v", got, err)
+    }
+    root := trace.AddHop("core-1", "core", "localhost")
+    if root.ParentSpanId != testParentId {
+        t.Fatalf("root hop parent %q", root.ParentSpanId)
+    }
+    child := root.StartChild("db-1", "db", "localhost")
+    if got, _ := trace.Traceparent(nil); got != "00-"+testTraceId+"-"+child.SpanId+"-01" {
+        t.Fatalf("Traceparent(nil) = %q", got)
+    }
+    if got, _ := trace.Traceparent(root); got != "00-"+testTraceId+"-"+root.SpanId+"-01" {
+        t.Fatalf("Traceparent(root) = %q", got)
+    }
+
+    // 未来版本可以在末尾追加字段
+    if _, err := ParseTraceparent("01-"+testTraceId+"-"+testParentId+"-01-extra", ""); err != nil {
+        t.Fatalf("future version: %v", err)
+    }
+}
+
+func TestParseTraceparentInvalid(t *testing.T) {
+    zeroTrace := strings.Repeat("0", 32)
+    zeroParent := strings.Repeat("0", 16)
+    for name, traceparent := range map[string]string{
+        "empty":              "",
+        "too few parts":      "00-" + testTraceId + "-" + testParentId,
+        "version ff":         "ff-" + testTraceId + "-" + testParentId + "-01",
+        "version not hex":    "0g-" + testTraceId + "-" + testParentId + "-01",
+        "version 00 extra":   "00-" + testTraceId + "-" + testParentId + "-01-extra",
+        "upper case trace":   "00-" + strings.ToUpper(testTraceId) + "-" + testParentId + "-01",
+        "short trace":        "00-" + testTraceId[1:] + "-" + testParentId + "-01",
+        "all-zero trace-id":  "00-" + zeroTrace + "-" + testParentId + "-01",
+        "all-zero parent-id": "00-" + testTraceId + "-" + zeroParent + "-01",
+        "short flags":        "00-" + testTraceId + "-" + testParentId + "-1",
+        "flags not hex":      "00-" + testTraceId + "-" + testParentId + "-0x",
+    } {
+        if _, err := ParseTraceparent(traceparent, ""); !errors.Is(err, ErrInvalidFormat) {
+            t.Errorf("%s: expected ErrInvalidFormat, got %v", name, err)
+        }
+    }
+
+    valid := "00-" + testTraceId + "-" + testParentId + "-01"
+    tooMany := strings.TrimSuffix(strings.Repeat("k=v,", maxTracestateItems+1), ",")
+    for _, tracestate := range []string{"novalue", "=v", "k=", tooMany} {
+        if _, err := ParseTraceparent(valid, tracestate); !errors.Is(err, ErrInvalidFormat) {
+            t.Errorf("tracestate %q: expected ErrInvalidFormat, got %v", tracestate, err)
+        }
+    }
+}
+
+func TestTraceparentRequiresW3CIds(t *testing.T) {
+    trace := &MessageTrace{TraceId: "not-a-w3c-id"}
+    if _, err := trace.Traceparent(nil); !errors.Is(err, ErrInvalidFormat) {
+        t.Fatalf("non-hex trace_id: %v", err)
+    }
+
+    // 新建的追踪可以直接生成 traceparent，但需要至少一个节点提供 parent-id
+    trace = NewMessageTrace()
+    if _, err := trace.Traceparent(nil); !errors.Is(err, ErrInvalidFormat) {
+        t.Fatalf("trace without hops: %v", err)
+    }
+    hop := trace.AddHop("core-1", "core", "localhost")
+    got, err := trace.Traceparent(nil)
+    if err != nil {
+        t.Fatal(err)
+    }
+    parsed, err := ParseTraceparent(got, "")
+    if err != nil || parsed.TraceId != trace.TraceId || parsed.ParentSpanId != hop.SpanId {
+        t.Fatalf("round trip of %q: %+v, %v", got, parsed, err)
+    }
+
+    hop.SpanId = ""
+    if _, err := trace.Traceparent(hop); !errors.Is(err, ErrInvalidFormat) {
+        t.Fatalf("hop without span_id: %v", err)
+    }
+}
+
+func TestTraceSampling(t *testing.T) {
+    trace, err := ParseTraceparent("00-"+testTraceId+"-"+testParentId+"-03", "")
+    if err != nil {
+        t.Fatal(err)
+    }
+    trace.SetSampled(false)
+    if trace.Sampled() || trace.TraceFlags != "02" {
+        t.Fatalf("SetSampled(false): flags %q", trace.TraceFlags)
+    }
+    if got, _ := trace.Traceparent(nil); !strings.HasSuffix(got, "-02") {
+        t.Fatalf("traceparent %q", got)
+    }
+    trace.SetSampled(true)
+    if !trace.Sampled() || trace.TraceFlags != "03" {
+        t.Fatalf("SetSampled(true): flags %q", trace.TraceFlags)
+    }
+
+    // 未设置 trace_flags 视为已采样
+    if !NewMessageTrace().Sampled() {
+        t.Fatal("new trace not sampled")
+    }
+    if clone := trace.Clone(); clone.TraceFlags != "03" || clone.ParentSpanId != testParentId {
+        t.Fatalf("clone lost W3C fields: %+v", clone)
+    }
+}
@@ -0,0 +1,398 @@
+package protocol
+
+import (
+	"bytes"
+	"encoding/json"
+)
+
+// Wire Protocol 常量
+const (
+    // WireDelimiter 分隔 zmq 路由前缀与消息帧
+    WireDelimiter = "<IDS|MSG>"
+
+    // WireFrameCount 分隔符之后的帧数：签名 + 6 个消息帧
+    WireFrameCount = 7
+)
+
+// 消息帧在六个帧中的位置
+const (
+    frameHeader = iota
+    frameParentHeader
+    frameMeta
+    frameContent
+    frameSecurity
+    frameTrace
+)
+
+// WireCodec 负责 Message 与 Wire Protocol 多帧格式之间的转换
+//
+//  [identities..., <IDS|MSG>, signature, header, parent_header, meta, content, security, trace]
+//
+// header 帧始终不压缩，其余帧按 header.compression 压缩（compress_all 为 false 时仅压缩 content），
+// content 在压缩后按 security.encryption 加密；
+// 其余帧按 header.encoding（自定义编码时为 header.codec）编码，解码端通过 header 帧首字节区分 JSON 与 protobuf
+type WireCodec struct {
+    signer            *Signer
+    autoCompression   Compression
+    compressThreshold int
+    peerVersion       string // 对端协议版本，低于当前版本时编码前降级
+    cipher            *ContentCipher
+}
+
+// NewWireCodec 创建 Wire 编解码器
+func NewWireCodec() *WireCodec {
+    return &WireCodec{
+        autoCompression:   CompressGzip,
+        compressThreshold: DefaultCompressThreshold,
+    }
+}
+
+// WithSigner 设置签名器，设置后编码时签名、解码时校验签名
+func (c *WireCodec) WithSigner(signer *Signer) *WireCodec {
+    c.signer = signer
+    return c
+}
+
+// WithAutoCompression 设置 auto 模式使用的压缩方式和阈值（content 帧字节数）
+func (c *WireCodec) WithAutoCompression(compression Compression, threshold int) *WireCodec {
+    c.autoCompression = compression
+    c.compressThreshold = threshold
+    return c
+}
+
+// WithCipher 设置 content 加解密器，security.encryption 为 AES / RSA 时编码加密、解码解密
+func (c *WireCodec) WithCipher(cipher *ContentCipher) *WireCodec {
+    c.cipher = cipher
+    return c
+}
+
+// WithPeerVersion 设置对端协议版本（通常由版本协商得到），编码时按该版本降级
+func (c *WireCodec) WithPeerVersion(version string) *WireCodec {
+    c.peerVersion = version
+    return c
+}
+
+// Encode 将消息编码为完整的 wire 帧，identities 为 zmq 路由前缀（可为空）
+func (c *WireCodec) Encode(identities [][]byte, msg *Message) ([][]byte, error) {
+    if msg == nil {
+        return nil, ErrSerializeFailed.WithDetails("message is nil")
+    }
+
+    var frames [][]byte
+    var err error
+    if c.peerVersion != "" && c.peerVersion != ProtocolVersion {
+        frames, err = c.serializeLegacyFrames(msg, c.peerVersion)
+    } else {
+        frames, err = c.serializeFrames(msg)
+    }
+    if err != nil {
+        return nil, err
+    }
+
+    wire := make([][]byte, 0, len(identities)+2+len(frames))
+    wire = append(wire, identities...)
+    wire = append(wire, []byte(WireDelimiter))
+    if c.signer != nil {
+        wire = append(wire, c.signer.Sign(frames))
+    } else {
+        wire = append(wire, []byte{}) // 未配置签名时签名帧为空
+    }
+    wire = append(wire, frames...)
+    return wire, nil
+}
+
+// Decode 解析 wire 帧，返回路由前缀和消息，旧版本消息会升级到当前版本
+func (c *WireCodec) Decode(wire [][]byte) ([][]byte, *Message, error) {
+    identities, frames, err := SplitWireFrames(wire)
+    if err != nil {
+        return nil, nil, err
+    }
+    if len(frames) < 2 {
+        return nil, nil, ErrInvalidFormat.WithDetails("missing message frames after delimiter")
+    }
+
+    // 先校验签名，再解析内容
+    if c.signer != nil {
+        if err := c.signer.Verify(frames[1:], frames[0]); err != nil {
+            return nil, nil, err
+        }
+    }
+
+    msg, err := c.deserializeFrames(frames[1:])
+    if err != nil {
+        return nil, nil, err
+    }
+    return identities, msg, nil
+}
+
+// SplitWireFrames 按分隔符拆分路由前缀和分隔符之后的帧
+func SplitWireFrames(wire [][]byte) (identities [][]byte, frames [][]byte, err error) {
+    for i, frame := range wire {
+        if bytes.Equal(frame, []byte(WireDelimiter)) {
+            return wire[:i], wire[i+1:], nil
+        }
+    }
+    return nil, nil, ErrInvalidFormat.WithDetails("missing <IDS|MSG> delimiter")
+}
+
+// serializeFrames 将消息序列化为 header, parent_header, meta, content, security, trace 六个帧
+func (c *WireCodec) serializeFrames(msg *Message) ([][]byte, error) {
+    codec, err := CodecForHeader(&msg.Header)
+    if err != nil {
+        return nil, err
+    }
+
+    // 复制 header 等结构，避免修改调用方的消息
+    header := msg.Header
+    parentHeader := msg.ParentHeader
+    meta := msg.Meta
+    security := msg.Security
+    parts := []interface{}{
+        nil, // header 最后序列化，压缩方式可能在此过程中确定
+        &parentHeader,
+        &meta,
+        msg.Content,
+        &security,
+        msg.Trace,
+    }
+
+    frames := make([][]byte, len(parts))
+    for i := frameParentHeader; i < len(parts); i++ {
+        data, err := codec.Marshal(parts[i])
+        if err != nil {
+            return nil, ErrSerializeFailed.WithDetails(err.Error())
+        }
+        frames[i] = data
+    }
+
+    header.Compression = c.resolveCompression(header.Compression, len(frames[frameContent]))
+    for i := frameParentHeader; i < len(frames); i++ {
+        if i != frameContent && !header.CompressAll {
+            continue
+        }
+        data, err := Compress(header.Compression, frames[i])
+        if err != nil {
+            return nil, err
+        }
+        frames[i] = data
+    }
+
+    // 先压缩再加密，密文不可压缩
+    if normalizeEncryption(security.Encryption) != EncryptionNone {
+        if c.cipher == nil {
+            return nil, ErrSerializeFailed.WithDetails("content cipher is not configured")
+        }
+        data, err := c.cipher.Encrypt(&header, security.Encryption, frames[frameContent])
+        if err != nil {
+            return nil, err
+        }
+        frames[frameContent] = data
+    }
+
+    data, err := marshalHeaderFrame(&header)
+    if err != nil {
+        return nil, ErrSerializeFailed.WithDetails(err.Error())
+    }
+    frames[frameHeader] = data
+    return frames, nil
+}
+
+// resolveCompression 将 auto 解析为实际压缩方式
+func (c *WireCodec) resolveCompression(compression Compression, contentSize int) Compression {
+    if compression != CompressAuto {
+        return compression
+    }
+    if contentSize > c.compressThreshold {
+        return c.autoCompression
+    }
+    return CompressNone
+}
+
+// deserializeFrames 从六个消息帧还原消息，content 按 msg_type 解析为具体类型
+func (c *WireCodec) deserializeFrames(frames [][]byte) (*Message, error) {
+    var msg Message
+    if err := decodeHeaderFrame(frames[frameHeader], &msg.Header); err != nil {
+        return nil, ErrDeserializeFailed.WithDetails("header: " + err.Error())
+    }
+    if msg.Header.Version != "" && msg.Header.Version != ProtocolVersion {
+        return c.deserializeLegacyFrames(&msg.Header, frames)
+    }
+    if len(frames) != WireFrameCount-1 {
+        return nil, ErrInvalidFormat.WithDetails("expected 6 message frames")
+    }
+
+    codec, err := CodecForHeader(&msg.Header)
+    if err != nil {
+        return nil, err
+    }
+
+    // 按 header 描述解压其余帧，content 需要先根据 security 解密
+    plain := make([][]byte, len(frames))
+    copy(plain, frames)
+    for i := frameParentHeader; i < len(frames); i++ {
+        if i == frameContent || !msg.Header.CompressAll {
+            continue
+        }
+        data, err := Decompress(msg.Header.Compression, frames[i])
+        if err != nil {
+            return nil, err
+        }
+        plain[i] = data
+    }
+
+    if err := codec.Unmarshal(plain[frameSecurity], &msg.Security); err != nil {
+        return nil, ErrDeserializeFailed.WithDetails("security: " + err.Error())
+    }
+    if !IsValidEncryption(msg.Security.Encryption) {
+        return nil, ErrValidationFailed.WithDetails("unsupported encryption: " + msg.Security.Encryption)
+    }
+    if normalizeEncryption(msg.Security.Encryption) != EncryptionNone {
+        if c.cipher == nil {
+            return nil, ErrDeserializeFailed.WithDetails("content cipher is not configured")
+        }
+        data, err := c.cipher.Decrypt(&msg.Header, msg.Security.Encryption, plain[frameContent])
+        if err != nil {
+            return nil, err
+        }
+        plain[frameContent] = data
+    }
+    data, err := Decompress(msg.Header.Compression, plain[frameContent])
+    if err != nil {
+        return nil, err
+    }
+    plain[frameContent] = data
+
+    if err := codec.Unmarshal(plain[frameParentHeader], &msg.ParentHeader); err != nil {
+        return nil, ErrDeserializeFailed.WithDetails("parent_header: " + err.Error())
+    }
+    if err := codec.Unmarshal(plain[frameMeta], &msg.Meta); err != nil {
+        return nil, ErrDeserializeFailed.WithDetails("meta: " + err.Error())
+    }
+
+    content := GetContentType(msg.Header.MsgType)
+    if content == nil {
+        return nil, ErrInvalidMessageType.WithDetails(msg.Header.MsgType)
+    }
+    if err := codec.Unmarshal(plain[frameContent], content); err != nil {
+        return nil, ErrDeserializeFailed.WithDetails("content: " + err.Error())
+    }
+    msg.Content = content
+
+    if !isNullFrame(plain[frameTrace]) {
+        msg.Trace = &MessageTrace{}
+        if err := codec.Unmarshal(plain[frameTrace], msg.Trace); err != nil {
+            return nil, ErrDeserializeFailed.WithDetails("trace: " + err.Error())
+        }
+    }
+    return &msg, nil
+}
+
+// serializeLegacyFrames 将消息降级到旧版本并按该版本的帧结构序列化，旧版本只使用 JSON 编码
+func (c *WireCodec) serializeLegacyFrames(msg *Message, version string) ([][]byte, error) {
+    if normalizeEncryption(msg.Security.Encryption) != EncryptionNone {
+        return nil, ErrInvalidVersion.WithDetails("content encryption requires protocol version " + ProtocolVersion)
+    }
+    raw, err := messageToRaw(msg)
+    if err != nil {
+        return nil, err
+    }
+
+    compression := CompressNone
+    if version != Version01 { // 0.1 没有压缩字段
+        content, _ := json.Marshal(raw["content"])
+        compression = c.resolveCompression(msg.Header.Compression, len(content))
+    }
+    header := raw.Part("header")
+    header["compression"] = string(compression)
+    delete(header, "compress_all")
+
+    if err := DowngradeRaw(raw, version); err != nil {
+        return nil, err
+    }
+
+    names := versionFrames[version]
+    frames := make([][]byte, len(names))
+    for i, name := range names {
+        part, ok := raw[name]
+        if !ok {
+            part = map[string]interface{}{}
+        }
+        data, err := json.Marshal(part)
+        if err != nil {
+            return nil, ErrSerializeFailed.WithDetails(err.Error())
+        }
+        if name == "content" {
+            if data, err = Compress(compression, data); err != nil {
+                return nil, err
+            }
+        }
+        frames[i] = data
+    }
+    return frames, nil
+}
+
+// deserializeLegacyFrames 按旧版本的帧结构解析消息并升级到当前版本
+func (c *WireCodec) deserializeLegacyFrames(header *Header, frames [][]byte) (*Message, error) {
+    names, ok := versionFrames[header.Version]
+    if !ok || !IsSupportedVersion(header.Version) {
+        return nil, ErrInvalidVersion.WithDetails("unsupported version: " + header.Version)
+    }
+    // 0.1 允许在消息帧之后携带原始数据帧，这些帧被忽略
+    if len(frames) < len(names) || (header.Version != Version01 && len(frames) != len(names)) {
+        return nil, ErrInvalidFormat.WithDetails("unexpected frame count for version " + header.Version)
+    }
+
+    raw := RawMessage{}
+    for i, name := range names {
+        data := frames[i]
+        if name == "content" && header.Version != Version01 {
+            plain, err := Decompress(header.Compression, data)
+            if err != nil {
+                return nil, err
+            }
+            data = plain
+        }
+        var part interface{}
+        if err := json.Unmarshal(data, &part); err != nil {
+            return nil, ErrDeserializeFailed.WithDetails(name + ": " + err.Error())
+        }
+        raw[name] = part
+    }
+    if err := UpgradeRaw(raw); err != nil {
+        return nil, err
+    }
+
+    // content 已解压，升级后的消息按普通 JSON 消息解析
+    raw.Part("header")["compression"] = string(CompressNone)
+    data, err := json.Marshal(raw)
+    if err != nil {
+        return nil, ErrDeserializeFailed.WithDetails(err.Error())
+    }
+    msg, err := ParseMessage(data)
+    if err != nil {
+        return nil, ErrDeserializeFailed.WithDetails(err.Error())
+    }
+    return msg, nil
+}
+
+// marshalHeaderFrame 序列化 header 帧，protobuf 编码时使用 protobuf，其余（含自定义编码）使用 JSON，
+// 保证接收端无需预先知道编码即可解析 header
+func marshalHeaderFrame(h *Header) ([]byte, error) {
+    if h.Encoding == EncodeProtobuf {
+        return marshalProto(h)
+    }
+    return json.Marshal(h)
+}
+
+// decodeHeaderFrame 解析 header 帧，首字节为 '{' 时按 JSON 解析，否则按 protobuf 解析
+func decodeHeaderFrame(data []byte, h *Header) error {
+    if len(data) > 0 && data[0] == '{' {
+        return json.Unmarshal(data, h)
+    }
+    return h.unmarshalProto(data)
+}
+
+// isNullFrame 判断帧是否表示空值（JSON null 或空的 protobuf 帧）
+func isNullFrame(data []byte) bool {
+    return len(data) == 0 || string(data) == "null"
+}
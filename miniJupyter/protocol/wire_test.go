@@ -0,0 +1,142 @@
+package protocol
+
+import (
+	"bytes"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func newTestExecuteRequest(t *testing.T, encryption string, compression Compression) *Message {
+    t.Helper()
+    msg, err := NewMessageBuilder().
+        WithType(MsgTypeExecuteRequest).
+        WithSession("s1").
+        WithUser("alice").
+        WithTransport(TransportZMQ).
+        WithCompression(compression).
+        WithEncryption(encryption).
+        WithContent(&ExecuteRequestContent{
+            CommandId: "c1",
+            Service:   "db",
+            Method:    "login",
+            Params:    map[string]interface{}{"password": strings.Repeat("hunter2", 100)},
+        }).
+        Build()
+    if err != nil {
+        t.Fatal(err)
+    }
+    return msg
+}
+
+func newTestWireCodec(t *testing.T) *WireCodec {
+    t.Helper()
+    signer, err := NewSigner(SignatureHMACSHA256, []byte("wire-secret"))
+    if err != nil {
+        t.Fatal(err)
+    }
+    return NewWireCodec().
+        WithSigner(signer).
+        WithCipher(NewContentCipher().WithAESKey(testAESKey(3)))
+}
+
+func TestWireRoundTripSignedEncrypted(t *testing.T) {
+    codec := newTestWireCodec(t)
+    for _, compression := range []Compression{CompressNone, CompressGzip, CompressSnappy, CompressAuto} {
+        msg := newTestExecuteRequest(t, EncryptionAES, compression)
+        wire, err := codec.Encode([][]byte{[]byte("client-1")}, msg)
+        if err != nil {
+            t.Fatalf("%s: %v", compression, err)
+        }
+        for _, frame := range wire {
+            if bytes.Contains(frame, []byte("hunter2")) {
+                t.Fatalf("%s: plaintext visible on the wire", compression)
+            }
+        }
+
+        ids, got, err := codec.Decode(wire)
+        if err != nil {
+            t.Fatalf("%s: %v", compression, err)
+        }
+        if len(ids) != 1 || string(ids[0]) != "client-1" {
+            t.Fatalf("%s: identities %q", compression, ids)
+        }
+        if !reflect.DeepEqual(got.Content, msg.Content) {
+            t.Fatalf("%s: content mismatch %#v", compression, got.Content)
+        }
+    }
+}
+
+func TestWireRejectsTamperedFrames(t *testing.T) {
+    codec := newTestWireCodec(t)
+    wire, err := codec.Encode(nil, newTestExecuteRequest(t, EncryptionAES, CompressNone))
+    if err != nil {
+        t.Fatal(err)
+    }
+    // wire: [<IDS|MSG>, signature, header, parent_header, meta, content, security, trace]
+    for i := 1; i < len(wire); i++ {
+        tampered := make([][]byte, len(wire))
+        for j := range wire {
+            tampered[j] = append([]byte(nil), wire[j]...)
+        }
+        if len(tampered[i]) == 0 {
+            tampered[i] = []byte{'x'}
+        } else {
+            tampered[i][len(tampered[i])/2] ^= 0x01
+        }
+        if _, _, err := codec.Decode(tampered); GetErrorCode(err) != ErrCodeInvalidSignature {
+            t.Errorf("frame %d: expected ErrInvalidSignature, got %v", i, err)
+        }
+    }
+
+    // 缺少签名
+    unsigned := append([][]byte(nil), wire...)
+    unsigned[1] = []byte{}
+    if _, _, err := codec.Decode(unsigned); GetErrorCode(err) != ErrCodeInvalidSignature {
+        t.Fatalf("missing signature accepted: %v", err)
+    }
+}
+
+func TestWireRejectsTamperedCiphertext(t *testing.T) {
+    // 未配置签名时，密文的完整性由 AES-GCM 保证
+    codec := NewWireCodec().WithCipher(NewContentCipher().WithAESKey(testAESKey(3)))
+    wire, err := codec.Encode(nil, newTestExecuteRequest(t, EncryptionAES, CompressNone))
+    if err != nil {
+        t.Fatal(err)
+    }
+    content := 2 + frameContent
+    wire[content] = append([]byte(nil), wire[content]...)
+    wire[content][len(wire[content])-1] ^= 0x01
+    if _, _, err := codec.Decode(wire); GetErrorCode(err) != ErrCodeDeserializeFailed {
+        t.Fatalf("tampered ciphertext accepted: %v", err)
+    }
+}
+
+func TestWireEncryptionRequiresCipher(t *testing.T) {
+    msg := newTestExecuteRequest(t, EncryptionAES, CompressNone)
+    if _, err := NewWireCodec().Encode(nil, msg); GetErrorCode(err) != ErrCodeSerializeFailed {
+        t.Fatalf("encrypted message encoded without cipher: %v", err)
+    }
+
+    wire, err := newTestWireCodec(t).Encode(nil, msg)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, _, err := NewWireCodec().Decode(wire); GetErrorCode(err) != ErrCodeDeserializeFailed {
+        t.Fatalf("encrypted message decoded without cipher: %v", err)
+    }
+}
+
+func TestWireMalformed(t *testing.T) {
+    codec := NewWireCodec()
+    if _, _, err := codec.Decode([][]byte{[]byte("id"), []byte("x")}); GetErrorCode(err) != ErrCodeInvalidFormat {
+        t.Fatalf("missing delimiter: %v", err)
+    }
+    wire, err := codec.Encode(nil, newTestExecuteRequest(t, EncryptionNone, CompressNone))
+    if err != nil {
+        t.Fatal(err)
+    }
+    if _, _, err := codec.Decode(wire[:len(wire)-1]); GetErrorCode(err) != ErrCodeInvalidFormat {
+        t.Fatalf("missing frame: %v", err)
+    }
+}